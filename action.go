@@ -33,6 +33,7 @@ const (
 const (
 	DHTChangeOK = iota
 	DHTChangeUnknownHashQueuedForRetry
+	DHTChangeValidationPendingQueuedForRetry
 )
 
 // Arg holds the definition of an API function argument
@@ -130,22 +131,33 @@ func (h *Holochain) ValidateAction(a ValidatingAction, entryType string, pkg *Pa
 		h.Debugf("Sys ValidateAction(%T) err:%v\n", a, err)
 		return
 	}
-	if !def.IsSysEntry() {
+	var vpkg *ValidationPackage
+	vpkg, err = MakeValidationPackage(h, pkg)
+	if err != nil {
+		return
+	}
+
+	// run the declarative validation rules of the DNA
+	err = h.checkValidationRules(a, def, vpkg, sources)
+	if err != nil {
+		h.Debugf("Rules ValidateAction(%T) err:%v\n", a, err)
+		return
+	}
+
+	if !def.IsSysEntry() && (def.Rules == nil || !def.Rules.NoRibosome) {
 
 		// validation actions for application defined entry types
-		var vpkg *ValidationPackage
-		vpkg, err = MakeValidationPackage(h, pkg)
-		if err != nil {
-			return
-		}
 
 		// run the action's app level validations
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		n, err = h.ribosomes.get(h, z)
 		if err != nil {
 			return
 		}
+		defer h.ribosomes.put(z, n)
 
+		// code that runs out of time says nothing about the data, as it may only be that we
+		// are slow or busy, so timeouts are returned as they are for the change to be retried
 		err = n.ValidateAction(a, def, vpkg, prepareSources(sources))
 		if err != nil {
 			h.Debugf("Ribosome ValidateAction(%T) err:%v\n", a, err)
@@ -182,6 +194,9 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 			return
 		}
 		resp.Header = *hd
+		if resp.HeaderSig, err = h.signHeader(hd); err != nil {
+			return
+		}
 	}
 	switch resp.Type {
 	case DNAEntryType:
@@ -216,17 +231,29 @@ func (h *Holochain) GetValidationResponse(a ValidatingAction, hash Hash) (resp V
 
 		// get the packaging request from the app
 		var n Ribosome
-		n, err = z.MakeRibosome(h)
+		n, err = h.ribosomes.get(h, z)
 		if err != nil {
 			return
 		}
+		defer h.ribosomes.put(z, n)
 
 		var req PackagingReq
-		req, err = n.ValidatePackagingRequest(a, def)
+		if def.Rules == nil || !def.Rules.NoRibosome {
+			req, err = n.ValidatePackagingRequest(a, def)
+			if err != nil {
+				h.Debugf("Ribosome GetValidationPackage(%T) err:%v\n", a, err)
+			}
+		}
+		req = def.Rules.addPackagingRequest(def, req)
+		req, err = resolvePkgReqFields(req, def, &resp.Entry)
 		if err != nil {
-			h.Debugf("Ribosome GetValidationPackage(%T) err:%v\n", a, err)
+			return
 		}
 		resp.Package, err = MakePackage(h, req)
+		if err != nil {
+			return
+		}
+		resp.PackageSig, err = h.signPackage(&resp.Package)
 	}
 	return
 }
@@ -372,17 +399,15 @@ const (
 )
 
 func RunValidationPhase(h *Holochain, source peer.ID, msgType MsgType, query Hash, handler func(resp ValidateResponse) error) (err error) {
-	var r interface{}
-	msg := h.node.NewMessage(msgType, ValidateQuery{H: query})
-	r, err = h.Send(h.node.ctx, ValidateProtocol, source, msg, 0)
+	var resp ValidateResponse
+	resp, err = h.getValidationResponse(source, msgType, query)
 	if err != nil {
+		if h.isUnreachable(source, err) {
+			h.dht.dlog.Logf("error getting validation package for %v from %v: %v", query, source, err)
+			err = ErrValidationSourceUnreachable
+		}
 		return
 	}
-	switch resp := r.(type) {
-	case ValidateResponse:
-		err = handler(resp)
-	default:
-		err = fmt.Errorf("expected ValidateResponse from validator got %T", r)
-	}
+	err = handler(resp)
 	return
 }
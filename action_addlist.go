@@ -38,6 +38,10 @@ func (a *ActionListAdd) Receive(dht *DHT, msg *Message) (response interface{}, e
 	}
 
 	// validate the warrant sent with the list add request
+	if len(t.Warrant) == 0 {
+		err = fmt.Errorf("%s: %v", prefix, MissingWarrantErr)
+		return
+	}
 	var w Warrant
 	w, err = DecodeWarrant(t.WarrantType, t.Warrant)
 	if err != nil {
@@ -51,7 +55,15 @@ func (a *ActionListAdd) Receive(dht *DHT, msg *Message) (response interface{}, e
 		return
 	}
 
-	// TODO verify that the warrant, if valid, is sufficient to allow list addition #300
+	err = checkWarrantCovers(w, a.list)
+	if err != nil {
+		err = fmt.Errorf("%s: %v", prefix, err)
+		return
+	}
+	warrant := encodeWarrantRecord(t.WarrantType, t.Warrant)
+	for i := range a.list.Records {
+		a.list.Records[i].Warrant = warrant
+	}
 
 	err = dht.addToList(msg, a.list)
 	if err != nil {
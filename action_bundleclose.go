@@ -28,12 +28,14 @@ func (a *APIFnCloseBundle) Call(h *Holochain) (response interface{}, err error)
 	if isCancel {
 		for _, zome := range h.nucleus.dna.Zomes {
 			var r Ribosome
-			r, _, err = h.MakeRibosome(zome.Name)
+			var z *Zome
+			r, z, err = h.GetRibosome(zome.Name)
 			if err != nil {
 				continue
 			}
 			var result string
 			result, err = r.BundleCanceled(BundleCancelReasonUserCancel)
+			h.ReleaseRibosome(z, r)
 			if err != nil {
 				Debugf("error in %s.bundleCanceled():%v", zome.Name, err)
 				continue
@@ -88,7 +88,7 @@ func (a *ActionDel) Receive(dht *DHT, msg *Message) (response interface{}, err e
 
 		a := NewDelAction(delEntry)
 		//@TODO what comes back from Validate Del
-		_, err = dht.h.ValidateAction(a, resp.Type, &resp.Package, []peer.ID{msg.From})
+		err = dht.h.validateReceived(a, &resp.Header, resp.Type, &resp.Package, []peer.ID{msg.From})
 		if err != nil {
 			// how do we record an invalid DEL?
 			//@TODO store as REJECTED
@@ -0,0 +1,51 @@
+package holochain
+
+import (
+	. "github.com/holochain/holochain-proto/hash"
+)
+
+//------------------------------------------------------------
+// Encrypt
+
+type APIFnEncrypt struct {
+	to   Hash
+	data []byte
+}
+
+func (a *APIFnEncrypt) Name() string {
+	return "encrypt"
+}
+
+func (a *APIFnEncrypt) Args() []Arg {
+	return []Arg{{Name: "to", Type: HashArg}, {Name: "data", Type: StringArg}}
+}
+
+func (a *APIFnEncrypt) Call(h *Holochain) (response interface{}, err error) {
+	response, err = h.Encrypt(a.to, a.data)
+	return
+}
+
+//------------------------------------------------------------
+// Decrypt
+
+type APIFnDecrypt struct {
+	data string
+}
+
+func (a *APIFnDecrypt) Name() string {
+	return "decrypt"
+}
+
+func (a *APIFnDecrypt) Args() []Arg {
+	return []Arg{{Name: "data", Type: StringArg}}
+}
+
+func (a *APIFnDecrypt) Call(h *Holochain) (response interface{}, err error) {
+	var data []byte
+	data, err = h.Decrypt(a.data)
+	if err != nil {
+		return
+	}
+	response = string(data)
+	return
+}
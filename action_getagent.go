@@ -0,0 +1,56 @@
+package holochain
+
+import (
+	"encoding/json"
+	. "github.com/holochain/holochain-proto/hash"
+	"reflect"
+	"time"
+)
+
+//------------------------------------------------------------
+// GetAgent
+
+type APIFnGetAgent struct {
+	agent   Hash
+	options *GetAgentOptions
+}
+
+func (fn *APIFnGetAgent) Name() string {
+	return "getAgent"
+}
+
+func (fn *APIFnGetAgent) Args() []Arg {
+	return []Arg{{Name: "agent", Type: HashArg}, {Name: "options", Type: MapArg, MapType: reflect.TypeOf(GetAgentOptions{}), Optional: true}}
+}
+
+func (fn *APIFnGetAgent) Call(h *Holochain) (response interface{}, err error) {
+	var info AgentInfo
+	info, err = h.GetAgent(fn.agent)
+	if err != nil {
+		return
+	}
+	if fn.options != nil && fn.options.Key != "" {
+		t := time.Now()
+		if fn.options.Time != "" {
+			t, err = time.Parse(time.RFC3339, fn.options.Time)
+			if err != nil {
+				return
+			}
+		}
+		valid := info.KeyValidAt(fn.options.Key, t)
+		info.KeyValid = &valid
+	}
+	response = info
+	return
+}
+
+// getAgentOptionsFromMap converts the options argument as the ribosomes get it
+func getAgentOptionsFromMap(m map[string]interface{}) (options *GetAgentOptions, err error) {
+	var j []byte
+	if j, err = json.Marshal(m); err != nil {
+		return
+	}
+	options = &GetAgentOptions{}
+	err = json.Unmarshal(j, options)
+	return
+}
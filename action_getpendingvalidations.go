@@ -0,0 +1,20 @@
+package holochain
+
+//------------------------------------------------------------
+// GetPendingValidations
+
+type APIFnGetPendingValidations struct {
+}
+
+func (a *APIFnGetPendingValidations) Name() string {
+	return "getPendingValidations"
+}
+
+func (a *APIFnGetPendingValidations) Args() []Arg {
+	return []Arg{}
+}
+
+func (a *APIFnGetPendingValidations) Call(h *Holochain) (response interface{}, err error) {
+	response, err = h.dht.GetPendingValidations()
+	return
+}
@@ -45,7 +45,7 @@ func (a *ActionLink) Receive(dht *DHT, msg *Message) (response interface{}, err
 
 		a := NewLinkAction(resp.Type, le.Links)
 		a.validationBase = t.RelatedHash
-		_, err = dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{msg.From})
+		err = dht.h.validateReceived(a, &resp.Header, a.entryType, &resp.Package, []peer.ID{msg.From})
 		//@TODO this is "one bad apple spoils the lot" because the app
 		// has no way to tell us not to link certain of the links.
 		// we need to extend the return value of the app to be able to
@@ -45,12 +45,21 @@ func (a *ActionPut) Receive(dht *DHT, msg *Message) (response interface{}, err e
 
 	err = RunValidationPhase(dht.h, msg.From, VALIDATE_PUT_REQUEST, t.EntryHash, func(resp ValidateResponse) error {
 		a := NewPutAction(resp.Type, &resp.Entry, &resp.Header)
-		_, err := dht.h.ValidateAction(a, a.entryType, &resp.Package, []peer.ID{msg.From})
+		err := dht.h.validateReceived(a, &resp.Header, a.entryType, &resp.Package, []peer.ID{msg.From})
+		if IsExecutionTimeoutErr(err) {
+			// we couldn't tell whether it's valid so leave it to be retried
+			return err
+		}
 
 		var status int
 		if err != nil {
 			dht.dlog.Logf("Put %v rejected: %v", t.EntryHash, err)
 			status = StatusRejected
+			if isWarrantableErr(err) {
+				if e := dht.h.warrantInvalidData(msg.From, &resp, err); e != nil {
+					dht.dlog.Logf("unable to issue warrant against %v: %v", msg.From, e)
+				}
+			}
 		} else {
 			status = StatusLive
 		}
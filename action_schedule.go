@@ -0,0 +1,44 @@
+package holochain
+
+//------------------------------------------------------------
+// Schedule
+
+type APIFnSchedule struct {
+	zome     string
+	function string
+	interval string
+}
+
+func (fn *APIFnSchedule) Name() string {
+	return "schedule"
+}
+
+func (fn *APIFnSchedule) Args() []Arg {
+	return []Arg{{Name: "function", Type: StringArg}, {Name: "interval", Type: StringArg}}
+}
+
+func (fn *APIFnSchedule) Call(h *Holochain) (response interface{}, err error) {
+	err = h.Schedule(fn.zome, fn.function, fn.interval)
+	return
+}
+
+//------------------------------------------------------------
+// Unschedule
+
+type APIFnUnschedule struct {
+	zome     string
+	function string
+}
+
+func (fn *APIFnUnschedule) Name() string {
+	return "unschedule"
+}
+
+func (fn *APIFnUnschedule) Args() []Arg {
+	return []Arg{{Name: "function", Type: StringArg}}
+}
+
+func (fn *APIFnUnschedule) Call(h *Holochain) (response interface{}, err error) {
+	err = h.Unschedule(fn.zome, fn.function)
+	return
+}
@@ -65,10 +65,12 @@ func (a *ActionSend) Name() string {
 func (a *ActionSend) Receive(dht *DHT, msg *Message) (response interface{}, err error) {
 	t := msg.Body.(AppMsg)
 	var r Ribosome
-	r, _, err = dht.h.MakeRibosome(t.ZomeType)
+	var z *Zome
+	r, z, err = dht.h.GetRibosome(t.ZomeType)
 	if err != nil {
 		return
 	}
+	defer dht.h.ReleaseRibosome(z, r)
 	rsp := AppMsg{ZomeType: t.ZomeType}
 	rsp.Body, err = r.Receive(peer.IDB58Encode(msg.From), t.Body)
 	if err == nil {
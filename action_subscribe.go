@@ -0,0 +1,58 @@
+package holochain
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+//------------------------------------------------------------
+// Subscribe
+
+type APIFnSubscribe struct {
+	zome     string
+	filter   SubscriptionFilter
+	callback string
+}
+
+func (fn *APIFnSubscribe) Name() string {
+	return "subscribe"
+}
+
+func (fn *APIFnSubscribe) Args() []Arg {
+	return []Arg{{Name: "filter", Type: MapArg, MapType: reflect.TypeOf(SubscriptionFilter{})}, {Name: "callback", Type: StringArg}}
+}
+
+func (fn *APIFnSubscribe) Call(h *Holochain) (response interface{}, err error) {
+	response, err = h.dht.Subscribe(fn.zome, fn.callback, fn.filter)
+	return
+}
+
+// subscriptionFilterFromMap converts the filter argument as the ribosomes get it
+func subscriptionFilterFromMap(m map[string]interface{}) (filter SubscriptionFilter, err error) {
+	var j []byte
+	if j, err = json.Marshal(m); err != nil {
+		return
+	}
+	err = json.Unmarshal(j, &filter)
+	return
+}
+
+//------------------------------------------------------------
+// Unsubscribe
+
+type APIFnUnsubscribe struct {
+	id string
+}
+
+func (fn *APIFnUnsubscribe) Name() string {
+	return "unsubscribe"
+}
+
+func (fn *APIFnUnsubscribe) Args() []Arg {
+	return []Arg{{Name: "id", Type: StringArg}}
+}
+
+func (fn *APIFnUnsubscribe) Call(h *Holochain) (response interface{}, err error) {
+	err = h.dht.Unsubscribe(fn.id)
+	return
+}
@@ -128,7 +128,7 @@ func (a *ActionMod) Receive(dht *DHT, msg *Message) (response interface{}, err e
 		a.header = &resp.Header
 
 		//@TODO what comes back from Validate Mod
-		_, err = dht.h.ValidateAction(a, resp.Type, &resp.Package, []peer.ID{msg.From})
+		err = dht.h.validateReceived(a, &resp.Header, resp.Type, &resp.Package, []peer.ID{msg.From})
 		if err != nil {
 			// how do we record an invalid Mod?
 			//@TODO store as REJECTED?
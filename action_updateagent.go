@@ -3,7 +3,6 @@ package holochain
 import (
 	"errors"
 	. "github.com/holochain/holochain-proto/hash"
-	peer "github.com/libp2p/go-libp2p-peer"
 	"reflect"
 )
 
@@ -66,7 +65,6 @@ func (fn *APIFnModAgent) Call(h *Holochain) (response interface{}, err error) {
 
 			// send the modification request for the old key
 			var oldKey, newKey Hash
-			oldPeer := h.nodeID
 			oldKey, err = NewHash(h.nodeIDStr)
 			if err != nil {
 				panic(err)
@@ -90,21 +88,10 @@ func (fn *APIFnModAgent) Call(h *Holochain) (response interface{}, err error) {
 			h.dht.Change(oldKey, MOD_REQUEST, HoldReq{RelatedHash: oldKey, EntryHash: newKey})
 
 			warrant, _ := NewSelfRevocationWarrant(revocation)
-			var data []byte
-			data, err = warrant.Encode()
+			err = h.BlockWithWarrant(warrant)
 			if err != nil {
 				return
 			}
-
-			// TODO, this isn't really a DHT send, but a management send, so the key is bogus.  have to work this out...
-			h.dht.Change(oldKey, LISTADD_REQUEST,
-				ListAddReq{
-					ListType:    BlockedList,
-					Peers:       []string{peer.IDB58Encode(oldPeer)},
-					WarrantType: SelfRevocationType,
-					Warrant:     data,
-				})
-
 		}
 
 		response = agentHash
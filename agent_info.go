@@ -0,0 +1,200 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// Agent info resolves what is known about an agent's keys: when an agent revokes its key
+// with updateAgent the old KeyEntry on the DHT is marked as replaced by the new one, so
+// following those replacements gives the agent's key history and current key.
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+var ErrKeyReplacementLoop = errors.New("key replacement loop detected")
+
+// AgentKey describes a key an agent has held
+type AgentKey struct {
+	Hash      string    // hash of the key, i.e. the agent's node ID while it held the key
+	PublicKey string    // b58 encoded public key
+	Revoked   bool      // true if the key was replaced by a later one
+	RevokedAt time.Time // when the key was revoked, zero if not or not known to this node
+	Warrant   string    `json:",omitempty"` // the marshaled self-revocation, if known to this node
+}
+
+// AgentInfo describes an agent and the keys it has held
+type AgentInfo struct {
+	Identity  AgentIdentity `json:",omitempty"` // from the agent entry asked about, or this agent's own
+	PublicKey string        // the agent's current key
+	Keys      []AgentKey    // from the key asked about to the current one
+	KeyValid  *bool         `json:",omitempty"` // result of checking a key given with GetAgentOptions
+}
+
+// GetAgentOptions asks for checking whether a key of an agent was valid at a time
+type GetAgentOptions struct {
+	Key  string // b58 encoded public key to check
+	Time string // RFC3339 time to check the key at, now if empty
+}
+
+type keyRevocation struct {
+	at      time.Time
+	warrant string
+}
+
+// KeyValidAt returns true if the key is one of the agent's and hadn't been revoked at
+// the given time.  Keys revoked at a time that isn't known are never valid.
+func (info *AgentInfo) KeyValidAt(pubKey string, t time.Time) bool {
+	for _, k := range info.Keys {
+		if k.PublicKey == pubKey {
+			return !k.Revoked || (!k.RevokedAt.IsZero() && t.Before(k.RevokedAt))
+		}
+	}
+	return false
+}
+
+// keyHashFromPubKey returns the hash a b58 encoded public key is stored under on the DHT
+func keyHashFromPubKey(b58pk string) (key Hash, err error) {
+	pubKey, err := DecodePubKey(b58pk)
+	if err != nil {
+		return
+	}
+	var id peer.ID
+	if id, err = peer.IDFromPublicKey(pubKey); err != nil {
+		return
+	}
+	key = HashFromPeerID(id)
+	return
+}
+
+// keyRevocations returns the revocations of keys this node knows about keyed by the
+// hashes of the revoked keys, from the warrants in the blocked list and our own chain.
+// Revocations only seen as warrants have no signed time so their time is left unknown.
+func (h *Holochain) keyRevocations() (revocations map[string]keyRevocation, err error) {
+	revocations = make(map[string]keyRevocation)
+	var list PeerList
+	if list, err = h.dht.getList(BlockedList); err != nil {
+		return
+	}
+	for _, r := range list.Records {
+		w, e := r.GetWarrant()
+		if e != nil {
+			continue
+		}
+		if sw, ok := w.(*SelfRevocationWarrant); ok {
+			j, e := sw.Revocation.Marshal()
+			if e != nil {
+				continue
+			}
+			revocations[HashFromPeerID(r.ID).String()] = keyRevocation{warrant: j}
+		}
+	}
+
+	// our own agent entries say exactly when we revoked our keys
+	err = h.chain.Walk(func(key *Hash, header *Header, entry Entry) error {
+		if header.Type != AgentEntryType {
+			return nil
+		}
+		a, e := AgentEntryFromJSON(entry.Content().(string))
+		if e != nil || a.Revocation == "" {
+			return nil
+		}
+		var r SelfRevocation
+		if r.Unmarshal(a.Revocation) != nil {
+			return nil
+		}
+		w := SelfRevocationWarrant{Revocation: r}
+		parties, e := w.Parties()
+		if e != nil {
+			return nil
+		}
+		revocations[parties[0].String()] = keyRevocation{at: header.Time, warrant: a.Revocation}
+		return nil
+	})
+	return
+}
+
+// GetAgent returns the identity and key history of the agent whose key or agent entry
+// hash is given, following the replacements of its keys on the DHT to the current one
+func (h *Holochain) GetAgent(agent Hash) (info AgentInfo, err error) {
+	var key Hash
+	var rsp interface{}
+	rsp, err = h.dht.Query(agent, GET_REQUEST, GetReq{H: agent, StatusMask: StatusDefault, GetMask: GetMaskEntry | GetMaskEntryType})
+	switch err {
+	case ErrHashModified:
+		// only keys get replaced
+		key = agent
+		err = nil
+	case nil:
+		resp := rsp.(GetResp)
+		switch resp.EntryType {
+		case KeyEntryType:
+			key = agent
+		case AgentEntryType:
+			var entry AgentEntry
+			if entry, err = AgentEntryFromJSON(resp.Entry.Content().(string)); err != nil {
+				return
+			}
+			info.Identity = entry.Identity
+			if key, err = keyHashFromPubKey(entry.PublicKey); err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("%v is not an agent but a %s entry", agent, resp.EntryType)
+			return
+		}
+	default:
+		return
+	}
+
+	var revocations map[string]keyRevocation
+	if revocations, err = h.keyRevocations(); err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for {
+		if seen[key.String()] {
+			err = ErrKeyReplacementLoop
+			return
+		}
+		seen[key.String()] = true
+		k := AgentKey{Hash: key.String()}
+
+		var next Hash
+		rsp, err = h.dht.Query(key, GET_REQUEST, GetReq{H: key, StatusMask: StatusDefault, GetMask: GetMaskEntry})
+		if err == ErrHashModified {
+			resp := rsp.(GetResp)
+			if next, err = NewHash(resp.FollowHash); err != nil {
+				return
+			}
+			k.Revoked = true
+			if r, ok := revocations[k.Hash]; ok {
+				k.RevokedAt = r.at
+				k.Warrant = r.warrant
+			}
+			// replaced keys are only returned when asked for explicitly
+			rsp, err = h.dht.Query(key, GET_REQUEST, GetReq{H: key, StatusMask: StatusAny, GetMask: GetMaskEntry})
+		}
+		if err != nil {
+			return
+		}
+		resp := rsp.(GetResp)
+		k.PublicKey = resp.Entry.Content().(string)
+		info.Keys = append(info.Keys, k)
+		if !k.Revoked {
+			info.PublicKey = k.PublicKey
+			break
+		}
+		key = next
+	}
+
+	if info.Identity == "" && key.Equal(HashFromPeerID(h.nodeID)) {
+		info.Identity = h.agent.Identity()
+	}
+	return
+}
@@ -0,0 +1,94 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestGetAgent(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	firstAgentHash := h.agentHash
+	firstKeyHash := HashFromPeerID(h.nodeID)
+	firstKey, _ := h.agent.EncodePubKey()
+
+	Convey("it should return the agent and its key", t, func() {
+		for _, hash := range []Hash{firstAgentHash, firstKeyHash} {
+			info, err := h.GetAgent(hash)
+			So(err, ShouldBeNil)
+			So(info.Identity, ShouldEqual, h.agent.Identity())
+			So(info.PublicKey, ShouldEqual, firstKey)
+			So(info.Keys, ShouldResemble, []AgentKey{{Hash: firstKeyHash.String(), PublicKey: firstKey}})
+		}
+	})
+
+	Convey("it should refuse entries that aren't agents", t, func() {
+		hash := commit(h, "oddNumbers", "3")
+		_, err := h.GetAgent(hash)
+		So(err.Error(), ShouldEqual, hash.String()+" is not an agent but a oddNumbers entry")
+	})
+
+	before := time.Now()
+	_, err := (&APIFnModAgent{Revocation: "lost my key"}).Call(h)
+	if err != nil {
+		panic(err)
+	}
+	newKey, _ := h.agent.EncodePubKey()
+
+	Convey("it should follow revoked keys to the current one", t, func() {
+		for _, hash := range []Hash{firstAgentHash, firstKeyHash} {
+			info, err := h.GetAgent(hash)
+			So(err, ShouldBeNil)
+			So(info.PublicKey, ShouldEqual, newKey)
+			So(len(info.Keys), ShouldEqual, 2)
+			So(info.Keys[0].Hash, ShouldEqual, firstKeyHash.String())
+			So(info.Keys[0].PublicKey, ShouldEqual, firstKey)
+			So(info.Keys[0].Revoked, ShouldBeTrue)
+			So(info.Keys[0].RevokedAt.Before(before), ShouldBeFalse)
+			So(info.Keys[0].Warrant, ShouldNotEqual, "")
+			So(info.Keys[1], ShouldResemble, AgentKey{Hash: h.nodeIDStr, PublicKey: newKey})
+
+			So(info.KeyValidAt(firstKey, before), ShouldBeTrue)
+			So(info.KeyValidAt(firstKey, time.Now()), ShouldBeFalse)
+			So(info.KeyValidAt(newKey, time.Now()), ShouldBeTrue)
+			So(info.KeyValidAt("bogus", before), ShouldBeFalse)
+		}
+	})
+
+	Convey("it should leave the time of revocations only known from warrants unknown", t, func() {
+		oldID, oldPrivKey := makePeer("peer1")
+		_, newPrivKey := makePeer("peer2")
+		revocation, _ := NewSelfRevocation(oldPrivKey, newPrivKey, []byte("extra data"))
+		w, _ := NewSelfRevocationWarrant(revocation)
+		data, _ := w.Encode()
+		list := PeerList{Type: BlockedList, Records: []PeerRecord{{ID: oldID, Warrant: encodeWarrantRecord(SelfRevocationType, data)}}}
+		So(h.dht.addToList(nil, list), ShouldBeNil)
+
+		revocations, err := h.keyRevocations()
+		So(err, ShouldBeNil)
+		r := revocations[HashFromPeerID(oldID).String()]
+		So(r.warrant, ShouldNotEqual, "")
+		So(r.at.IsZero(), ShouldBeTrue)
+		So(revocations[firstKeyHash.String()].at.Before(before), ShouldBeFalse)
+	})
+
+	Convey("getAgent should check a key's validity at a time", t, func() {
+		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType})
+		So(err, ShouldBeNil)
+		z := v.(*JSRibosome)
+		r, err := z.Run(fmt.Sprintf(`getAgent("%s",{Key:"%s",Time:"%s"}).KeyValid`, firstAgentHash.String(), firstKey, before.Format(time.RFC3339)))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, "true")
+		r, err = z.Run(fmt.Sprintf(`getAgent("%s",{Key:"%s"}).KeyValid`, firstAgentHash.String(), firstKey))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, "false")
+		r, err = z.Run(fmt.Sprintf(`getAgent("%s").PublicKey`, firstAgentHash.String()))
+		So(err, ShouldBeNil)
+		So(r.(*otto.Value).String(), ShouldEqual, newKey)
+	})
+}
@@ -46,6 +46,10 @@ func LoadAppPackage(reader io.Reader, encodingFormat string) (appPackageP *AppPa
 	if err != nil {
 		return
 	}
+	err = appPackage.DNA.checkModuleNames()
+	if err != nil {
+		return
+	}
 	appPackageP = &appPackage
 	appPackage.DNA.PropertiesSchema = `{
 	"title": "Properties Schema",
@@ -569,6 +569,9 @@ func DoTest(h *Holochain, name string, i int, fixtures TestFixtures, t TestData,
 			if actualError != nil {
 				expectedResult = testStringReplacements(expectedResult, &replacements)
 				errorString := fmt.Sprintf("\nTest: %s\n\tExpected:\t%s\n\tGot Error:\t\t%s\n", testID, expectedResult, actualError)
+				if re, ok := actualError.(*RibosomeError); ok && len(re.Stack) > 0 {
+					errorString += fmt.Sprintf("\tStack:\n%s", re.Trace())
+				}
 				err = errors.New(errorString)
 				failed.Logf(fmt.Sprintf("\n=====================\n%s\n\tfailed! m(\n=====================", errorString))
 			} else {
@@ -42,6 +42,12 @@ func (ht *BuntHT) Open(options interface{}) (err error) {
 	db.CreateIndex("peer", "peer:*", buntdb.IndexString)
 	db.CreateIndex("list", "list:*", buntdb.IndexString)
 	db.CreateIndex("entry", "entry:*", buntdb.IndexString)
+	db.CreateIndex("incompatible", "incompatible:*", buntdb.IndexString)
+	db.CreateIndex("fingerprint", "f:*", buntdb.IndexString)
+	db.CreateIndex("retry", "retry:*", buntdb.IndexString)
+	db.CreateIndex("change", "change:*", buntdb.IndexString)
+	db.CreateIndex("vcache", vcachePrefix+"*", vcacheLess)
+	db.CreateIndex("pending", "pending:*", buntdb.IndexString)
 
 	ht.db = db
 	return
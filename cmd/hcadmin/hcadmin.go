@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	holo "github.com/holochain/holochain-proto"
 	"github.com/holochain/holochain-proto/cmd"
@@ -293,6 +294,28 @@ func setupApp() (app *cli.App) {
 						h := HashFromPeerID(g.ID)
 						fmt.Printf("  %v idx: %d\n", h.String(), g.PutIdx)
 					}
+					incompatible, err := h.DHT().GetIncompatiblePeers()
+					if err != nil {
+						return err
+					}
+					if len(incompatible) > 0 {
+						fmt.Printf("Incompatible Peers:\n")
+						for _, p := range incompatible {
+							fmt.Printf("  %v version: %d rejected: %v reason: %s\n", HashFromPeerID(p.ID).String(), p.Version, p.When.Format(time.RFC3339), p.Reason)
+						}
+					}
+					for _, queue := range []string{holo.ChangeQueue, holo.RetryQueue} {
+						queued, err := h.DHT().GetQueued(queue)
+						if err != nil {
+							return err
+						}
+						if len(queued) > 0 {
+							fmt.Printf("Queued %s changes:\n", queue)
+							for _, q := range queued {
+								fmt.Printf("  %v attempts: %d next: %v\n", q.Msg.Type, q.Attempts, q.Next.Format(time.RFC3339))
+							}
+						}
+					}
 				} else {
 					return errors.New("status: expected 0 or 1 argument")
 				}
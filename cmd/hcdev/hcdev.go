@@ -749,6 +749,44 @@ func setupApp() (app *cli.App) {
 			},
 		},
 
+		{
+			Name:      "repl",
+			ArgsUsage: "[zome]",
+			Usage:     "evaluate zome code interactively against a running chain",
+			Action: func(c *cli.Context) error {
+				if err := appCheck(devPath); err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+
+				h, err := getHolochain(c, service, agentID)
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				h.Close()
+				h, err = service.GenChain(name)
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				defer h.Close()
+
+				err = h.Activate()
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				h.StartBackgroundTasks()
+
+				repl, err := holo.NewREPL(h, c.Args().First())
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				err = repl.Run(os.Stdin, os.Stdout)
+				if err != nil {
+					return cmd.MakeErrFromErr(c, err)
+				}
+				return nil
+			},
+		},
+
 		{
 			Name:      "package",
 			Aliases:   []string{"p"},
@@ -0,0 +1,276 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// connmgr implements a connection manager that keeps the number of open peer connections
+// between a low and high watermark by pruning the least useful connections
+
+package holochain
+
+import (
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultConnMgrHighWater   = 200
+	DefaultConnMgrLowWater    = 150
+	DefaultConnMgrGracePeriod = time.Second * 20
+
+	// how long after gossiping with a peer we keep its connection protected
+	ConnMgrGossipProtectPeriod = time.Minute * 5
+
+	// reputation bounds, so a single peer can't accumulate unbounded credit or debt
+	ConnMgrMaxReputation = 100
+	ConnMgrMinReputation = -100
+)
+
+// connInfo holds what the connection manager knows about a connected peer
+type connInfo struct {
+	connected  time.Time
+	lastActive time.Time
+	lastGossip time.Time
+	reputation int
+	tags       map[string]bool
+}
+
+// ConnManager tracks connected peers and prunes the least useful ones when there are
+// more connections than the high watermark, down to the low watermark.  Usefulness is
+// judged by XOR closeness to us, reputation (successful vs failed exchanges) and idleness.
+// Gossip partners, peers in our neighbourhood and explicitly protected peers are never pruned.
+type ConnManager struct {
+	node *Node
+
+	highWater   int
+	lowWater    int
+	gracePeriod time.Duration
+
+	// number of closest peers that make up our neighbourhood
+	neighbourhoodSize int
+
+	lk       sync.Mutex
+	peers    map[peer.ID]*connInfo
+	trimming bool
+
+	// PeerPruned is called for each peer that gets pruned
+	PeerPruned func(peer.ID)
+}
+
+// NewConnManager creates a connection manager for a node, a highWater of 0 disables pruning
+func NewConnManager(node *Node, lowWater int, highWater int, gracePeriod time.Duration) *ConnManager {
+	return &ConnManager{
+		node:              node,
+		highWater:         highWater,
+		lowWater:          lowWater,
+		gracePeriod:       gracePeriod,
+		neighbourhoodSize: KValue,
+		peers:             make(map[peer.ID]*connInfo),
+		PeerPruned:        func(peer.ID) {},
+	}
+}
+
+// SetWatermarks changes the connection limits, a highWater of 0 disables pruning
+func (cm *ConnManager) SetWatermarks(lowWater int, highWater int) {
+	cm.lk.Lock()
+	cm.lowWater = lowWater
+	cm.highWater = highWater
+	cm.lk.Unlock()
+}
+
+// SetNeighbourhoodSize sets the number of closest peers that are protected from pruning
+func (cm *ConnManager) SetNeighbourhoodSize(size int) {
+	cm.lk.Lock()
+	cm.neighbourhoodSize = size
+	cm.lk.Unlock()
+}
+
+// Len returns the number of connected peers being tracked
+func (cm *ConnManager) Len() int {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	return len(cm.peers)
+}
+
+func (cm *ConnManager) getInfo(p peer.ID) *connInfo {
+	info, ok := cm.peers[p]
+	if !ok {
+		now := time.Now()
+		info = &connInfo{connected: now, lastActive: now, tags: make(map[string]bool)}
+		cm.peers[p] = info
+	}
+	return info
+}
+
+// Connected registers a new connection to a peer and triggers a trim if we are
+// above the high watermark
+func (cm *ConnManager) Connected(p peer.ID) {
+	cm.lk.Lock()
+	cm.getInfo(p)
+	trim := cm.highWater > 0 && len(cm.peers) > cm.highWater && !cm.trimming
+	if trim {
+		cm.trimming = true
+	}
+	cm.lk.Unlock()
+	if trim {
+		go func() {
+			cm.TrimOpenConns()
+			cm.lk.Lock()
+			cm.trimming = false
+			cm.lk.Unlock()
+		}()
+	}
+}
+
+// Disconnected stops tracking a peer
+func (cm *ConnManager) Disconnected(p peer.ID) {
+	cm.lk.Lock()
+	delete(cm.peers, p)
+	cm.lk.Unlock()
+}
+
+// Active records a successful exchange with a peer
+func (cm *ConnManager) Active(p peer.ID) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	info, ok := cm.peers[p]
+	if !ok {
+		return
+	}
+	info.lastActive = time.Now()
+	if info.reputation < ConnMgrMaxReputation {
+		info.reputation++
+	}
+}
+
+// Failed records a failed exchange with a peer
+func (cm *ConnManager) Failed(p peer.ID) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	info, ok := cm.peers[p]
+	if !ok {
+		return
+	}
+	if info.reputation > ConnMgrMinReputation {
+		info.reputation--
+	}
+}
+
+// GossipedWith marks a peer as a current gossip partner which protects it from pruning
+func (cm *ConnManager) GossipedWith(p peer.ID) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	info, ok := cm.peers[p]
+	if !ok {
+		return
+	}
+	info.lastGossip = time.Now()
+}
+
+// Protect prevents a peer from being pruned until Unprotect is called with the same tag
+func (cm *ConnManager) Protect(p peer.ID, tag string) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	cm.getInfo(p).tags[tag] = true
+}
+
+// Unprotect removes a protection tag from a peer
+func (cm *ConnManager) Unprotect(p peer.ID, tag string) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	if info, ok := cm.peers[p]; ok {
+		delete(info.tags, tag)
+	}
+}
+
+// Reputation returns the current reputation of a connected peer
+func (cm *ConnManager) Reputation(p peer.ID) int {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+	if info, ok := cm.peers[p]; ok {
+		return info.reputation
+	}
+	return 0
+}
+
+// usefulness scores a peer, higher is more useful. Each bit of shared prefix
+// with our own address counts as much as one successful exchange, and every
+// minute of idleness counts as one failed exchange.
+func (cm *ConnManager) usefulness(p peer.ID, info *connInfo, now time.Time) int {
+	cpl := commonPrefixLen(p, cm.node.HashAddr)
+	idle := int(now.Sub(info.lastActive) / time.Minute)
+	return cpl + info.reputation - idle
+}
+
+// pruneCandidates returns the connected peers that may be pruned ordered from
+// least to most useful, along with the number of peers we need to drop
+func (cm *ConnManager) pruneCandidates() (candidates []peer.ID, count int) {
+	cm.lk.Lock()
+	defer cm.lk.Unlock()
+
+	if cm.highWater <= 0 || len(cm.peers) <= cm.lowWater {
+		return
+	}
+	count = len(cm.peers) - cm.lowWater
+
+	now := time.Now()
+	var connected []peer.ID
+	for p := range cm.peers {
+		connected = append(connected, p)
+	}
+
+	// our neighbourhood are the closest peers to us, which we must hold on to
+	neighbourhood := make(map[peer.ID]bool)
+	closest := SortClosestPeers(connected, HashFromPeerID(cm.node.HashAddr))
+	for i := 0; i < cm.neighbourhoodSize && i < len(closest); i++ {
+		neighbourhood[closest[i]] = true
+	}
+
+	scores := make(map[peer.ID]int)
+	for p, info := range cm.peers {
+		switch {
+		case len(info.tags) > 0:
+		case neighbourhood[p]:
+		case now.Sub(info.connected) < cm.gracePeriod:
+		case now.Sub(info.lastGossip) < ConnMgrGossipProtectPeriod:
+		default:
+			candidates = append(candidates, p)
+			scores[p] = cm.usefulness(p, info, now)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if scores[candidates[i]] != scores[candidates[j]] {
+			return scores[candidates[i]] < scores[candidates[j]]
+		}
+		// farther peers go first
+		return cm.node.Distance(candidates[i]).Cmp(cm.node.Distance(candidates[j])) > 0
+	})
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+	return
+}
+
+// TrimOpenConns closes the least useful connections until we are at the low watermark
+func (cm *ConnManager) TrimOpenConns() (pruned []peer.ID) {
+	candidates, count := cm.pruneCandidates()
+	if count == 0 {
+		return
+	}
+	node := cm.node
+	node.log.Logf("connmgr: pruning %d of %d connections", count, cm.Len())
+	for _, p := range candidates[:count] {
+		node.log.Logf("connmgr: pruning connection to %v", p)
+		node.routingTable.Remove(p)
+		err := node.host.Network().ClosePeer(p)
+		if err != nil {
+			node.log.Logf("connmgr: error closing connection to %v: %v", p, err)
+		}
+		cm.Disconnected(p)
+		cm.PeerPruned(p)
+		pruned = append(pruned, p)
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestConnManagerTracking(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	cm := node.ConnManager()
+	p, _ := makePeer("peer_1")
+
+	Convey("it should track connected peers", t, func() {
+		So(cm.Len(), ShouldEqual, 0)
+		cm.Connected(p)
+		So(cm.Len(), ShouldEqual, 1)
+	})
+
+	Convey("it should adjust reputation on success and failure", t, func() {
+		cm.Active(p)
+		cm.Active(p)
+		So(cm.Reputation(p), ShouldEqual, 2)
+		cm.Failed(p)
+		So(cm.Reputation(p), ShouldEqual, 1)
+	})
+
+	Convey("it should keep reputation within bounds", t, func() {
+		for i := 0; i < ConnMgrMaxReputation*3; i++ {
+			cm.Failed(p)
+		}
+		So(cm.Reputation(p), ShouldEqual, ConnMgrMinReputation)
+	})
+
+	Convey("it should forget disconnected peers", t, func() {
+		cm.Disconnected(p)
+		So(cm.Len(), ShouldEqual, 0)
+		So(cm.Reputation(p), ShouldEqual, 0)
+	})
+}
+
+func TestConnManagerTrim(t *testing.T) {
+	node, err := makeNode(1234, "node1")
+	if err != nil {
+		panic(err)
+	}
+	defer node.Close()
+	cm := NewConnManager(node, 5, 0, 0)
+	cm.SetNeighbourhoodSize(2)
+
+	var peers []peer.ID
+	for i := 0; i < 10; i++ {
+		p, _ := makePeer(fmt.Sprintf("peer_%d", i))
+		peers = append(peers, p)
+		cm.Connected(p)
+	}
+
+	Convey("it should not prune when disabled", t, func() {
+		So(len(cm.TrimOpenConns()), ShouldEqual, 0)
+		So(cm.Len(), ShouldEqual, 10)
+	})
+
+	Convey("it should never choose protected peers, gossip partners or the neighbourhood", t, func() {
+		cm.SetWatermarks(5, 8)
+		cm.Protect(peers[0], "test")
+		cm.GossipedWith(peers[1])
+		candidates, count := cm.pruneCandidates()
+		So(count, ShouldEqual, 5)
+
+		closest := SortClosestPeers(peers, HashFromPeerID(node.HashAddr))
+		excluded := map[peer.ID]bool{peers[0]: true, peers[1]: true, closest[0]: true, closest[1]: true}
+		So(len(candidates), ShouldEqual, len(peers)-len(excluded))
+		for p := range excluded {
+			So(candidates, ShouldNotContain, p)
+		}
+	})
+
+	Convey("it should choose peers with bad reputation first", t, func() {
+		candidates, _ := cm.pruneCandidates()
+		last := candidates[len(candidates)-1]
+		for i := 0; i < 50; i++ {
+			cm.Failed(last)
+		}
+		candidates, _ = cm.pruneCandidates()
+		So(candidates[0], ShouldEqual, last)
+	})
+
+	Convey("it should not prune peers within the grace period", t, func() {
+		gcm := NewConnManager(node, 1, 2, time.Hour)
+		for _, p := range peers {
+			gcm.Connected(p)
+		}
+		candidates, count := gcm.pruneCandidates()
+		So(len(candidates), ShouldEqual, 0)
+		So(count, ShouldEqual, 0)
+	})
+
+	Convey("it should trim down to the low watermark", t, func() {
+		var pruned []peer.ID
+		cm.PeerPruned = func(p peer.ID) { pruned = append(pruned, p) }
+		So(len(cm.TrimOpenConns()), ShouldEqual, 5)
+		So(cm.Len(), ShouldEqual, 5)
+		So(len(pruned), ShouldEqual, 5)
+		So(len(cm.TrimOpenConns()), ShouldEqual, 0)
+	})
+}
@@ -28,11 +28,13 @@ type DHTConfig struct {
 	//RedundancyFactor(integer) Establishes minimum online redundancy targets for data, and size of peer sets for sync gossip. A redundancy factor ZERO means no sharding (every node syncs all data with every other node). ONE means you are running this as a centralized application and gossip is turned OFF. For most applications we recommend neighborhoods no smaller than 8 for nearness or 32 for hashmask sharding.
 	RedundancyFactor int
 
-	// ShardingMethod : Identifier for sharding method (none, XOR, hashmask, other nearness algorithms?, etc.)
+	// ShardingMethod : Identifier for sharding method (none, XOR, hashmask). Defaults to XOR when there is a RedundancyFactor above ONE, and is ignored otherwise.
+	ShardingMethod ShardingMethod
 
 	// MaxLinkSets : (integer) Maximum number of results to return on a GetLinks query to keep computation and traffic to a reasonable size. You need to break these result sets into multiple "pages" of results retrieve more.
 
-	// ValidationTimeout : (integer) Time period in seconds, until data that needs to be validated against a source remains "alive" to keep trying to get validation from that source. If someone commits something and then goes offline, how long do they have to come back online before DHT sync requests consider that data invalid?
+	// ValidationTimeout : (integer) Time period in seconds, until data that needs to be validated against a source remains "alive" to keep trying to get validation from that source. If someone commits something and then goes offline, how long do they have to come back online before DHT sync requests consider that data invalid? Defaults to one day.
+	ValidationTimeout int
 
 	//PeerTimeout : (integer) Time period in seconds, until a node drops a peer from its neighborhood list for failing to respond to gossip requests.
 
@@ -53,7 +55,6 @@ type Channel chan interface{}
 type DHT struct {
 	h           *Holochain // pointer to the holochain this DHT is part of
 	ht          HashTable
-	retryQueue  chan *retry
 	changeQueue Channel
 	gossipPuts  Channel
 	glog        *Logger // the gossip logger
@@ -61,21 +62,26 @@ type DHT struct {
 	gchan       Channel
 	config      *DHTConfig
 	glk         sync.RWMutex
+	gbudget     *gossipBudget
+	vcache      *validationCache
+	vpool       *validationPool
+	events      Channel // events for subscriptions waiting to be delivered
+	subs        *dhtSubscriptions
+	chlk        sync.RWMutex // held to send without blocking on the channels, or to close them
+	closed      bool
 	//	sources      map[peer.ID]bool
 	//	fingerprints map[string]bool
 }
 
 type changeReq struct {
-	key Hash
-	msg Message
-}
-
-type retry struct {
-	msg     Message
-	retries int
+	key      Hash
+	msg      Message
+	attempts int
 }
 
 const (
+	// MaxRetries is how many times a received change whose related hash we
+	// don't have is retried before it's dropped
 	MaxRetries = 10
 )
 
@@ -168,7 +174,6 @@ func (dht *DHT) Open(options interface{}) (err error) {
 
 	dht.ht = &BuntHT{}
 	dht.ht.Open(filepath.Join(h.DBPath(), DHTStoreFileName))
-	dht.retryQueue = make(chan *retry, 100)
 	dht.changeQueue = make(Channel, 100)
 	//go dht.HandleChangeRequests()
 
@@ -176,6 +181,11 @@ func (dht *DHT) Open(options interface{}) (err error) {
 	//	dht.fingerprints = make(map[string]bool)
 	dht.gchan = make(Channel, GossipWithQueueSize)
 	dht.gossipPuts = make(Channel, GossipPutQueueSize)
+	dht.gbudget = newGossipBudget()
+	dht.vcache = &validationCache{}
+	dht.vpool = newValidationPool()
+	dht.events = make(Channel, DHTEventQueueSize)
+	dht.subs = newDHTSubscriptions()
 	return
 }
 
@@ -247,6 +257,9 @@ func (dht *DHT) SetupDHT() (err error) {
 func (dht *DHT) Put(m *Message, entryType string, key Hash, src peer.ID, value []byte, status int) (err error) {
 	dht.dlog.Logf("put %v=>%s", key, string(value))
 	err = dht.ht.Put(m, entryType, key, src, value, status)
+	if err == nil {
+		dht.notify(DHTEvent{Type: DHTEventPut, Hash: key.String(), EntryType: entryType})
+	}
 	return
 }
 
@@ -255,6 +268,9 @@ func (dht *DHT) Put(m *Message, entryType string, key Hash, src peer.ID, value [
 func (dht *DHT) Del(m *Message, key Hash) (err error) {
 	dht.dlog.Logf("del %v", key)
 	err = dht.ht.Del(m, key)
+	if err == nil {
+		dht.notify(DHTEvent{Type: DHTEventDel, Hash: key.String()})
+	}
 	return
 }
 
@@ -263,6 +279,9 @@ func (dht *DHT) Del(m *Message, key Hash) (err error) {
 func (dht *DHT) Mod(m *Message, key Hash, newkey Hash) (err error) {
 	dht.dlog.Logf("mod %v", key)
 	err = dht.ht.Mod(m, key, newkey)
+	if err == nil {
+		dht.notify(DHTEvent{Type: DHTEventMod, Hash: key.String(), NewHash: newkey.String()})
+	}
 	return
 }
 
@@ -290,6 +309,9 @@ func (dht *DHT) Get(key Hash, statusMask int, getMask int) (data []byte, entryTy
 func (dht *DHT) PutLink(m *Message, base string, link string, tag string) (err error) {
 	dht.dlog.Logf("putLink on %v link %v as %s", base, link, tag)
 	err = dht.ht.PutLink(m, base, link, tag)
+	if err == nil {
+		dht.notify(DHTEvent{Type: DHTEventLink, Hash: link, Base: base, Tag: tag})
+	}
 	return
 }
 
@@ -298,6 +320,9 @@ func (dht *DHT) PutLink(m *Message, base string, link string, tag string) (err e
 func (dht *DHT) DelLink(m *Message, base string, link string, tag string) (err error) {
 	dht.dlog.Logf("delLink on %v link %v as %s", base, link, tag)
 	err = dht.ht.DelLink(m, base, link, tag)
+	if err == nil {
+		dht.notify(DHTEvent{Type: DHTEventDelLink, Hash: link, Base: base, Tag: tag})
+	}
 	return
 }
 
@@ -360,11 +385,24 @@ func (dht *DHT) change(req changeReq) (err error) {
 	key := req.key
 	msg := &req.msg
 	node := dht.h.node
+	var held []peer.ID
+	defer func() {
+		// keep the change queued until someone accepts it
+		var e error
+		if len(held) > 0 {
+			e = dht.dequeue(&QueuedChange{Queue: ChangeQueue, Msg: *msg})
+		} else {
+			dht.dlog.Logf("change %v not accepted by any remote node, will retry", msg.Type)
+			e = dht.queueChange(req, req.attempts+1)
+		}
+		if e != nil {
+			dht.dlog.Logf("error updating change queue: %v", e)
+		}
+	}()
 	pchan, err := node.GetClosestPeers(node.ctx, key)
 	if err != nil {
 		return err
 	}
-	var held []peer.ID
 	wg := sync.WaitGroup{}
 	for p := range pchan {
 		if p == node.HashAddr {
@@ -407,7 +445,13 @@ func (dht *DHT) Change(key Hash, msgType MsgType, body interface{}) (err error)
 		dht.dlog.Logf("DHT send of %v to self failed with error: %s", msgType, err)
 		err = nil
 	}*/
-	dht.changeQueue <- changeReq{msg: *msg, key: key}
+	req := changeReq{msg: *msg, key: key}
+	// persist the change first so it isn't lost if we go offline or shut down
+	err = dht.queueChange(req, 0)
+	if err != nil {
+		return
+	}
+	dht.changeQueue <- req
 
 	return
 }
@@ -440,8 +484,8 @@ func (dht *DHT) Query(key Hash, msgType MsgType, body interface{}) (response int
 		return nil, ErrHashNotFound
 	}
 
-	// setup the Query
-	query := dht.h.node.newQuery(key, func(ctx context.Context, to peer.ID) (*dhtQueryResult, error) {
+	// setup the Query, preferring faster peers when several are equally close
+	query := dht.h.node.newLatencyQuery(key, func(ctx context.Context, to peer.ID) (*dhtQueryResult, error) {
 
 		response, err := dht.send(ctx, to, msg)
 		if err != nil {
@@ -527,16 +571,37 @@ func (dht *DHT) JSON() (result string, err error) {
 	return
 }
 
+// trySend sends v on a channel of the DHT without blocking, returning false if the
+// channel is full or the DHT has been closed
+func (dht *DHT) trySend(ch *Channel, v interface{}) (sent bool) {
+	dht.chlk.RLock()
+	defer dht.chlk.RUnlock()
+	if dht.closed {
+		return
+	}
+	select {
+	case *ch <- v:
+		sent = true
+	default:
+	}
+	return
+}
+
 // Close cleans up the DHT
 func (dht *DHT) Close() {
+	dht.chlk.Lock()
+	dht.closed = true
 	close(dht.changeQueue)
 	dht.changeQueue = nil
-	close(dht.retryQueue)
-	dht.retryQueue = nil
 	close(dht.gchan)
 	dht.gchan = nil
 	close(dht.gossipPuts)
 	dht.gossipPuts = nil
+	dht.chlk.Unlock()
+	dht.subs.closeListeners()
+	close(dht.events)
+	dht.events = nil
+	dht.vpool.stop()
 	dht.ht.Close()
 }
 
@@ -552,20 +617,6 @@ func (dht *DHT) GetIdxMessage(idx int) (msg Message, err error) {
 	return
 }
 
-// RetryTask checks to see if there are any received puts that need retrying and does one if so
-func RetryTask(h *Holochain) {
-	dht := h.dht
-	if dht != nil && len(dht.retryQueue) > 0 {
-		r := <-dht.retryQueue
-		if r.retries > 0 {
-			resp, err := actionReceiver(dht.h, &r.msg, r.retries-1)
-			dht.dlog.Logf("retry %d of %v, response: %d error: %v", r.retries, r.msg, resp, err)
-		} else {
-			dht.dlog.Logf("max retries for %v, ignoring", r.msg)
-		}
-	}
-}
-
 // MakeReceiptData converts a message and a code into signable data
 func MakeReceiptData(msg *Message, code int) (reciept []byte, err error) {
 	var data []byte
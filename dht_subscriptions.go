@@ -0,0 +1,249 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// DHT subscriptions let zomes be told of changes the local DHT receives rather than
+// polling for them.  A zome subscribes to a base (optionally a link tag) or an entry type,
+// and each matching put, link, mod or delete is delivered to the zome's callback and to
+// UI clients listening for events.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	. "github.com/holochain/holochain-proto/hash"
+)
+
+const (
+	DHTEventPut     = "put"
+	DHTEventLink    = "link"
+	DHTEventDelLink = "delLink"
+	DHTEventMod     = "mod"
+	DHTEventDel     = "del"
+
+	// DHTEventQueueSize is how many events can wait to be delivered to zome callbacks
+	// before further events are dropped
+	DHTEventQueueSize = 1000
+
+	// DHTEventListenerQueueSize is how many events can wait to be read by a listener
+	// before further events to it are dropped
+	DHTEventListenerQueueSize = 100
+)
+
+var ErrSubscriptionFilterEmpty = errors.New("subscription needs a Base or an EntryType")
+var ErrUnknownSubscription = errors.New("unknown subscription")
+
+// SubscriptionFilter selects the DHT changes a subscription is for
+type SubscriptionFilter struct {
+	Base      string // links on, and mods and deletes of, this hash
+	Tag       string // only links with this tag, if Base is set
+	EntryType string // puts, mods and deletes of entries of this type
+}
+
+// Subscription holds which zome callback to call for changes matching the filter
+type Subscription struct {
+	ID       string
+	Zome     string
+	Callback string
+	Filter   SubscriptionFilter
+}
+
+// DHTEvent describes a change the local DHT received
+type DHTEvent struct {
+	Subscription string // ID of the subscription the event matched, the first one for listeners
+	Type         string
+	Hash         string // the entry put, modified or deleted, or the link's target
+	EntryType    string `json:",omitempty"`
+	Base         string `json:",omitempty"` // base of links
+	Tag          string `json:",omitempty"` // tag of links
+	NewHash      string `json:",omitempty"` // the entry replacing a modified one
+}
+
+type dhtEventDelivery struct {
+	sub   Subscription
+	event DHTEvent
+}
+
+// dhtSubscriptions holds the subscriptions of the zomes and the channels of event listeners
+type dhtSubscriptions struct {
+	lk        sync.RWMutex
+	next      int
+	subs      map[string]*Subscription
+	listeners map[chan DHTEvent]bool
+	closed    bool // set when the DHT closes, after which no events are sent
+}
+
+func newDHTSubscriptions() *dhtSubscriptions {
+	return &dhtSubscriptions{
+		subs:      make(map[string]*Subscription),
+		listeners: make(map[chan DHTEvent]bool),
+	}
+}
+
+// matches returns true if the event is one the filter selects
+func (f *SubscriptionFilter) matches(event *DHTEvent) bool {
+	switch event.Type {
+	case DHTEventLink, DHTEventDelLink:
+		return f.Base != "" && f.Base == event.Base && (f.Tag == "" || f.Tag == event.Tag)
+	case DHTEventMod, DHTEventDel:
+		if f.Base != "" && f.Base == event.Hash {
+			return true
+		}
+	}
+	return f.EntryType != "" && f.EntryType == event.EntryType
+}
+
+// Subscribe registers the callback of a zome to be called with changes matching the filter
+func (dht *DHT) Subscribe(zome string, callback string, filter SubscriptionFilter) (id string, err error) {
+	if filter.Base == "" && filter.EntryType == "" {
+		err = ErrSubscriptionFilterEmpty
+		return
+	}
+	if callback == "" {
+		err = errors.New("subscription needs a callback")
+		return
+	}
+	s := dht.subs
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.next++
+	id = fmt.Sprintf("%d", s.next)
+	s.subs[id] = &Subscription{ID: id, Zome: zome, Callback: callback, Filter: filter}
+	dht.dlog.Logf("%s subscribed %s with %s to %v", zome, id, callback, filter)
+	return
+}
+
+// Unsubscribe removes a subscription
+func (dht *DHT) Unsubscribe(id string) (err error) {
+	s := dht.subs
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if _, ok := s.subs[id]; !ok {
+		err = ErrUnknownSubscription
+		return
+	}
+	delete(s.subs, id)
+	return
+}
+
+// Subscriptions returns the current subscriptions
+func (dht *DHT) Subscriptions() (subs []Subscription) {
+	s := dht.subs
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	for _, sub := range s.subs {
+		subs = append(subs, *sub)
+	}
+	return
+}
+
+// AddDHTEventListener returns a channel getting the events matching any subscription and
+// a function to stop getting them.  Events are dropped for listeners that fall behind.
+func (dht *DHT) AddDHTEventListener() (events <-chan DHTEvent, remove func()) {
+	c := make(chan DHTEvent, DHTEventListenerQueueSize)
+	s := dht.subs
+	s.lk.Lock()
+	if s.closed {
+		close(c)
+	} else {
+		s.listeners[c] = true
+	}
+	s.lk.Unlock()
+	events = c
+	remove = func() {
+		s.lk.Lock()
+		defer s.lk.Unlock()
+		if s.listeners[c] {
+			delete(s.listeners, c)
+			close(c)
+		}
+	}
+	return
+}
+
+// notify queues the delivery of an event to the subscriptions it matches
+func (dht *DHT) notify(event DHTEvent) {
+	s := dht.subs
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	if s.closed || len(s.subs) == 0 {
+		return
+	}
+	if event.EntryType == "" && (event.Type == DHTEventMod || event.Type == DHTEventDel) {
+		if key, err := NewHash(event.Hash); err == nil {
+			_, event.EntryType, _, _, _ = dht.ht.Get(key, StatusAny, GetMaskEntryType)
+		}
+	}
+	var first *Subscription
+	for _, sub := range s.subs {
+		if !sub.Filter.matches(&event) {
+			continue
+		}
+		e := event
+		e.Subscription = sub.ID
+		select {
+		case dht.events <- dhtEventDelivery{sub: *sub, event: e}:
+		default:
+			dht.dlog.Logf("event queue full, dropping %v for %s", e, sub.ID)
+		}
+		if first == nil || subscriptionBefore(sub.ID, first.ID) {
+			first = sub
+		}
+	}
+	if first == nil {
+		return
+	}
+	// listeners get each event once however many subscriptions it matched
+	event.Subscription = first.ID
+	for c := range s.listeners {
+		select {
+		case c <- event:
+		default:
+		}
+	}
+}
+
+// subscriptionBefore returns true if subscription a was made before b
+func subscriptionBefore(a string, b string) bool {
+	i, _ := strconv.Atoi(a)
+	j, _ := strconv.Atoi(b)
+	return i < j
+}
+
+// HandleDHTEvents waits on a channel for events to deliver to zome callbacks
+func (dht *DHT) HandleDHTEvents() (err error) {
+	err = dht.handleTillDone("HandleDHTEvents", dht.events, handleDHTEvent)
+	return
+}
+
+func handleDHTEvent(dht *DHT, x interface{}) (err error) {
+	d := x.(dhtEventDelivery)
+	var body []byte
+	body, err = json.Marshal(d.event)
+	if err != nil {
+		return
+	}
+	r, z, err := dht.h.GetRibosome(d.sub.Zome)
+	if err != nil {
+		return
+	}
+	defer dht.h.ReleaseRibosome(z, r)
+	_, err = r.RunAsyncSendResponse(AppMsg{ZomeType: d.sub.Zome, Body: string(body)}, d.sub.Callback, d.sub.ID)
+	return
+}
+
+// closeListeners ends the channels of all event listeners and stops events being sent,
+// so it must be called before the DHT's event queue is closed
+func (s *dhtSubscriptions) closeListeners() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.closed = true
+	for c := range s.listeners {
+		close(c)
+	}
+	s.listeners = make(map[chan DHTEvent]bool)
+}
@@ -0,0 +1,127 @@
+package holochain
+
+import (
+	"fmt"
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestSubscriptionFilter(t *testing.T) {
+	Convey("it should match events by base, tag and entry type", t, func() {
+		f := SubscriptionFilter{Base: "QmBase", Tag: "comment"}
+		So(f.matches(&DHTEvent{Type: DHTEventLink, Base: "QmBase", Tag: "comment"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventDelLink, Base: "QmBase", Tag: "comment"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventLink, Base: "QmBase", Tag: "like"}), ShouldBeFalse)
+		So(f.matches(&DHTEvent{Type: DHTEventLink, Base: "QmOther", Tag: "comment"}), ShouldBeFalse)
+		So(f.matches(&DHTEvent{Type: DHTEventMod, Hash: "QmBase"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventDel, Hash: "QmBase"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventPut, Hash: "QmBase"}), ShouldBeFalse)
+
+		f = SubscriptionFilter{EntryType: "post"}
+		So(f.matches(&DHTEvent{Type: DHTEventPut, EntryType: "post"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventDel, EntryType: "post"}), ShouldBeTrue)
+		So(f.matches(&DHTEvent{Type: DHTEventPut, EntryType: "comment"}), ShouldBeFalse)
+		So(f.matches(&DHTEvent{Type: DHTEventLink, Base: "QmBase"}), ShouldBeFalse)
+	})
+}
+
+func TestDHTSubscriptions(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should refuse subscriptions to nothing", t, func() {
+		_, err := h.dht.Subscribe("jsSampleZome", "onEvent", SubscriptionFilter{Tag: "comment"})
+		So(err, ShouldEqual, ErrSubscriptionFilterEmpty)
+		So(h.dht.Unsubscribe("bogus"), ShouldEqual, ErrUnknownSubscription)
+	})
+
+	var zome *Zome
+	for i := range h.nucleus.dna.Zomes {
+		if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" {
+			zome = &h.nucleus.dna.Zomes[i]
+		}
+	}
+	code := zome.Code
+	zome.Code += `
+function onEvent(event, id) {debug("event "+id+":"+event.Type+":"+event.EntryType+":"+event.Hash)}`
+	defer func() { zome.Code = code }()
+
+	e := GobEntry{C: "some profile"}
+	hash, _ := e.Sum(h.hashSpec)
+
+	Convey("it should call the zome's callback and listeners with matching changes", t, func() {
+		r, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		defer h.ReleaseRibosome(z, r)
+		v, err := r.Run(`subscribe({EntryType:"profile"},"onEvent")`)
+		So(err, ShouldBeNil)
+		id := v.(*otto.Value).String()
+		So(h.dht.Subscriptions(), ShouldResemble, []Subscription{{ID: id, Zome: "jsSampleZome", Callback: "onEvent", Filter: SubscriptionFilter{EntryType: "profile"}}})
+
+		events, remove := h.dht.AddDHTEventListener()
+		defer remove()
+
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash})
+		err = h.dht.Put(m, "profile", hash, h.nodeID, []byte("some profile"), StatusLive)
+		So(err, ShouldBeNil)
+
+		event := <-events
+		So(event, ShouldResemble, DHTEvent{Subscription: id, Type: DHTEventPut, Hash: hash.String(), EntryType: "profile"})
+
+		ShouldLog(&h.Config.Loggers.App, func() {
+			err = handleDHTEvent(h.dht, <-h.dht.events)
+			So(err, ShouldBeNil)
+		}, fmt.Sprintf("event %s:put:profile:%s", id, hash.String()))
+
+		_, err = r.Run(`unsubscribe("` + id + `")`)
+		So(err, ShouldBeNil)
+		So(len(h.dht.Subscriptions()), ShouldEqual, 0)
+
+		err = h.dht.Put(m, "profile", hash, h.nodeID, []byte("some profile"), StatusLive)
+		So(err, ShouldBeNil)
+		So(len(h.dht.events), ShouldEqual, 0)
+	})
+
+	Convey("it should deliver link changes on a base", t, func() {
+		id, err := h.dht.Subscribe("jsSampleZome", "onEvent", SubscriptionFilter{Base: hash.String(), Tag: "comment"})
+		So(err, ShouldBeNil)
+		m := h.node.NewMessage(LINK_REQUEST, HoldReq{RelatedHash: hash, EntryHash: hash})
+		err = h.dht.PutLink(m, hash.String(), h.nodeIDStr, "comment")
+		So(err, ShouldBeNil)
+		d := (<-h.dht.events).(dhtEventDelivery)
+		So(d.event, ShouldResemble, DHTEvent{Subscription: id, Type: DHTEventLink, Hash: h.nodeIDStr, Base: hash.String(), Tag: "comment"})
+		So(h.dht.Unsubscribe(id), ShouldBeNil)
+	})
+
+	Convey("it should send listeners an event once however many subscriptions it matches", t, func() {
+		id1, err := h.dht.Subscribe("jsSampleZome", "onEvent", SubscriptionFilter{EntryType: "profile"})
+		So(err, ShouldBeNil)
+		id2, err := h.dht.Subscribe("jsSampleZome", "onEvent", SubscriptionFilter{Base: hash.String()})
+		So(err, ShouldBeNil)
+		events, remove := h.dht.AddDHTEventListener()
+		defer remove()
+
+		h.dht.notify(DHTEvent{Type: DHTEventDel, Hash: hash.String(), EntryType: "profile"})
+		So(len(h.dht.events), ShouldEqual, 2)
+		<-h.dht.events
+		<-h.dht.events
+		So(len(events), ShouldEqual, 1)
+		So(<-events, ShouldResemble, DHTEvent{Subscription: id1, Type: DHTEventDel, Hash: hash.String(), EntryType: "profile"})
+
+		So(h.dht.Unsubscribe(id1), ShouldBeNil)
+		So(h.dht.Unsubscribe(id2), ShouldBeNil)
+	})
+
+	Convey("it should stop sending events once the listeners are closed", t, func() {
+		id, err := h.dht.Subscribe("jsSampleZome", "onEvent", SubscriptionFilter{EntryType: "profile"})
+		So(err, ShouldBeNil)
+		h.dht.subs.closeListeners()
+		h.dht.notify(DHTEvent{Type: DHTEventPut, Hash: hash.String(), EntryType: "profile"})
+		So(len(h.dht.events), ShouldEqual, 0)
+		events, _ := h.dht.AddDHTEventListener()
+		_, ok := <-events
+		So(ok, ShouldBeFalse)
+		So(h.dht.Unsubscribe(id), ShouldBeNil)
+	})
+}
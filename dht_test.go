@@ -349,8 +349,10 @@ func TestActionReceiver(t *testing.T) {
 		r, err := ActionReceiver(h, m)
 		So(err, ShouldBeNil)
 		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
-		So(len(h.dht.retryQueue), ShouldEqual, 1)
-		<-h.dht.retryQueue // unload the queue
+		queued, err := h.dht.GetQueued(RetryQueue)
+		So(err, ShouldBeNil)
+		So(len(queued), ShouldEqual, 1)
+		h.dht.dequeue(&queued[0]) // unload the queue
 	})
 
 	Convey("GETLINK_REQUEST should retrieve link values", t, func() {
@@ -431,8 +433,10 @@ func TestActionReceiver(t *testing.T) {
 		r, err := ActionReceiver(h, m)
 		So(err, ShouldBeNil)
 		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
-		So(len(h.dht.retryQueue), ShouldEqual, 1)
-		<-h.dht.retryQueue // unload the queue
+		queued, err := h.dht.GetQueued(RetryQueue)
+		So(err, ShouldBeNil)
+		So(len(queued), ShouldEqual, 1)
+		h.dht.dequeue(&queued[0]) // unload the queue
 	})
 
 	// put a second entry to DHT
@@ -480,7 +484,9 @@ func TestActionReceiver(t *testing.T) {
 		r, err := ActionReceiver(h, m)
 		So(err, ShouldBeNil)
 		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
-		So(len(h.dht.retryQueue), ShouldEqual, 1)
+		queued, err := h.dht.GetQueued(RetryQueue)
+		So(err, ShouldBeNil)
+		So(len(queued), ShouldEqual, 1)
 	})
 
 	Convey("LISTADD_REQUEST with bad warrant should return error", t, func() {
@@ -619,7 +625,8 @@ func TestDHTRetry(t *testing.T) {
 		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
 
 		// pause for a few retires
-		h.node.stoppers[RetryingStopper] = h.TaskTicker(time.Millisecond*10, RetryTask)
+		h.Config.retryInterval = time.Millisecond * 5
+		h.node.stoppers[RetryingStopper] = h.TaskTicker(time.Millisecond*5, RetryTask)
 		time.Sleep(time.Millisecond * 25)
 
 		// add the entries and get them into the DHT
@@ -635,7 +642,8 @@ func TestDHTRetry(t *testing.T) {
 		_, _, _, status, _ := h.dht.Get(hash, StatusAny, GetMaskAll)
 		So(status, ShouldEqual, StatusLive)
 
-		// wait for next retry
+		// make the retry due and wait for it
+		So(h.dht.ReplayQueues(), ShouldBeNil)
 		time.Sleep(time.Millisecond * 40)
 
 		_, _, _, status, _ = h.dht.Get(hash, StatusAny, GetMaskAll)
@@ -658,12 +666,65 @@ func TestDHTRetry(t *testing.T) {
 		r, err := ActionReceiver(h, m)
 		So(err, ShouldBeNil)
 		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
-		So(len(h.dht.retryQueue), ShouldEqual, 1)
+		queued, err := h.dht.GetQueued(RetryQueue)
+		So(err, ShouldBeNil)
+		So(len(queued), ShouldEqual, 1)
+		So(queued[0].Attempts, ShouldEqual, 1)
+
+		// retrying should back off exponentially
+		r, err = actionReceiver(h, m, queued[0].Attempts)
+		So(r, ShouldEqual, DHTChangeUnknownHashQueuedForRetry)
+		queued, _ = h.dht.GetQueued(RetryQueue)
+		So(queued[0].Attempts, ShouldEqual, 2)
+		So(h.dht.retryDelay(2), ShouldEqual, h.Config.retryInterval*2)
+		So(h.dht.retryDelay(100), ShouldEqual, MaxRetryDelay)
+
+		// and give up after MaxRetries
+		queued[0].Attempts = MaxRetries + 1
+		err = h.dht.retryQueued(&queued[0])
+		So(err, ShouldBeNil)
+		queued, _ = h.dht.GetQueued(RetryQueue)
+		So(len(queued), ShouldEqual, 0)
+	})
+
+	Convey("queued changes should be persisted until accepted", t, func() {
+		// clear out the changes made at genesis
+		for len(h.dht.changeQueue) > 0 {
+			<-h.dht.changeQueue
+		}
+		queued, err := h.dht.GetQueued(ChangeQueue)
+		So(err, ShouldBeNil)
+		for i := range queued {
+			h.dht.dequeue(&queued[i])
+		}
 
-		interval := time.Millisecond * 10
-		h.node.stoppers[RetryingStopper] = h.TaskTicker(interval, RetryTask)
-		time.Sleep(interval * (MaxRetries + 2))
-		So(len(h.dht.retryQueue), ShouldEqual, 0)
+		e5 := GobEntry{C: `{"firstName":"Zoppy","lastName":"Pinhead"}`}
+		hash5, _ := e5.Sum(h.hashSpec)
+		err = h.dht.Change(hash5, PUT_REQUEST, HoldReq{EntryHash: hash5})
+		So(err, ShouldBeNil)
+		queued, err = h.dht.GetQueued(ChangeQueue)
+		So(err, ShouldBeNil)
+		So(len(queued), ShouldEqual, 1)
+		So(queued[0].Key.String(), ShouldEqual, hash5.String())
+		So(queued[0].Attempts, ShouldEqual, 0)
+
+		// with no other nodes to accept it, it should stay queued
+		req := (<-h.dht.changeQueue).(changeReq)
+		So(h.dht.change(req), ShouldEqual, ErrEmptyRoutingTable)
+		queued, _ = h.dht.GetQueued(ChangeQueue)
+		So(len(queued), ShouldEqual, 1)
+		So(queued[0].Attempts, ShouldEqual, 1)
+		So(queued[0].Next.After(time.Now()), ShouldBeTrue)
+
+		// and be sent again when replayed
+		So(h.dht.ReplayQueues(), ShouldBeNil)
+		RetryTask(h)
+		So(len(h.dht.changeQueue), ShouldEqual, 1)
+		req = (<-h.dht.changeQueue).(changeReq)
+		So(req.attempts, ShouldEqual, 1)
+		h.dht.change(req)
+		queued, _ = h.dht.GetQueued(ChangeQueue)
+		So(queued[0].Attempts, ShouldEqual, 2)
 	})
 }
 
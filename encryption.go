@@ -0,0 +1,181 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// Encryption between agents uses the agents' Ed25519 signing keys converted to their
+// Curve25519 equivalents so that no separate encryption key needs to be published.
+// Data is sealed with NaCl box to the recipient using a fresh ephemeral key, so only the
+// recipient can open it and the sender stays anonymous to anyone but the recipient.
+
+package holochain
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	. "github.com/holochain/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	encryptionKeySize   = 32
+	encryptionNonceSize = 24
+)
+
+var ErrDecryptionFailed = errors.New("unable to decrypt data")
+
+// curve25519P is the prime 2^255-19 both Ed25519 and Curve25519 are defined over
+var curve25519P = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+
+// ed25519KeyData returns the key bytes of a marshaled libp2p Ed25519 key, i.e. the
+// data field of its protobuf which comes after the key type and length
+func ed25519KeyData(marshaled []byte, minLen int) (data []byte, err error) {
+	if len(marshaled) < 4 || marshaled[0] != 0x08 || marshaled[1] != byte(ic.Ed25519) || marshaled[2] != 0x12 {
+		err = errors.New("encryption requires an Ed25519 key")
+		return
+	}
+	data = marshaled[4:]
+	if int(marshaled[3]) != len(data) || len(data) < minLen {
+		err = errors.New("malformed Ed25519 key")
+	}
+	return
+}
+
+// encryptionPubKey converts an agent's Ed25519 public key to its Curve25519 equivalent
+func encryptionPubKey(pubKey ic.PubKey) (key *[encryptionKeySize]byte, err error) {
+	var b []byte
+	if b, err = ic.MarshalPublicKey(pubKey); err != nil {
+		return
+	}
+	if b, err = ed25519KeyData(b, encryptionKeySize); err != nil {
+		return
+	}
+
+	// the key is the little-endian y coordinate with the sign of x in the top bit,
+	// the Montgomery u coordinate is (1+y)/(1-y)
+	be := make([]byte, encryptionKeySize)
+	for i := range be {
+		be[i] = b[encryptionKeySize-1-i]
+	}
+	be[0] &= 0x7f
+	y := new(big.Int).SetBytes(be)
+	den := new(big.Int).Sub(big.NewInt(1), y)
+	den.Mod(den, curve25519P)
+	if den.ModInverse(den, curve25519P) == nil {
+		err = errors.New("public key can't be used for encryption")
+		return
+	}
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, den).Mod(u, curve25519P)
+
+	be = u.Bytes()
+	key = new([encryptionKeySize]byte)
+	for i := range be {
+		key[i] = be[len(be)-1-i]
+	}
+	return
+}
+
+// encryptionPrivKey converts an agent's Ed25519 private key to its Curve25519 equivalent
+func encryptionPrivKey(privKey ic.PrivKey) (key *[encryptionKeySize]byte, err error) {
+	var b []byte
+	if b, err = ic.MarshalPrivateKey(privKey); err != nil {
+		return
+	}
+	if b, err = ed25519KeyData(b, encryptionKeySize); err != nil {
+		return
+	}
+	// the scalar Ed25519 derives from the key's seed
+	digest := sha512.Sum512(b[:encryptionKeySize])
+	digest[0] &= 248
+	digest[31] &= 127
+	digest[31] |= 64
+	key = new([encryptionKeySize]byte)
+	copy(key[:], digest[:encryptionKeySize])
+	return
+}
+
+// agentPubKey returns the public key of the agent whose key or agent entry hash is given
+func (h *Holochain) agentPubKey(agent Hash) (pubKey ic.PubKey, err error) {
+	if agent.Equal(h.agentHash) || agent.Equal(HashFromPeerID(h.nodeID)) {
+		pubKey = h.agent.PubKey()
+		return
+	}
+	req := GetReq{H: agent, StatusMask: StatusDefault, GetMask: GetMaskEntry | GetMaskEntryType}
+	var rsp interface{}
+	rsp, err = callGet(h, req, &GetOptions{StatusMask: req.StatusMask, GetMask: req.GetMask})
+	if err != nil {
+		return
+	}
+	resp := rsp.(GetResp)
+	switch resp.EntryType {
+	case KeyEntryType:
+		pubKey, err = h.getNodePubKey(PeerIDFromHash(agent))
+	case AgentEntryType:
+		var entry AgentEntry
+		entry, err = AgentEntryFromJSON(resp.Entry.Content().(string))
+		if err != nil {
+			return
+		}
+		pubKey, err = DecodePubKey(entry.PublicKey)
+	default:
+		err = fmt.Errorf("%v is not an agent but a %s entry", agent, resp.EntryType)
+	}
+	return
+}
+
+// Encrypt seals data so that only the agent whose key or agent entry hash is given can
+// decrypt it, returning it base64 encoded
+func (h *Holochain) Encrypt(to Hash, data []byte) (encrypted string, err error) {
+	var pubKey ic.PubKey
+	if pubKey, err = h.agentPubKey(to); err != nil {
+		return
+	}
+	var peerKey *[encryptionKeySize]byte
+	if peerKey, err = encryptionPubKey(pubKey); err != nil {
+		return
+	}
+	ephemeralPub, ephemeralPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return
+	}
+	var nonce [encryptionNonceSize]byte
+	if _, err = rand.Read(nonce[:]); err != nil {
+		return
+	}
+	sealed := append(ephemeralPub[:], nonce[:]...)
+	sealed = box.Seal(sealed, data, &nonce, peerKey, ephemeralPriv)
+	encrypted = base64.StdEncoding.EncodeToString(sealed)
+	return
+}
+
+// Decrypt opens data that was encrypted to this agent
+func (h *Holochain) Decrypt(encrypted string) (data []byte, err error) {
+	var sealed []byte
+	if sealed, err = base64.StdEncoding.DecodeString(encrypted); err != nil {
+		return
+	}
+	if len(sealed) < encryptionKeySize+encryptionNonceSize+box.Overhead {
+		err = ErrDecryptionFailed
+		return
+	}
+	var peerKey [encryptionKeySize]byte
+	var nonce [encryptionNonceSize]byte
+	copy(peerKey[:], sealed[:encryptionKeySize])
+	copy(nonce[:], sealed[encryptionKeySize:encryptionKeySize+encryptionNonceSize])
+
+	var privKey *[encryptionKeySize]byte
+	if privKey, err = encryptionPrivKey(h.agent.PrivKey()); err != nil {
+		return
+	}
+	var ok bool
+	data, ok = box.Open(nil, sealed[encryptionKeySize+encryptionNonceSize:], &nonce, &peerKey, privKey)
+	if !ok {
+		err = ErrDecryptionFailed
+	}
+	return
+}
@@ -0,0 +1,91 @@
+package holochain
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	. "github.com/holochain/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/crypto/curve25519"
+	"testing"
+)
+
+func TestEncryptionKeys(t *testing.T) {
+	Convey("it should reject keys that aren't Ed25519", t, func() {
+		_, err := ed25519KeyData([]byte{0x08, 0x00, 0x12, 0x01, 0x00}, encryptionKeySize)
+		So(err.Error(), ShouldEqual, "encryption requires an Ed25519 key")
+		_, err = ed25519KeyData([]byte{0x08, 0x01, 0x12, 0x20, 0x00}, encryptionKeySize)
+		So(err.Error(), ShouldEqual, "malformed Ed25519 key")
+	})
+
+	Convey("it should convert a key pair to keys that work together", t, func() {
+		priv, pub, err := ic.GenerateEd25519Key(rand.Reader)
+		So(err, ShouldBeNil)
+		_, pub2, err := ic.GenerateEd25519Key(rand.Reader)
+		So(err, ShouldBeNil)
+		privKey, err := encryptionPrivKey(priv)
+		So(err, ShouldBeNil)
+		pubKey, err := encryptionPubKey(pub)
+		So(err, ShouldBeNil)
+		pubKey2, err := encryptionPubKey(pub2)
+		So(err, ShouldBeNil)
+		So(*pubKey, ShouldNotResemble, *pubKey2)
+
+		var derived [encryptionKeySize]byte
+		curve25519.ScalarBaseMult(&derived, privKey)
+		So(derived, ShouldResemble, *pubKey)
+	})
+}
+
+func TestEncrypt(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should decrypt what was encrypted to the agent", t, func() {
+		for _, to := range []Hash{h.agentHash, HashFromPeerID(h.nodeID)} {
+			encrypted, err := h.Encrypt(to, []byte("secret"))
+			So(err, ShouldBeNil)
+			So(encrypted, ShouldNotContainSubstring, "secret")
+			data, err := h.Decrypt(encrypted)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "secret")
+		}
+	})
+
+	Convey("it should fail to decrypt tampered data", t, func() {
+		encrypted, err := h.Encrypt(h.agentHash, []byte("secret"))
+		So(err, ShouldBeNil)
+		b, _ := base64.StdEncoding.DecodeString(encrypted)
+		b[len(b)-1] ^= 1
+		_, err = h.Decrypt(base64.StdEncoding.EncodeToString(b))
+		So(err, ShouldEqual, ErrDecryptionFailed)
+		_, err = h.Decrypt("c2hvcnQ=")
+		So(err, ShouldEqual, ErrDecryptionFailed)
+	})
+
+	Convey("it should refuse to encrypt to entries that aren't agents", t, func() {
+		hash := commit(h, "oddNumbers", "3")
+		_, err := h.Encrypt(hash, []byte("secret"))
+		So(err.Error(), ShouldEqual, hash.String()+" is not an agent but a oddNumbers entry")
+	})
+}
+
+func TestEncryptBetweenNodes(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	ringConnect(t, mt.ctx, nodes, nodesCount)
+
+	Convey("it should encrypt to another node's agent that only it can decrypt", t, func() {
+		for _, to := range []Hash{nodes[1].agentHash, HashFromPeerID(nodes[1].nodeID)} {
+			encrypted, err := nodes[0].Encrypt(to, []byte("for your eyes only"))
+			So(err, ShouldBeNil)
+			_, err = nodes[0].Decrypt(encrypted)
+			So(err, ShouldEqual, ErrDecryptionFailed)
+			data, err := nodes[1].Decrypt(encrypted)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, "for your eyes only")
+		}
+	})
+}
@@ -41,6 +41,7 @@ type EntryDef struct {
 	DataFormat string
 	Sharing    string
 	Schema     string
+	Rules      *ValidationRules
 	validator  SchemaValidator
 }
 
@@ -0,0 +1,94 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// execution budgets limit how long zome code may run so that runaway code can't block
+// the goroutine calling it, in particular when validating other people's data
+
+package holochain
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// callback types that budgets can be set for
+	CallbackTypeCall           = "call"           // zome functions and running code
+	CallbackTypeValidate       = "validate"       // validation and validation packaging callbacks
+	CallbackTypeGenesis        = "genesis"        // genesis and bridgeGenesis
+	CallbackTypeReceive        = "receive"        // receive and asynchronous send callbacks
+	CallbackTypeBundleCanceled = "bundleCanceled" // bundleCanceled
+
+	// DefaultValidationExecutionTimeout is the timeout in milliseconds of validation
+	// callbacks when the DNA doesn't set one
+	DefaultValidationExecutionTimeout = 10000
+)
+
+// ExecutionBudget holds the limits on a single run of zome code
+type ExecutionBudget struct {
+	Timeout       int // wall-clock milliseconds a run may take, 0 for the default, negative for no limit
+	MaxStackDepth int // maximum depth of nested function calls, 0 for no limit (JS only)
+}
+
+// ExecutionBudgets holds the execution budgets of a DNA
+type ExecutionBudgets struct {
+	Default   ExecutionBudget
+	Callbacks map[string]ExecutionBudget `json:",omitempty"` // budgets of callback types overriding the default
+}
+
+// ExecutionTimeoutError is returned when zome code runs longer than its budget allows
+type ExecutionTimeoutError struct {
+	Zome     string
+	Callback string
+	Timeout  time.Duration
+}
+
+func (e *ExecutionTimeoutError) Error() string {
+	return fmt.Sprintf("%s in zome %s timed out after %v", e.Callback, e.Zome, e.Timeout)
+}
+
+// IsExecutionTimeoutErr returns true if the error is an execution timeout
+func IsExecutionTimeoutErr(err error) bool {
+	_, ok := err.(*ExecutionTimeoutError)
+	return ok
+}
+
+// execError adds which function failed to an error from running it, timeouts are
+// returned as they are so callers can tell them apart
+func execError(fnName string, err error) error {
+	if IsExecutionTimeoutErr(err) {
+		return err
+	}
+	return prefixError(fmt.Sprintf("Error executing %s: ", fnName), err)
+}
+
+// Budget returns the budget for a callback type, b may be nil for the defaults
+func (b *ExecutionBudgets) Budget(callbackType string) (budget ExecutionBudget) {
+	if b != nil {
+		var ok bool
+		if budget, ok = b.Callbacks[callbackType]; !ok {
+			budget = b.Default
+		}
+	}
+	if budget.Timeout == 0 && callbackType == CallbackTypeValidate {
+		budget.Timeout = DefaultValidationExecutionTimeout
+	}
+	return
+}
+
+// timeout returns the wall-clock limit of the budget, or 0 for no limit
+func (budget ExecutionBudget) timeout() time.Duration {
+	if budget.Timeout <= 0 {
+		return 0
+	}
+	return time.Duration(budget.Timeout) * time.Millisecond
+}
+
+// executionBudget returns the budget of the app's DNA for a callback type
+func (h *Holochain) executionBudget(callbackType string) ExecutionBudget {
+	var budgets *ExecutionBudgets
+	if h != nil && h.nucleus != nil && h.nucleus.dna != nil {
+		budgets = h.nucleus.dna.ExecutionBudgets
+	}
+	return budgets.Budget(callbackType)
+}
@@ -0,0 +1,137 @@
+package holochain
+
+import (
+	zygo "github.com/glycerine/zygomys/zygo"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestExecutionBudgets(t *testing.T) {
+	Convey("it should return the budgets of callback types", t, func() {
+		var budgets *ExecutionBudgets
+		So(budgets.Budget(CallbackTypeCall), ShouldResemble, ExecutionBudget{})
+		So(budgets.Budget(CallbackTypeValidate).Timeout, ShouldEqual, DefaultValidationExecutionTimeout)
+
+		budgets = &ExecutionBudgets{
+			Default:   ExecutionBudget{Timeout: 100},
+			Callbacks: map[string]ExecutionBudget{CallbackTypeValidate: ExecutionBudget{Timeout: -1}},
+		}
+		So(budgets.Budget(CallbackTypeCall).Timeout, ShouldEqual, 100)
+		So(budgets.Budget(CallbackTypeCall).timeout(), ShouldEqual, 100*time.Millisecond)
+		So(budgets.Budget(CallbackTypeValidate).timeout(), ShouldEqual, 0)
+	})
+}
+
+func TestJSExecutionBudget(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.nucleus.dna.ExecutionBudgets = &ExecutionBudgets{
+		Callbacks: map[string]ExecutionBudget{
+			CallbackTypeCall:     ExecutionBudget{Timeout: 50, MaxStackDepth: 100},
+			CallbackTypeValidate: ExecutionBudget{Timeout: 50},
+		},
+	}
+	z, err := NewJSRibosome(h, &Zome{Name: "looper", RibosomeType: JSRibosomeType, Code: `
+function spin() {while(true){}}
+function recurse(n) {return recurse(n+1)}
+function ok() {return "ok"}
+function validateCommit(name,entry,header,pkg,sources) {while(true){}}`})
+	if err != nil {
+		panic(err)
+	}
+
+	Convey("it should stop calls that run past their timeout", t, func() {
+		start := time.Now()
+		_, err := z.Call(&FunctionDef{Name: "spin", CallingType: STRING_CALLING}, "")
+		So(IsExecutionTimeoutErr(err), ShouldBeTrue)
+		So(err.Error(), ShouldEqual, "spin in zome looper timed out after 50ms")
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+
+	Convey("it should still run code after a timeout", t, func() {
+		result, err := z.Call(&FunctionDef{Name: "ok", CallingType: STRING_CALLING}, "")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "ok")
+	})
+
+	Convey("it should limit the stack depth", t, func() {
+		_, err := z.Call(&FunctionDef{Name: "recurse", CallingType: STRING_CALLING}, "")
+		So(err, ShouldNotBeNil)
+		So(IsExecutionTimeoutErr(err), ShouldBeFalse)
+	})
+
+	Convey("it should time out validation callbacks", t, func() {
+		hdr := mkTestHeader("evenNumbers")
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "2"})
+		a.header = &hdr
+		err := z.ValidateAction(a, &EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}, nil, nil)
+		So(IsExecutionTimeoutErr(err), ShouldBeTrue)
+	})
+}
+
+func TestZygoExecutionBudget(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.nucleus.dna.ExecutionBudgets = &ExecutionBudgets{Callbacks: map[string]ExecutionBudget{CallbackTypeCall: ExecutionBudget{Timeout: 50}}}
+	defer func() { h.nucleus.dna.ExecutionBudgets = nil }()
+	r, err := NewZygoRibosome(h, &Zome{Name: "looper", RibosomeType: ZygoRibosomeType,
+		Code: `(defn spin [] (for [(def i 0) (>= i 0) (set i (+ i 1))] i))`})
+
+	Convey("it should stop zygo code that runs too long", t, func() {
+		So(err, ShouldBeNil)
+		start := time.Now()
+		_, err := r.Run(`(spin)`)
+		So(IsExecutionTimeoutErr(err), ShouldBeTrue)
+		So(time.Since(start) < 2*time.Second, ShouldBeTrue)
+	})
+
+	Convey("it should still run code after stopping some", t, func() {
+		result, err := r.Run(`(+ 1 2)`)
+		So(err, ShouldBeNil)
+		So(result.(*zygo.SexpInt).Val, ShouldEqual, 3)
+	})
+}
+
+func TestValidationTimeouts(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	var zome *Zome
+	for i := range h.nucleus.dna.Zomes {
+		if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" {
+			zome = &h.nucleus.dna.Zomes[i]
+		}
+	}
+	code := zome.Code
+	zome.Code += `
+function validatePut(entry_type,entry,header,pkg,sources) {while(true){}}`
+	defer func() { zome.Code = code }()
+	h.nucleus.dna.ExecutionBudgets = &ExecutionBudgets{
+		Callbacks: map[string]ExecutionBudget{CallbackTypeValidate: ExecutionBudget{Timeout: 50}},
+	}
+	defer func() { h.nucleus.dna.ExecutionBudgets = nil }()
+
+	hdr := mkTestHeader("oddNumbers")
+	a := NewPutAction("oddNumbers", &GobEntry{C: "3"}, &hdr)
+
+	Convey("a validation timeout should not be a validation failure", t, func() {
+		_, err := h.ValidateAction(a, "oddNumbers", nil, []peer.ID{h.nodeID})
+		So(IsExecutionTimeoutErr(err), ShouldBeTrue)
+		So(IsValidationFailedErr(err), ShouldBeFalse)
+	})
+
+	Convey("a validation timeout should not be cached", t, func() {
+		err := h.validateReceived(a, &hdr, "oddNumbers", nil, []peer.ID{h.nodeID})
+		So(IsExecutionTimeoutErr(err), ShouldBeTrue)
+		key, err := h.dht.validationOutcomeKey(a, &hdr)
+		So(err, ShouldBeNil)
+		var outcome validationOutcome
+		found, err := h.dht.vcacheGet(key, &outcome)
+		So(err, ShouldBeNil)
+		So(found, ShouldBeFalse)
+	})
+}
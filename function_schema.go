@@ -0,0 +1,94 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// function schemas let a zome declare JSON Schemas that the arguments and results of its
+// functions must match, which Holochain.Call checks on either side of calling the zome
+
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	FunctionSchemaInput  = "input"
+	FunctionSchemaOutput = "output"
+)
+
+// FunctionSchemaError reports arguments or a result not matching a function's schema
+type FunctionSchemaError struct {
+	Zome     string `json:"zome"`
+	Function string `json:"function"`
+	Schema   string `json:"schema"` // FunctionSchemaInput or FunctionSchemaOutput
+	Message  string `json:"message"`
+}
+
+func (e *FunctionSchemaError) Error() string {
+	return fmt.Sprintf("%s of %s doesn't match its schema: %s", e.Schema, e.Function, e.Message)
+}
+
+// BuildSchemaValidators builds the validators of the function's schemas
+func (f *FunctionDef) BuildSchemaValidators() (err error) {
+	if f.InputSchema != "" {
+		if f.inputValidator, err = BuildJSONSchemaValidatorFromString(f.InputSchema); err != nil {
+			err = fmt.Errorf("error building input schema validator for %s: %v", f.Name, err)
+			return
+		}
+	}
+	if f.OutputSchema != "" {
+		if f.outputValidator, err = BuildJSONSchemaValidatorFromString(f.OutputSchema); err != nil {
+			err = fmt.Errorf("error building output schema validator for %s: %v", f.Name, err)
+			return
+		}
+	}
+	return
+}
+
+// ValidateInput checks the arguments a function is called with against its input schema
+func (f *FunctionDef) ValidateInput(zome string, params interface{}) error {
+	return f.validate(zome, FunctionSchemaInput, f.InputSchema, f.inputValidator, params)
+}
+
+// ValidateOutput checks the result of a function against its output schema
+func (f *FunctionDef) ValidateOutput(zome string, result interface{}) error {
+	return f.validate(zome, FunctionSchemaOutput, f.OutputSchema, f.outputValidator, result)
+}
+
+func (f *FunctionDef) validate(zome string, which string, schema string, validator SchemaValidator, data interface{}) (err error) {
+	if schema == "" {
+		return
+	}
+	if validator == nil {
+		// the function wasn't loaded from a DNA file so its validators weren't built
+		var v *JSONSchemaValidator
+		if v, err = BuildJSONSchemaValidatorFromString(schema); err != nil {
+			return
+		}
+		validator = v
+	}
+	var s string
+	switch t := data.(type) {
+	case string:
+		s = t
+	case []byte:
+		s = string(t)
+	default:
+		return fmt.Errorf("can't check %s of %s against its schema: unexpected %T", which, f.Name, data)
+	}
+
+	// json calling functions take and return JSON, string calling ones a string
+	var value interface{} = s
+	if f.CallingType == JSON_CALLING {
+		value = nil
+		if s != "" {
+			if err = json.Unmarshal([]byte(s), &value); err != nil {
+				return &FunctionSchemaError{Zome: zome, Function: f.Name, Schema: which, Message: err.Error()}
+			}
+		}
+	}
+	if err = validator.Validate(value); err != nil {
+		err = &FunctionSchemaError{Zome: zome, Function: f.Name, Schema: which, Message: err.Error()}
+	}
+	return
+}
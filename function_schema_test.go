@@ -0,0 +1,68 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestFunctionSchemas(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	var fn *FunctionDef
+	var strFn *FunctionDef
+	for i := range h.nucleus.dna.Zomes {
+		z := &h.nucleus.dna.Zomes[i]
+		if z.Name == "jsSampleZome" {
+			for j := range z.Functions {
+				switch z.Functions[j].Name {
+				case "testJsonFn1":
+					fn = &z.Functions[j]
+				case "testStrFn1":
+					strFn = &z.Functions[j]
+				}
+			}
+		}
+	}
+	fn.InputSchema = `{"type":"object","properties":{"input":{"type":"number"}},"required":["input"]}`
+	fn.OutputSchema = `{"type":"object","properties":{"output":{"type":"number","maximum":10}}}`
+	strFn.InputSchema = `{"type":"string","maxLength":5}`
+
+	Convey("it should fail to build validators from bad schemas", t, func() {
+		f := FunctionDef{Name: "bad", InputSchema: "{"}
+		err := f.BuildSchemaValidators()
+		So(err.Error(), ShouldStartWith, "error building input schema validator for bad")
+	})
+
+	Convey("it should call functions with arguments and results matching their schemas", t, func() {
+		result, err := h.Call("jsSampleZome", "testJsonFn1", `{"input":2}`, ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, `{"input":2,"output":4}`)
+		result, err = h.Call("jsSampleZome", "testStrFn1", "fish", ZOME_EXPOSURE)
+		So(err, ShouldBeNil)
+		So(result.(string), ShouldEqual, "result: fish")
+	})
+
+	Convey("it should not call functions with arguments that don't match the input schema", t, func() {
+		_, err := h.Call("jsSampleZome", "testJsonFn1", `{"input":"2"}`, ZOME_EXPOSURE)
+		e, ok := err.(*FunctionSchemaError)
+		So(ok, ShouldBeTrue)
+		So(e.Zome, ShouldEqual, "jsSampleZome")
+		So(e.Function, ShouldEqual, "testJsonFn1")
+		So(e.Schema, ShouldEqual, FunctionSchemaInput)
+		_, err = h.Call("jsSampleZome", "testJsonFn1", `{"input":`, ZOME_EXPOSURE)
+		So(err.(*FunctionSchemaError).Schema, ShouldEqual, FunctionSchemaInput)
+		_, err = h.Call("jsSampleZome", "testStrFn1", "swordfish", ZOME_EXPOSURE)
+		So(err.(*FunctionSchemaError).Schema, ShouldEqual, FunctionSchemaInput)
+	})
+
+	Convey("it should fail calls with results that don't match the output schema", t, func() {
+		_, err := h.Call("jsSampleZome", "testJsonFn1", `{"input":6}`, ZOME_EXPOSURE)
+		e, ok := err.(*FunctionSchemaError)
+		So(ok, ShouldBeTrue)
+		So(e.Schema, ShouldEqual, FunctionSchemaOutput)
+		So(e.Error(), ShouldStartWith, "output of testJsonFn1 doesn't match its schema: ")
+	})
+
+	fn.InputSchema, fn.OutputSchema, strFn.InputSchema = "", "", ""
+}
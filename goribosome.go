@@ -0,0 +1,248 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// GoRibosome implements the Ribosome interface for zomes written in Go
+//
+// A Go zome is a GoZome struct of callbacks registered with RegisterGoZome by the
+// program embedding holochain.  The zome's code file holds the name it was registered
+// under (or is empty to use the zome's name) and the callbacks get a ZomeAPI through
+// which they access the holochain API.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	"strings"
+	"sync"
+)
+
+const (
+	GoRibosomeType = "go"
+)
+
+var ErrGoRunNotSupported = errors.New("the go ribosome can't run source code")
+
+// GoZomeFunc implements a zome function; it receives the string it was called with
+// (JSON for json calling functions) and for json calling functions its result is
+// returned as JSON
+type GoZomeFunc func(api *ZomeAPI, params string) (result interface{}, err error)
+
+// GoCallback receives the JSON of the response to an asynchronous send
+type GoCallback func(api *ZomeAPI, response json.RawMessage, id string) (result interface{}, err error)
+
+// GoValidation holds what a Go zome gets to validate an action
+type GoValidation struct {
+	Action    string // name of the action: commit, put, mod, del or link
+	EntryType string
+	Entry     string  // content of the entry for commit, put and mod
+	Header    *Header // header of the entry for commit, put and mod
+	Replaces  Hash    // hash of the replaced entry for mod
+	Deleted   Hash    // hash of the deleted entry for del
+	Base      Hash    // base of the links for link
+	Links     []Link
+	Package   *ValidationPackage
+	Sources   []string
+}
+
+// GoZome holds the callbacks implementing a zome in Go
+// Every callback except Functions and Validate may be left nil
+type GoZome struct {
+	Genesis           func(api *ZomeAPI) error
+	BridgeGenesis     func(api *ZomeAPI, side int, dnaHash Hash, data string) error
+	Receive           func(api *ZomeAPI, from string, msg json.RawMessage) (response interface{}, err error)
+	BundleCanceled    func(api *ZomeAPI, reason string, userParam string) (response string, err error)
+	ValidatePackaging func(api *ZomeAPI, action string, entryType string) (req PackagingReq, err error)
+
+	// Validate returns nil if the action is valid or ValidationFailed if it isn't,
+	// any other error is treated as a failure to validate
+	Validate func(api *ZomeAPI, v *GoValidation) error
+
+	Functions map[string]GoZomeFunc
+	Callbacks map[string]GoCallback // callbacks for asynchronous sends
+}
+
+// GoRibosome holds the data needed to run a Go zome
+type GoRibosome struct {
+	h    *Holochain
+	zome *Zome
+	gz   *GoZome
+	api  *ZomeAPI
+}
+
+var goZomes = make(map[string]*GoZome)
+var goZomesLk sync.RWMutex
+
+// RegisterGoZome makes a Go zome available to DNAs under the given name
+func RegisterGoZome(name string, zome *GoZome) {
+	if zome == nil {
+		panic(fmt.Sprintf("Go zome %s does not exist.", name))
+	}
+	goZomesLk.Lock()
+	defer goZomesLk.Unlock()
+	_, registered := goZomes[name]
+	if registered {
+		panic(fmt.Sprintf("Go zome %s already registered. ", name))
+	}
+	goZomes[name] = zome
+}
+
+// Type returns the string value under which this Ribosome is registered
+func (gr *GoRibosome) Type() string { return GoRibosomeType }
+
+// NewGoRibosome factory function to build a go ribosome for a zome
+func NewGoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	name := strings.TrimSpace(zome.Code)
+	if name == "" {
+		name = zome.Name
+	}
+	goZomesLk.RLock()
+	gz, ok := goZomes[name]
+	goZomesLk.RUnlock()
+	if !ok {
+		err = fmt.Errorf("no go zome registered as %s", name)
+		return
+	}
+	n = &GoRibosome{h: h, zome: zome, gz: gz, api: NewZomeAPI(h, zome)}
+	return
+}
+
+// Reset prepares the ribosome to be reused, Go zomes keep no state in the ribosome
+func (gr *GoRibosome) Reset() bool { return true }
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (gr *GoRibosome) ChainGenesis() (err error) {
+	if gr.gz.Genesis != nil {
+		err = gr.gz.Genesis(gr.api)
+	}
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (gr *GoRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	if gr.gz.BridgeGenesis != nil {
+		err = gr.gz.BridgeGenesis(gr.api, side, dnaHash, data)
+	}
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (gr *GoRibosome) Receive(from string, msg string) (response string, err error) {
+	if gr.gz.Receive == nil {
+		err = fmt.Errorf("go zome %s doesn't receive messages", gr.zome.Name)
+		return
+	}
+	var r interface{}
+	r, err = gr.gz.Receive(gr.api, from, json.RawMessage(msg))
+	if err != nil {
+		return
+	}
+	var b []byte
+	b, err = json.Marshal(r)
+	response = string(b)
+	return
+}
+
+// BundleCanceled calls the app bundleCanceled function
+func (gr *GoRibosome) BundleCanceled(reason string) (response string, err error) {
+	bundle := gr.h.chain.BundleStarted()
+	if bundle == nil {
+		err = ErrBundleNotStarted
+		return
+	}
+	if gr.gz.BundleCanceled != nil {
+		response, err = gr.gz.BundleCanceled(gr.api, reason, bundle.userParam)
+	}
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (gr *GoRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	if gr.gz.ValidatePackaging != nil {
+		req, err = gr.gz.ValidatePackaging(gr.api, action.Name(), def.Name)
+	}
+	return
+}
+
+// ValidateAction builds the validation data for the action and calls the zome's validator
+func (gr *GoRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	if gr.gz.Validate == nil {
+		err = fmt.Errorf("go zome %s has no validator", gr.zome.Name)
+		return
+	}
+	v := GoValidation{Action: action.Name(), EntryType: def.Name, Package: pkg, Sources: sources}
+	switch t := action.(type) {
+	case *ActionPut:
+		v.Entry = t.entry.Content().(string)
+		v.Header = t.header
+	case *ActionCommit:
+		v.Entry = t.entry.Content().(string)
+		v.Header = t.header
+	case *ActionMod:
+		v.Entry = t.entry.Content().(string)
+		v.Header = t.header
+		v.Replaces = t.replaces
+	case *ActionDel:
+		v.Deleted = t.entry.Hash
+	case *ActionLink:
+		v.Base = t.validationBase
+		v.Links = t.links
+	default:
+		err = fmt.Errorf("can't prepare validation for %T: ", t)
+		return
+	}
+	err = gr.gz.Validate(gr.api, &v)
+	return
+}
+
+// Call calls the zome function
+func (gr *GoRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	f, ok := gr.gz.Functions[fn.Name]
+	if !ok {
+		err = fmt.Errorf("go zome %s has no function %s", gr.zome.Name, fn.Name)
+		return
+	}
+	p, ok := params.(string)
+	if !ok {
+		err = errors.New("params type not implemented")
+		return
+	}
+	gr.h.Debugf("Go Call: %s(%s)", fn.Name, p)
+	var r interface{}
+	r, err = f(gr.api, p)
+	if err != nil {
+		return
+	}
+	switch fn.CallingType {
+	case STRING_CALLING:
+		result = fmt.Sprintf("%v", r)
+	case JSON_CALLING:
+		var b []byte
+		b, err = json.Marshal(r)
+		result = string(b)
+	default:
+		err = errors.New("params type not implemented")
+	}
+	return
+}
+
+// Run can't run source code as Go zomes are compiled in
+func (gr *GoRibosome) Run(code string) (result interface{}, err error) {
+	err = ErrGoRunNotSupported
+	return
+}
+
+// RunAsyncSendResponse calls the zome's callback for the response to an asynchronous send
+func (gr *GoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	f, ok := gr.gz.Callbacks[callback]
+	if !ok {
+		err = fmt.Errorf("go zome %s has no callback %s", gr.zome.Name, callback)
+		return
+	}
+	result, err = f(gr.api, json.RawMessage(response.Body), callbackID)
+	return
+}
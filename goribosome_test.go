@@ -0,0 +1,144 @@
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"strconv"
+	"testing"
+)
+
+var goTestZome = &GoZome{
+	Genesis: func(api *ZomeAPI) error {
+		api.Debug("go genesis: " + api.App().Name)
+		return nil
+	},
+	Receive: func(api *ZomeAPI, from string, msg json.RawMessage) (response interface{}, err error) {
+		var m map[string]string
+		err = json.Unmarshal(msg, &m)
+		response = map[string]string{"foo": m["bar"]}
+		return
+	},
+	Validate: func(api *ZomeAPI, v *GoValidation) error {
+		if v.Action == "commit" || v.Action == "put" {
+			i, err := strconv.Atoi(v.Entry)
+			if err != nil || i%2 != 0 {
+				return ValidationFailed(v.Entry + " is not even")
+			}
+		}
+		return nil
+	},
+	Functions: map[string]GoZomeFunc{
+		"echo": func(api *ZomeAPI, params string) (result interface{}, err error) {
+			result = "echo: " + params
+			return
+		},
+		"addEven": func(api *ZomeAPI, params string) (result interface{}, err error) {
+			var n int
+			if err = json.Unmarshal([]byte(params), &n); err != nil {
+				return
+			}
+			var hash Hash
+			hash, err = api.Commit("evenNumbers", fmt.Sprintf("%d", n))
+			result = map[string]string{"hash": hash.String()}
+			return
+		},
+		"callZy": func(api *ZomeAPI, params string) (result interface{}, err error) {
+			result, err = api.Call("zySampleZome", "testStrFn1", params)
+			return
+		},
+		"fail": func(api *ZomeAPI, params string) (result interface{}, err error) {
+			err = errors.New("failed")
+			return
+		},
+	},
+}
+
+func TestNewGoRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	goZomesLk.RLock()
+	_, registered := goZomes["goTest"]
+	goZomesLk.RUnlock()
+	if !registered {
+		RegisterGoZome("goTest", goTestZome)
+	}
+
+	Convey("it should fail to register a go zome twice", t, func() {
+		So(func() { RegisterGoZome("goTest", goTestZome) }, ShouldPanic)
+	})
+
+	Convey("it should fail for unregistered go zomes", t, func() {
+		_, err := NewGoRibosome(h, &Zome{Name: "notRegistered", RibosomeType: GoRibosomeType})
+		So(err.Error(), ShouldEqual, "no go zome registered as notRegistered")
+	})
+
+	zome := &Zome{Name: "myZome", RibosomeType: GoRibosomeType, Code: "goTest\n"}
+	r, err := CreateRibosome(h, zome)
+
+	Convey("it should create the ribosome of the registered go zome named by the code", t, func() {
+		So(err, ShouldBeNil)
+		So(r.Type(), ShouldEqual, GoRibosomeType)
+		So(zome.CodeFileName(), ShouldEqual, "myZome.gozome")
+	})
+
+	Convey("it should run the callbacks", t, func() {
+		ShouldLog(h.nucleus.alog, func() {
+			So(r.ChainGenesis(), ShouldBeNil)
+		}, "go genesis: "+h.Name())
+		So(r.BridgeGenesis(BridgeCaller, h.dnaHash, ""), ShouldBeNil)
+		response, err := r.Receive("fakehash", `{"bar":"baz"}`)
+		So(err, ShouldBeNil)
+		So(response, ShouldEqual, `{"foo":"baz"}`)
+		_, err = r.Run("1+1")
+		So(err, ShouldEqual, ErrGoRunNotSupported)
+	})
+
+	Convey("it should validate", t, func() {
+		def := &EntryDef{Name: "evenNumbers", DataFormat: DataFormatString}
+		hdr := mkTestHeader("evenNumbers")
+		a := NewCommitAction("evenNumbers", &GobEntry{C: "3"})
+		a.header = &hdr
+		err := r.ValidateAction(a, def, nil, nil)
+		So(err.Error(), ShouldEqual, "Validation Failed: 3 is not even")
+		a = NewCommitAction("evenNumbers", &GobEntry{C: "4"})
+		a.header = &hdr
+		So(r.ValidateAction(a, def, nil, nil), ShouldBeNil)
+
+		req, err := r.ValidatePackagingRequest(a, def)
+		So(err, ShouldBeNil)
+		So(req, ShouldBeNil)
+	})
+
+	Convey("it should call zome functions", t, func() {
+		result, err := r.Call(&FunctionDef{Name: "echo", CallingType: STRING_CALLING}, "hi")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "echo: hi")
+
+		result, err = r.Call(&FunctionDef{Name: "echo", CallingType: JSON_CALLING}, `"hi"`)
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, `"echo: \"hi\""`)
+
+		_, err = r.Call(&FunctionDef{Name: "fail", CallingType: STRING_CALLING}, "")
+		So(err.Error(), ShouldEqual, "failed")
+
+		_, err = r.Call(&FunctionDef{Name: "missing", CallingType: STRING_CALLING}, "")
+		So(err.Error(), ShouldEqual, "go zome myZome has no function missing")
+	})
+
+	Convey("it should use the API to work with other zomes", t, func() {
+		result, err := r.Call(&FunctionDef{Name: "callZy", CallingType: STRING_CALLING}, "arg1 arg2")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "result: arg1 arg2")
+
+		result, err = r.Call(&FunctionDef{Name: "addEven", CallingType: JSON_CALLING}, "42")
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, `{"hash":"`+h.chain.Top().EntryLink.String()+`"}`)
+
+		_, err = r.Call(&FunctionDef{Name: "addEven", CallingType: JSON_CALLING}, "41")
+		So(err.Error(), ShouldEqual, "Validation Failed: 41 is not even")
+	})
+}
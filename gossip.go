@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/holochain/holochain-proto/hash"
+	queue "github.com/holochain/holochain-proto/peerqueue"
 	peer "github.com/libp2p/go-libp2p-peer"
 	"github.com/tidwall/buntdb"
 	"math/rand"
@@ -28,12 +29,41 @@ type Put struct {
 // Gossip holds a gossip message
 type Gossip struct {
 	Puts []Put
+
+	// set by gossipers that answered a reconciliation request
+	Reconciled bool
+	MyIdx      int
+	Ranges     []int // hash ranges in which our holdings differ
+
+	// set when the puts were cut short by the gossip budget
+	More bool
+
+	// set instead of More when our gossip budget for the requester is used up, for how
+	// long they should wait before asking again
+	RetryAfter time.Duration
 }
 
 // GossipReq holds a gossip request
 type GossipReq struct {
 	MyIdx   int
 	YourIdx int
+
+	// reconciliation requests carry a summary of our holdings, and in the
+	// second round a filter of what we hold in the ranges that differ
+	Summary *GossipSummary
+	Ranges  []int
+	Filter  *BloomFilter
+
+	// the part of the hash space we hold, so we are only sent puts we need
+	Arc *ShardArc
+
+	// the most we want to receive in this round, 0 means no limit
+	MaxPuts  int
+	MaxBytes int
+
+	// when reconciling, the index of the last put received in earlier chunks so only
+	// puts after it are sent
+	After int
 }
 
 // we also gossip about peers too, keeping lists of different peers e.g. blockedlist etc
@@ -156,6 +186,10 @@ func (dht *DHT) getGossipers() (glist []peer.ID, err error) {
 		return
 	}
 	ns := dht.config.RedundancyFactor
+	if dht.ShardingMethod() == ShardingHashmask {
+		// our neighbours are those that share our prefix
+		glist = filterPeersByArc(glist, dht.ShardArc())
+	}
 	glist = dht.h.node.filterInactviePeers(glist, ns)
 	return
 }
@@ -195,21 +229,50 @@ func (dht *DHT) _getGossipers() (glist []peer.ID, err error) {
 	return
 }
 
-// FindGossiper picks a random DHT node to gossip with
+// FindGossiper picks a random DHT node to gossip with, preferring the faster of two
+// equally close candidates when latency measurements are available
 func (dht *DHT) FindGossiper() (g peer.ID, err error) {
 	var glist []peer.ID
 	glist, err = dht.getGossipers()
 	if err != nil {
 		return
 	}
+	ready := glist[:0]
+	for _, id := range glist {
+		if !dht.gossiperDeferred(id) {
+			ready = append(ready, id)
+		}
+	}
+	glist = ready
 	if len(glist) == 0 {
 		err = ErrDHTErrNoGossipersAvailable
 	} else {
 		g = glist[rand.Intn(len(glist))]
+		g = dht.fasterEquallyClosePeer(g, glist)
 	}
 	return
 }
 
+// fasterEquallyClosePeer compares a peer with another randomly chosen peer from the list
+// that is in the same k-bucket relative to us, and returns whichever has the lower latency
+func (dht *DHT) fasterEquallyClosePeer(p peer.ID, peers []peer.ID) peer.ID {
+	node := dht.h.node
+	cpl := commonPrefixLen(p, node.HashAddr)
+	var candidates []peer.ID
+	for _, c := range peers {
+		if c != p && commonPrefixLen(c, node.HashAddr) == cpl {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		return p
+	}
+	pq := queue.NewLatencyPQ(node.metrics)
+	pq.Enqueue(p)
+	pq.Enqueue(candidates[rand.Intn(len(candidates))])
+	return pq.Dequeue()
+}
+
 // AddGossiper adds a new gossiper to the gossiper store
 func (dht *DHT) AddGossiper(id peer.ID) (err error) {
 	// never add ourselves as a gossiper
@@ -261,6 +324,18 @@ func (dht *DHT) DeleteGossiper(id peer.ID) (err error) {
 	err = db.Update(func(tx *buntdb.Tx) error {
 		key := "peer:" + peer.IDB58Encode(id)
 		_, e := tx.Delete(key)
+		if e == nil {
+			// forget any reconciliation in progress or done too
+			for _, k := range []string{"reconcile:", "reconciled:"} {
+				_, e = tx.Delete(k + peer.IDB58Encode(id))
+				if e == buntdb.ErrNotFound {
+					e = nil
+				}
+				if e != nil {
+					break
+				}
+			}
+		}
 		return e
 	})
 	return
@@ -278,13 +353,32 @@ func GossipReceiver(h *Holochain, m *Message) (response interface{}, err error)
 		dht.glog.Logf("GossipReceiver got: %v", m)
 		switch t := m.Body.(type) {
 		case GossipReq:
-			dht.glog.Logf("%v wants my puts since %d and is at %d", m.From, t.YourIdx, t.MyIdx)
+			var g Gossip
+			if t.Summary != nil {
+				dht.glog.Logf("%v wants to reconcile holdings", m.From)
+				g, err = dht.reconcileReceiver(m.From, t)
+				if err != nil {
+					return
+				}
+				response = g
+				if t.Filter == nil && len(g.Ranges) > 0 {
+					// they'll be back with a filter for the differing ranges
+					return
+				}
+			} else {
+				dht.glog.Logf("%v wants my puts since %d and is at %d", m.From, t.YourIdx, t.MyIdx)
 
-			// give the gossiper what they want
-			var puts []Put
-			puts, err = h.dht.GetPuts(t.YourIdx)
-			g := Gossip{Puts: puts}
-			response = g
+				// give the gossiper what they want
+				g.MyIdx, err = h.dht.GetIdx()
+				if err != nil {
+					return
+				}
+				g.Puts, err = h.dht.GetPuts(t.YourIdx)
+				g.Puts = filterPutsByArc(g.Puts, t.Arc)
+				g.Puts, g.More, g.RetryAfter = dht.limitPuts(m.From, g.Puts, t.MaxPuts, t.MaxBytes)
+				response = g
+			}
+			puts := g.Puts
 
 			// check to see what we know they said, and if our record is less
 			// that where they are currently at, gossip back
@@ -320,17 +414,29 @@ func GossipReceiver(h *Holochain, m *Message) (response interface{}, err error)
 	return
 }
 
-// gossipWith gossips with a peer asking for everything after since
+// gossipWith gossips with a peer asking for everything after since, or if we haven't
+// gossiped with the peer before or for a while, reconciling our holdings with theirs
 func (dht *DHT) gossipWith(id peer.ID) (err error) {
 	// prevent rentrance
 	dht.glk.Lock()
 	defer dht.glk.Unlock()
 
+	if dht.gossiperDeferred(id) {
+		dht.glog.Logf("not gossiping with %v until its budget for us renews", id)
+		return
+	}
+
 	dht.glog.Logf("starting gossipWith %v", id)
 	defer func() {
 		dht.glog.Logf("finish gossipWith %v, err=%v", id, err)
 	}()
 
+	arc := dht.ShardArc()
+	err = dht.checkArcGrowth(arc)
+	if err != nil {
+		return
+	}
+
 	var myIdx, yourIdx int
 	myIdx, err = dht.GetIdx()
 	if err != nil {
@@ -342,14 +448,44 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 		return
 	}
 
-	var r interface{}
-	msg := dht.h.node.NewMessage(GOSSIP_REQUEST, GossipReq{MyIdx: myIdx, YourIdx: yourIdx + 1})
-	r, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
+	var gossip Gossip
+	var reconciled bool
+	req := GossipReq{
+		MyIdx:    myIdx,
+		YourIdx:  yourIdx + 1,
+		Arc:      arc,
+		MaxPuts:  dht.h.Config.GossipMaxPuts,
+		MaxBytes: dht.h.Config.GossipMaxBytes,
+	}
+	reconcile := yourIdx == 0
+	if !reconcile {
+		reconcile, err = dht.reconcileDue(id)
+		if err != nil {
+			return
+		}
+	}
+	if reconcile {
+		req.After, err = dht.getReconcileCursor(id)
+		if err != nil {
+			return
+		}
+		gossip, reconciled, err = dht.reconcileWith(id, req)
+	} else {
+		gossip, err = dht.sendGossipReq(id, req)
+	}
 	if err != nil {
 		return
 	}
 
-	gossip := r.(Gossip)
+	dht.h.node.connMgr.GossipedWith(id)
+
+	if gossip.RetryAfter > 0 {
+		dht.glog.Logf("%v has used up its gossip budget for us, it renews in %v", id, gossip.RetryAfter)
+		dht.deferGossiper(id, gossip.RetryAfter)
+		dht.adaptGossipInterval(id, 0, false)
+		return
+	}
+
 	puts := gossip.Puts
 
 	// gossiper has more stuff that we new about before so update the gossipers status
@@ -358,14 +494,49 @@ func (dht *DHT) gossipWith(id peer.ID) (err error) {
 	if count > 0 {
 		dht.glog.Logf("queuing %d puts:\n%v", count, puts)
 		var idx int
-		for i, p := range puts {
-			idx = i + yourIdx + 1
+		for _, p := range puts {
+			idx = p.Idx
 			// put the message into the gossip put handling queue so we can return quickly
 			dht.gossipPuts <- p
 		}
-		err = dht.UpdateGossiper(id, idx)
+		if stats := dht.ValidationQueueStats(); stats.Queued > 0 {
+			dht.glog.Logf("validation queue: %d queued, %d active", stats.Queued, stats.Active)
+		}
+		if !reconciled {
+			// puts outside our arc were skipped so unless the puts were cut
+			// short we are up to their index
+			if !gossip.More && gossip.MyIdx > idx {
+				idx = gossip.MyIdx
+			}
+			err = dht.UpdateGossiper(id, idx)
+		}
 	} else {
 		dht.glog.Log("no new puts received")
+		if !reconciled && req.Arc != nil && !gossip.More && gossip.MyIdx > yourIdx {
+			err = dht.UpdateGossiper(id, gossip.MyIdx)
+		}
+	}
+	dht.adaptGossipInterval(id, count, gossip.More)
+
+	if reconciled {
+		// unless the puts were cut short, in which case we'll reconcile again to get
+		// the rest, we now hold everything they did as of their index so carry on from there
+		if !gossip.More {
+			err = dht.UpdateGossiper(id, gossip.MyIdx)
+			if err == nil && req.After > 0 {
+				err = dht.setReconcileCursor(id, 0)
+			}
+			if err == nil {
+				err = dht.setReconciled(id)
+			}
+		} else if count > 0 {
+			err = dht.setReconcileCursor(id, puts[count-1].Idx)
+		}
+	} else if gossip.MyIdx > 0 && gossip.MyIdx < yourIdx {
+		// their change log is behind where we think it is so it's not the history
+		// we've been following, reconcile with them next time
+		dht.glog.Logf("%v index went back from %d to %d, resetting", id, yourIdx, gossip.MyIdx)
+		err = dht.resetGossiper(id)
 	}
 	return
 }
@@ -379,13 +550,18 @@ func (dht *DHT) gossipPut(p Put) (err error) {
 		dht.glog.Logf("PUT--%d (fingerprint: %v)", p.Idx, f)
 		exists, e := dht.HaveFingerprint(f)
 		if !exists && e == nil {
-			dht.glog.Logf("PUT--%d calling ActionReceiver", p.Idx)
-			r, e := ActionReceiver(dht.h, &p.M)
-			dht.glog.Logf("PUT--%d ActionReceiver returned %v with err %v", p.Idx, r, e)
-			if e != nil {
-				// put receiver error so do what? probably nothing because
-				// put will get retried
-			}
+			dht.glog.Logf("PUT--%d queuing for validation", p.Idx)
+			// don't wait for the put to be validated so other puts can be validated
+			// at the same time
+			m := p.M
+			dht.vpool.submit(validationKey(&m), func() {
+				r, e := receiveAction(dht.h, &m, 0)
+				dht.glog.Logf("PUT--%d ActionReceiver returned %v with err %v", p.Idx, r, e)
+				if e != nil {
+					// put receiver error so do what? probably nothing because
+					// put will get retried
+				}
+			})
 		} else {
 			if e == nil {
 				dht.glog.Logf("already have fingerprint %v", f)
@@ -421,6 +597,9 @@ func (dht *DHT) gossip() (err error) {
 // GossipTask runs a gossip and logs any errors
 func GossipTask(h *Holochain) {
 	if h.dht != nil && h.dht.gchan != nil {
+		if h.dht.skipGossip() {
+			return
+		}
 		err := h.dht.gossip()
 		if err != nil {
 			h.dht.glog.Logf("error: %v", err)
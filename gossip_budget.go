@@ -0,0 +1,231 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// gossip_budget implements limits on how much data is exchanged by gossip, so that a node
+// coming back online after a long time, or on a metered connection, isn't overwhelmed.
+// Gossip responses are sent in chunks, with the requester continuing from the index of the
+// last put it received, and the gossip interval backs off while there's nothing new.  Once
+// a peer's budget is used up it is told when to come back rather than being sent nothing,
+// and it doesn't gossip with us again until then.
+
+package holochain
+
+import (
+	peer "github.com/libp2p/go-libp2p-peer"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultGossipMaxPuts      = 500
+	DefaultGossipMaxBytes     = 1024 * 1024
+	DefaultGossipPeerMaxBytes = 10 * 1024 * 1024
+
+	// GossipPeerBudgetWindow is the period over which the per peer byte budget applies
+	GossipPeerBudgetWindow = time.Minute
+
+	// GossipMaxBackoff is how many gossip intervals we will wait at most between
+	// gossips when there's nothing new to be found
+	GossipMaxBackoff = 8
+)
+
+// peerBudget tracks how many bytes we've gossiped to a peer in the current window
+type peerBudget struct {
+	start time.Time
+	bytes int
+}
+
+// gossipBudget tracks per peer budgets and the adaptive gossip interval
+type gossipBudget struct {
+	lk        sync.Mutex
+	peers     map[peer.ID]*peerBudget
+	notBefore map[peer.ID]time.Time // when gossipers that told us to come back later renew
+	backoff   int                   // current multiple of the gossip interval
+	skip      int                   // gossip ticks left to skip
+}
+
+func newGossipBudget() *gossipBudget {
+	return &gossipBudget{peers: make(map[peer.ID]*peerBudget), notBefore: make(map[peer.ID]time.Time), backoff: 1}
+}
+
+// prune forgets the budgets and deferrals that have run out, b.lk must be held
+func (b *gossipBudget) prune() {
+	now := time.Now()
+	for id, pb := range b.peers {
+		if now.Sub(pb.start) > GossipPeerBudgetWindow {
+			delete(b.peers, id)
+		}
+	}
+	for id, t := range b.notBefore {
+		if !now.Before(t) {
+			delete(b.notBefore, id)
+		}
+	}
+}
+
+// minLimit returns the smaller of two limits where 0 means no limit
+func minLimit(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// putSize returns the number of bytes a put takes on the wire
+func putSize(p *Put) int {
+	b, err := ByteEncoder(&p.M)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// peerBytesLeft returns how many bytes we may still send a peer in the current window,
+// or -1 if there's no limit
+func (dht *DHT) peerBytesLeft(id peer.ID) int {
+	max := dht.h.Config.GossipPeerMaxBytes
+	if max <= 0 {
+		return -1
+	}
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	pb, ok := b.peers[id]
+	if !ok || time.Since(pb.start) > GossipPeerBudgetWindow {
+		return max
+	}
+	left := max - pb.bytes
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
+// peerBudgetResets returns how long it is until a peer's byte budget is renewed
+func (dht *DHT) peerBudgetResets(id peer.ID) time.Duration {
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	pb, ok := b.peers[id]
+	if !ok {
+		return 0
+	}
+	left := GossipPeerBudgetWindow - time.Since(pb.start)
+	if left < 0 {
+		left = 0
+	}
+	return left
+}
+
+// spendPeerBytes records bytes gossiped to a peer
+func (dht *DHT) spendPeerBytes(id peer.ID, bytes int) {
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	pb, ok := b.peers[id]
+	if !ok || time.Since(pb.start) > GossipPeerBudgetWindow {
+		b.prune()
+		pb = &peerBudget{start: time.Now()}
+		b.peers[id] = pb
+	}
+	pb.bytes += bytes
+}
+
+// deferGossiper records that a gossiper has used up its budget for us, so that we don't
+// gossip with it again until its budget renews
+func (dht *DHT) deferGossiper(id peer.ID, retryAfter time.Duration) {
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.prune()
+	b.notBefore[id] = time.Now().Add(retryAfter)
+}
+
+// gossiperDeferred returns true if a gossiper told us to come back later than now
+func (dht *DHT) gossiperDeferred(id peer.ID) bool {
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	t, ok := b.notBefore[id]
+	if ok && !time.Now().Before(t) {
+		delete(b.notBefore, id)
+		ok = false
+	}
+	return ok
+}
+
+// limitPuts cuts the puts to be sent to a peer down to the budget of the round and of
+// the peer, returning true if there are more puts to be sent.  Unless the peer's budget
+// is used up, at least one put is always sent so that gossip can't stall on a large put.
+// When it is used up nothing is sent and instead of more, the time until the peer's
+// budget is renewed is returned so that the peer doesn't keep asking.
+func (dht *DHT) limitPuts(id peer.ID, puts []Put, maxPuts int, maxBytes int) (limited []Put, more bool, retryAfter time.Duration) {
+	config := &dht.h.Config
+	maxPuts = minLimit(maxPuts, config.GossipMaxPuts)
+	maxBytes = minLimit(maxBytes, config.GossipMaxBytes)
+	peerLeft := dht.peerBytesLeft(id)
+
+	var n, bytes int
+	for n = 0; n < len(puts); n++ {
+		if maxPuts > 0 && n == maxPuts {
+			break
+		}
+		size := putSize(&puts[n])
+		// a put bigger than the peer's whole budget is sent on its own in a fresh window
+		fresh := n == 0 && peerLeft == config.GossipPeerMaxBytes
+		if peerLeft >= 0 && bytes+size > peerLeft && !fresh {
+			break
+		}
+		if n > 0 && maxBytes > 0 && bytes+size > maxBytes {
+			break
+		}
+		bytes += size
+	}
+	limited = puts[:n]
+	more = n < len(puts)
+	if bytes > 0 {
+		dht.spendPeerBytes(id, bytes)
+	}
+	if more && n == 0 {
+		more = false
+		retryAfter = dht.peerBudgetResets(id)
+		dht.glog.Logf("gossip budget of %v used up, sending nothing for %v", id, retryAfter)
+	} else if more {
+		dht.glog.Logf("gossip budget reached, sending %d of %d puts (%d bytes) to %v", n, len(puts), bytes, id)
+	}
+	return
+}
+
+// skipGossip returns true if the gossip task should skip this tick because
+// we've backed off from gossiping
+func (dht *DHT) skipGossip() bool {
+	b := dht.gbudget
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.skip > 0 {
+		b.skip--
+		return true
+	}
+	return false
+}
+
+// adaptGossipInterval gossips again right away if the gossiper has more for us, backs
+// off if there was nothing new, and returns to the normal interval when there was
+func (dht *DHT) adaptGossipInterval(id peer.ID, found int, more bool) {
+	b := dht.gbudget
+	b.lk.Lock()
+	if found > 0 || more {
+		b.backoff = 1
+	} else if b.backoff < GossipMaxBackoff {
+		b.backoff *= 2
+	}
+	b.skip = b.backoff - 1
+	b.lk.Unlock()
+
+	if more {
+		dht.glog.Logf("%v has more for us, continuing", id)
+		// we are called from the gossipWith handler so we can't block on its channel
+		dht.trySend(&dht.gchan, gossipWithReq{id})
+	}
+}
@@ -0,0 +1,400 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// gossip_reconcile implements set reconciliation of held data between gossipers so that
+// peers without a shared change history exchange only the puts the other is missing,
+// rather than replaying the entire change log from index 0.
+//
+// Reconciliation happens in two rounds.  First the requester sends a summary of the
+// fingerprints it holds split into hash ranges, and the responder replies with the ranges
+// in which its own summary differs.  Then the requester sends a bloom filter of its
+// fingerprints in those ranges and the responder replies with the puts that aren't in it.
+// Once reconciled we follow a gossiper's change log by index, but reconcile again every
+// GossipReconcileInterval to pick up any puts a bloom filter false positive kept from us.
+
+package holochain
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// GossipRanges is the number of hash ranges the fingerprint space is split into
+	GossipRanges = 16
+
+	// GossipBloomFalsePositiveRate is the target false positive rate of reconciliation
+	// bloom filters.  A false positive means a missing put is not sent, and as index gossip
+	// carries on after it, it's only picked up by a later reconciliation, where each filter
+	// having its own seed makes it unlikely to be a false positive again.
+	GossipBloomFalsePositiveRate = 0.01
+
+	// GossipReconcileInterval is how often we reconcile with a gossiper we follow by index
+	GossipReconcileInterval = 10 * time.Minute
+)
+
+// RangeSummary summarizes the fingerprints held within a hash range
+type RangeSummary struct {
+	Count  int
+	Digest []byte // XOR of the sha256 of each fingerprint so it's independent of order
+}
+
+// GossipSummary holds the summaries of all hash ranges of a node's held data
+type GossipSummary struct {
+	Ranges []RangeSummary
+}
+
+// BloomFilter is a simple bloom filter used to tell a gossiper which fingerprints we hold
+type BloomFilter struct {
+	Bits []byte
+	K    int
+	Seed uint64 // mixed into the hashes so each filter has different false positives
+}
+
+// NewBloomFilter returns a bloom filter sized for n items at the given false positive rate
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := int(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	k := int(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{Bits: make([]byte, (m+7)/8), K: k, Seed: rand.Uint64()}
+}
+
+// locations returns the bit positions for a key using double hashing
+func (b *BloomFilter) locations(key []byte) []uint64 {
+	f := fnv.New64a()
+	if b.Seed != 0 {
+		var seed [8]byte
+		binary.BigEndian.PutUint64(seed[:], b.Seed)
+		f.Write(seed[:])
+	}
+	f.Write(key)
+	sum := f.Sum64()
+	h1 := sum & 0xffffffff
+	h2 := sum >> 32
+	m := uint64(len(b.Bits) * 8)
+	locs := make([]uint64, b.K)
+	for i := 0; i < b.K; i++ {
+		locs[i] = (h1 + uint64(i)*h2) % m
+	}
+	return locs
+}
+
+// Add adds a key to the filter
+func (b *BloomFilter) Add(key []byte) {
+	for _, l := range b.locations(key) {
+		b.Bits[l/8] |= 1 << (l % 8)
+	}
+}
+
+// Has returns true if the key may be in the filter, and false if it definitely isn't
+func (b *BloomFilter) Has(key []byte) bool {
+	if len(b.Bits) == 0 {
+		return false
+	}
+	for _, l := range b.locations(key) {
+		if b.Bits[l/8]&(1<<(l%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// fingerprintRange returns the hash range a fingerprint falls in
+func fingerprintRange(f Hash) int {
+	b := []byte(f)
+	// skip the multihash code and length bytes
+	if len(b) < 3 {
+		return 0
+	}
+	return int(b[2]) * GossipRanges / 256
+}
+
+// walkFingerprints calls fn for each fingerprint we hold along with the index of the
+// change it made
+func (dht *DHT) walkFingerprints(tx *buntdb.Tx, fn func(f Hash, idx int) bool) error {
+	var err error
+	e := tx.Ascend("fingerprint", func(key, value string) bool {
+		var f Hash
+		f, err = NewHash(strings.TrimPrefix(key, "f:"))
+		if err != nil {
+			return false
+		}
+		var idx int
+		idx, err = strconv.Atoi(value)
+		if err != nil {
+			return false
+		}
+		return fn(f, idx)
+	})
+	if err != nil {
+		return err
+	}
+	return e
+}
+
+// GetGossipSummary returns a summary of the fingerprints we hold by hash range
+func (dht *DHT) GetGossipSummary() (summary GossipSummary, err error) {
+	summary.Ranges = make([]RangeSummary, GossipRanges)
+	for i := range summary.Ranges {
+		summary.Ranges[i].Digest = make([]byte, sha256.Size)
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		return dht.walkFingerprints(tx, func(f Hash, idx int) bool {
+			r := &summary.Ranges[fingerprintRange(f)]
+			r.Count++
+			d := sha256.Sum256([]byte(f))
+			for i := range d {
+				r.Digest[i] ^= d[i]
+			}
+			return true
+		})
+	})
+	return
+}
+
+// differingRanges returns the ranges in which the two summaries differ
+func differingRanges(mine, theirs GossipSummary) (ranges []int) {
+	for i := 0; i < GossipRanges; i++ {
+		if i >= len(mine.Ranges) || i >= len(theirs.Ranges) {
+			ranges = append(ranges, i)
+			continue
+		}
+		a, b := mine.Ranges[i], theirs.Ranges[i]
+		if a.Count != b.Count || string(a.Digest) != string(b.Digest) {
+			ranges = append(ranges, i)
+		}
+	}
+	return
+}
+
+// GetGossipFilter returns a bloom filter of the fingerprints we hold in the given ranges
+func (dht *DHT) GetGossipFilter(ranges []int) (filter *BloomFilter, err error) {
+	want := make(map[int]bool)
+	for _, r := range ranges {
+		want[r] = true
+	}
+	var fingerprints []Hash
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		return dht.walkFingerprints(tx, func(f Hash, idx int) bool {
+			if want[fingerprintRange(f)] {
+				fingerprints = append(fingerprints, f)
+			}
+			return true
+		})
+	})
+	if err != nil {
+		return
+	}
+	filter = NewBloomFilter(len(fingerprints), GossipBloomFalsePositiveRate)
+	for _, f := range fingerprints {
+		filter.Add([]byte(f))
+	}
+	return
+}
+
+// GetMissingPuts returns the puts after the given index in the given ranges whose
+// fingerprints aren't in the filter
+func (dht *DHT) GetMissingPuts(ranges []int, filter *BloomFilter, after int) (puts []Put, err error) {
+	want := make(map[int]bool)
+	for _, r := range ranges {
+		want[r] = true
+	}
+	puts = make([]Put, 0)
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		err := dht.walkFingerprints(tx, func(f Hash, idx int) bool {
+			if idx <= after || !want[fingerprintRange(f)] || filter.Has([]byte(f)) {
+				return true
+			}
+			var value string
+			value, e = tx.Get("idx:" + strconv.Itoa(idx))
+			if e == buntdb.ErrNotFound {
+				e = nil
+				return true
+			}
+			if e != nil {
+				return false
+			}
+			p := Put{Idx: idx}
+			e = ByteDecoder([]byte(value), &p.M)
+			if e != nil {
+				return false
+			}
+			puts = append(puts, p)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	sort.Slice(puts, func(i, j int) bool { return puts[i].Idx < puts[j].Idx })
+	return
+}
+
+// reconcileReceiver handles the reconciliation rounds of a gossip request
+func (dht *DHT) reconcileReceiver(from peer.ID, t GossipReq) (g Gossip, err error) {
+	g.Reconciled = true
+	// get our index before collecting puts so anything added while we do
+	// will be picked up by later index gossip
+	g.MyIdx, err = dht.GetIdx()
+	if err != nil {
+		return
+	}
+	if t.Filter == nil {
+		var summary GossipSummary
+		summary, err = dht.GetGossipSummary()
+		if err != nil {
+			return
+		}
+		g.Ranges = differingRanges(summary, *t.Summary)
+		return
+	}
+	g.Puts, err = dht.GetMissingPuts(t.Ranges, t.Filter, t.After)
+	g.Puts = filterPutsByArc(g.Puts, t.Arc)
+	g.Puts, g.More, g.RetryAfter = dht.limitPuts(from, g.Puts, t.MaxPuts, t.MaxBytes)
+	return
+}
+
+// reconcileWith runs reconciliation with a gossiper returning the puts we are missing
+// and the gossiper's current index.  If the gossiper doesn't support reconciliation
+// it will have answered with index gossip, which is returned with reconciled false.
+func (dht *DHT) reconcileWith(id peer.ID, req GossipReq) (g Gossip, reconciled bool, err error) {
+	var summary GossipSummary
+	summary, err = dht.GetGossipSummary()
+	if err != nil {
+		return
+	}
+	req.Summary = &summary
+	g, err = dht.sendGossipReq(id, req)
+	if err != nil || !g.Reconciled {
+		return
+	}
+	reconciled = true
+	if len(g.Ranges) == 0 {
+		dht.glog.Logf("holdings match %v", id)
+		return
+	}
+	dht.glog.Logf("holdings differ from %v in %d ranges", id, len(g.Ranges))
+	req.Ranges = g.Ranges
+	req.Filter, err = dht.GetGossipFilter(g.Ranges)
+	if err != nil {
+		return
+	}
+	g, err = dht.sendGossipReq(id, req)
+	return
+}
+
+// sendGossipReq sends a gossip request to a gossiper and returns their gossip
+func (dht *DHT) sendGossipReq(id peer.ID, req GossipReq) (g Gossip, err error) {
+	var r interface{}
+	msg := dht.h.node.NewMessage(GOSSIP_REQUEST, req)
+	r, err = dht.h.Send(dht.h.node.ctx, GossipProtocol, id, msg, 0)
+	if err != nil {
+		return
+	}
+	var ok bool
+	g, ok = r.(Gossip)
+	if !ok {
+		err = ErrDHTUnexpectedTypeInBody
+	}
+	return
+}
+
+// resetGossiper forgets how far we've gossiped with a gossiper so that the next gossip
+// with them reconciles
+func (dht *DHT) resetGossiper(id peer.ID) (err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set("peer:"+peer.IDB58Encode(id), "0", nil)
+		if e != nil {
+			return e
+		}
+		_, e = tx.Delete("reconcile:" + peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+// getReconcileCursor returns the index of the last put a gossiper sent us while
+// reconciling, for continuing from when their puts were cut short
+func (dht *DHT) getReconcileCursor(id peer.ID) (idx int, err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		value, e := tx.Get("reconcile:" + peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		idx, e = strconv.Atoi(value)
+		return e
+	})
+	return
+}
+
+// reconcileDue returns true if it's time to reconcile with a gossiper we follow by index
+func (dht *DHT) reconcileDue(id peer.ID) (due bool, err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		value, e := tx.Get("reconciled:" + peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			due = true
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		var t int64
+		t, e = strconv.ParseInt(value, 10, 64)
+		if e != nil {
+			return e
+		}
+		due = time.Since(time.Unix(0, t)) >= GossipReconcileInterval
+		return nil
+	})
+	return
+}
+
+// setReconciled records that we've just finished reconciling with a gossiper
+func (dht *DHT) setReconciled(id peer.ID) (err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set("reconciled:"+peer.IDB58Encode(id), strconv.FormatInt(time.Now().UnixNano(), 10), nil)
+		return e
+	})
+	return
+}
+
+// setReconcileCursor records the index of the last put a gossiper sent us while reconciling
+func (dht *DHT) setReconcileCursor(id peer.ID, idx int) (err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set("reconcile:"+peer.IDB58Encode(id), strconv.Itoa(idx), nil)
+		return e
+	})
+	return
+}
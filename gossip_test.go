@@ -6,6 +6,8 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	ma "github.com/multiformats/go-multiaddr"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -496,3 +498,408 @@ func findNodeIdx(nodes []*Holochain, id peer.ID) int {
 	}
 	panic("bork!")
 }
+
+func TestBloomFilter(t *testing.T) {
+	Convey("a bloom filter should have everything added to it", t, func() {
+		b := NewBloomFilter(100, GossipBloomFalsePositiveRate)
+		for i := 0; i < 100; i++ {
+			b.Add([]byte(fmt.Sprintf("key%d", i)))
+		}
+		for i := 0; i < 100; i++ {
+			So(b.Has([]byte(fmt.Sprintf("key%d", i))), ShouldBeTrue)
+		}
+	})
+
+	Convey("a bloom filter should rarely have things not added to it", t, func() {
+		b := NewBloomFilter(100, GossipBloomFalsePositiveRate)
+		for i := 0; i < 100; i++ {
+			b.Add([]byte(fmt.Sprintf("key%d", i)))
+		}
+		falsePositives := 0
+		for i := 0; i < 1000; i++ {
+			if b.Has([]byte(fmt.Sprintf("other%d", i))) {
+				falsePositives++
+			}
+		}
+		So(falsePositives, ShouldBeLessThan, 50)
+	})
+
+	Convey("an empty bloom filter should have nothing", t, func() {
+		b := BloomFilter{}
+		So(b.Has([]byte("key")), ShouldBeFalse)
+	})
+
+	Convey("bloom filters should have their own false positives", t, func() {
+		b1 := NewBloomFilter(100, GossipBloomFalsePositiveRate)
+		b2 := NewBloomFilter(100, GossipBloomFalsePositiveRate)
+		So(b1.Seed, ShouldNotEqual, b2.Seed)
+		for i := 0; i < 100; i++ {
+			b1.Add([]byte(fmt.Sprintf("key%d", i)))
+			b2.Add([]byte(fmt.Sprintf("key%d", i)))
+		}
+		both := 0
+		for i := 0; i < 1000; i++ {
+			k := []byte(fmt.Sprintf("other%d", i))
+			if b1.Has(k) && b2.Has(k) {
+				both++
+			}
+		}
+		So(both, ShouldBeLessThan, 5)
+	})
+}
+
+func TestGossipSummary(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+
+	summary, err := dht.GetGossipSummary()
+	Convey("the summary should cover all the fingerprints we hold", t, func() {
+		So(err, ShouldBeNil)
+		So(len(summary.Ranges), ShouldEqual, GossipRanges)
+		count := 0
+		for _, r := range summary.Ranges {
+			count += r.Count
+		}
+		idx, _ := dht.GetIdx()
+		So(count, ShouldEqual, idx)
+	})
+
+	Convey("identical summaries should have no differing ranges", t, func() {
+		So(len(differingRanges(summary, summary)), ShouldEqual, 0)
+	})
+
+	Convey("adding data should change only the range it falls in", t, func() {
+		commit(h, "oddNumbers", "3")
+		after, err := dht.GetGossipSummary()
+		So(err, ShouldBeNil)
+		ranges := differingRanges(summary, after)
+		So(len(ranges), ShouldBeGreaterThan, 0)
+		So(len(ranges), ShouldBeLessThanOrEqualTo, 2)
+	})
+
+	Convey("missing puts should be those not in the filter", t, func() {
+		all := make([]int, GossipRanges)
+		for i := range all {
+			all[i] = i
+		}
+		puts, err := dht.GetMissingPuts(all, &BloomFilter{}, 0)
+		So(err, ShouldBeNil)
+		idx, _ := dht.GetIdx()
+		So(len(puts), ShouldEqual, idx)
+
+		filter, err := dht.GetGossipFilter(all)
+		So(err, ShouldBeNil)
+		puts, err = dht.GetMissingPuts(all, filter, 0)
+		So(err, ShouldBeNil)
+		So(len(puts), ShouldEqual, 0)
+	})
+
+	Convey("missing puts should only be those after the cursor", t, func() {
+		all := make([]int, GossipRanges)
+		for i := range all {
+			all[i] = i
+		}
+		puts, err := dht.GetMissingPuts(all, &BloomFilter{}, 2)
+		So(err, ShouldBeNil)
+		idx, _ := dht.GetIdx()
+		So(len(puts), ShouldEqual, idx-2)
+		So(puts[0].Idx, ShouldEqual, 3)
+	})
+}
+
+func TestGossipReconcile(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	h1 := nodes[0]
+	h2 := nodes[1]
+
+	commit(h1, "oddNumbers", "3")
+	commit(h1, "oddNumbers", "5")
+	commit(h1, "oddNumbers", "7")
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+
+	Convey("first gossip with a peer should reconcile and carry on from their index", t, func() {
+		err := h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 5)
+		for i := 0; i < 5; i++ {
+			x := <-h2.dht.gossipPuts
+			handleGossipPut(h2.dht, x)
+		}
+		idx, _ := h2.dht.GetGossiper(h1.nodeID)
+		h1Idx, _ := h1.dht.GetIdx()
+		So(idx, ShouldEqual, h1Idx)
+	})
+
+	Convey("reconciling with a peer whose data we already hold should get no puts", t, func() {
+		err := h2.dht.resetGossiper(h1.nodeID)
+		So(err, ShouldBeNil)
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 0)
+	})
+
+	Convey("a peer we follow by index should be reconciled with again after a while", t, func() {
+		due, err := h2.dht.reconcileDue(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(due, ShouldBeFalse)
+
+		db := h2.dht.ht.(*BuntHT).db
+		err = db.Update(func(tx *buntdb.Tx) error {
+			then := time.Now().Add(-GossipReconcileInterval).UnixNano()
+			_, _, e := tx.Set("reconciled:"+peer.IDB58Encode(h1.nodeID), strconv.FormatInt(then, 10), nil)
+			return e
+		})
+		So(err, ShouldBeNil)
+		due, err = h2.dht.reconcileDue(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(due, ShouldBeTrue)
+
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		due, _ = h2.dht.reconcileDue(h1.nodeID)
+		So(due, ShouldBeFalse)
+		idx, _ := h2.dht.GetGossiper(h1.nodeID)
+		h1Idx, _ := h1.dht.GetIdx()
+		So(idx, ShouldEqual, h1Idx)
+	})
+
+	Convey("a peer whose index went backwards should be reconciled with next time", t, func() {
+		h1Idx, _ := h1.dht.GetIdx()
+		h2.dht.UpdateGossiper(h1.nodeID, h1Idx+10)
+		err := h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		idx, _ := h2.dht.GetGossiper(h1.nodeID)
+		So(idx, ShouldEqual, 0)
+	})
+}
+
+func TestGossipBudget(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+	commit(h, "oddNumbers", "3")
+	commit(h, "oddNumbers", "5")
+	puts, _ := dht.GetPuts(0)
+	p1, _ := makePeer("peer1")
+	p2, _ := makePeer("peer2")
+	h.Config.GossipMaxPuts = 0
+	h.Config.GossipMaxBytes = 0
+	h.Config.GossipPeerMaxBytes = 0
+
+	Convey("without limits all puts should be sent", t, func() {
+		limited, more, _ := dht.limitPuts(p1, puts, 0, 0)
+		So(len(limited), ShouldEqual, len(puts))
+		So(more, ShouldBeFalse)
+	})
+
+	Convey("puts should be limited by the requester's or our own budget", t, func() {
+		limited, more, _ := dht.limitPuts(p1, puts, 2, 0)
+		So(len(limited), ShouldEqual, 2)
+		So(more, ShouldBeTrue)
+		h.Config.GossipMaxPuts = 1
+		limited, more, _ = dht.limitPuts(p1, puts, 2, 0)
+		So(len(limited), ShouldEqual, 1)
+		So(more, ShouldBeTrue)
+		h.Config.GossipMaxPuts = 0
+	})
+
+	Convey("bytes should be limited but at least one put always sent", t, func() {
+		limited, more, _ := dht.limitPuts(p1, puts, 0, 1)
+		So(len(limited), ShouldEqual, 1)
+		So(more, ShouldBeTrue)
+		size := putSize(&puts[0]) + putSize(&puts[1])
+		limited, _, _ = dht.limitPuts(p1, puts, 0, size)
+		So(len(limited), ShouldEqual, 2)
+	})
+
+	Convey("puts should be limited by what's left of the peer's budget", t, func() {
+		size := putSize(&puts[0])
+		h.Config.GossipPeerMaxBytes = size
+		limited, more, retryAfter := dht.limitPuts(p2, puts, 0, 0)
+		So(len(limited), ShouldEqual, 1)
+		So(more, ShouldBeTrue)
+		So(retryAfter, ShouldEqual, 0)
+		So(dht.peerBytesLeft(p2), ShouldEqual, 0)
+	})
+
+	Convey("a peer whose budget is used up should be told when to come back", t, func() {
+		limited, more, retryAfter := dht.limitPuts(p2, puts, 0, 0)
+		So(len(limited), ShouldEqual, 0)
+		So(more, ShouldBeFalse)
+		So(retryAfter, ShouldBeGreaterThan, 0)
+		So(retryAfter, ShouldBeLessThanOrEqualTo, GossipPeerBudgetWindow)
+	})
+
+	Convey("a put bigger than a peer's whole budget should be sent on its own", t, func() {
+		p3, _ := makePeer("peer3")
+		h.Config.GossipPeerMaxBytes = 1
+		limited, more, retryAfter := dht.limitPuts(p3, puts, 0, 0)
+		So(len(limited), ShouldEqual, 1)
+		So(more, ShouldBeTrue)
+		So(retryAfter, ShouldEqual, 0)
+		h.Config.GossipPeerMaxBytes = 0
+	})
+
+	Convey("gossip should back off when nothing new is found", t, func() {
+		So(dht.skipGossip(), ShouldBeFalse)
+		dht.adaptGossipInterval(p1, 0, false)
+		So(dht.skipGossip(), ShouldBeTrue)
+		So(dht.skipGossip(), ShouldBeFalse)
+		dht.adaptGossipInterval(p1, 0, false)
+		for i := 0; i < 3; i++ {
+			So(dht.skipGossip(), ShouldBeTrue)
+		}
+		So(dht.skipGossip(), ShouldBeFalse)
+		for i := 0; i < 10; i++ {
+			dht.adaptGossipInterval(p1, 0, false)
+		}
+		So(dht.gbudget.skip, ShouldEqual, GossipMaxBackoff-1)
+	})
+
+	Convey("gossip should return to the normal interval when something is found", t, func() {
+		dht.adaptGossipInterval(p1, 1, false)
+		So(dht.skipGossip(), ShouldBeFalse)
+	})
+
+	Convey("gossip should continue right away when the gossiper has more", t, func() {
+		So(len(dht.gchan), ShouldEqual, 0)
+		dht.adaptGossipInterval(p1, 1, true)
+		So(len(dht.gchan), ShouldEqual, 1)
+		x := <-dht.gchan
+		So(x.(gossipWithReq).id, ShouldEqual, p1)
+	})
+
+	Convey("a gossiper should be skipped until it said to come back", t, func() {
+		So(dht.gossiperDeferred(p1), ShouldBeFalse)
+		dht.deferGossiper(p1, 50*time.Millisecond)
+		So(dht.gossiperDeferred(p1), ShouldBeTrue)
+		So(dht.gossipWith(p1), ShouldBeNil)
+		time.Sleep(60 * time.Millisecond)
+		So(dht.gossiperDeferred(p1), ShouldBeFalse)
+		So(len(dht.gbudget.notBefore), ShouldEqual, 0)
+	})
+
+	Convey("budgets that have run out should be forgotten", t, func() {
+		dht.gbudget.lk.Lock()
+		dht.gbudget.peers[p1] = &peerBudget{start: time.Now().Add(-2 * GossipPeerBudgetWindow)}
+		dht.gbudget.lk.Unlock()
+		dht.spendPeerBytes(p2, 1)
+		_, ok := dht.gbudget.peers[p1]
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("nothing should be sent once the DHT is closed", t, func() {
+		dht.chlk.Lock()
+		dht.closed = true
+		dht.chlk.Unlock()
+		So(dht.pushChange(changeReq{}), ShouldBeFalse)
+		dht.adaptGossipInterval(p1, 1, true)
+		So(len(dht.gchan), ShouldEqual, 0)
+		dht.closed = false
+	})
+}
+
+func TestGossipChunking(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	h1 := nodes[0]
+	h2 := nodes[1]
+
+	commit(h1, "oddNumbers", "3")
+	commit(h1, "oddNumbers", "5")
+	commit(h1, "oddNumbers", "7")
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+	h2.Config.GossipMaxPuts = 2
+
+	Convey("gossip should arrive in chunks continuing from the last put received", t, func() {
+		err := h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 2)
+		So(len(h2.dht.gchan), ShouldEqual, 1)
+		for i := 0; i < 2; i++ {
+			handleGossipPut(h2.dht, <-h2.dht.gossipPuts)
+		}
+		<-h2.dht.gchan
+
+		// still reconciling as we didn't get everything
+		idx, _ := h2.dht.GetGossiper(h1.nodeID)
+		So(idx, ShouldEqual, 0)
+
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 2)
+		for i := 0; i < 2; i++ {
+			handleGossipPut(h2.dht, <-h2.dht.gossipPuts)
+		}
+		<-h2.dht.gchan
+
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 1)
+		handleGossipPut(h2.dht, <-h2.dht.gossipPuts)
+		So(len(h2.dht.gchan), ShouldEqual, 0)
+
+		idx, _ = h2.dht.GetGossiper(h1.nodeID)
+		h1Idx, _ := h1.dht.GetIdx()
+		So(idx, ShouldEqual, h1Idx)
+	})
+
+	Convey("index gossip should be chunked too", t, func() {
+		commit(h1, "oddNumbers", "9")
+		commit(h1, "oddNumbers", "11")
+		commit(h1, "oddNumbers", "13")
+		err := h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 2)
+		<-h2.dht.gchan
+		err = h2.dht.gossipWith(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(len(h2.dht.gossipPuts), ShouldEqual, 3)
+		So(len(h2.dht.gchan), ShouldEqual, 0)
+	})
+}
+
+func TestGossipReconcileCursor(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	h1 := nodes[0]
+	h2 := nodes[1]
+
+	commit(h1, "oddNumbers", "3")
+	commit(h1, "oddNumbers", "5")
+	commit(h1, "oddNumbers", "7")
+	ringConnect(t, mt.ctx, mt.nodes, nodesCount)
+	h2.Config.GossipMaxPuts = 2
+
+	Convey("reconciliation chunks should continue after the last put even before it's held", t, func() {
+		last := 0
+		for _, expected := range []int{2, 2, 1} {
+			err := h2.dht.gossipWith(h1.nodeID)
+			So(err, ShouldBeNil)
+			So(len(h2.dht.gossipPuts), ShouldEqual, expected)
+			for i := 0; i < expected; i++ {
+				// don't handle the puts, as if they were still waiting to be validated
+				p := (<-h2.dht.gossipPuts).(Put)
+				So(p.Idx, ShouldBeGreaterThan, last)
+				last = p.Idx
+			}
+			if len(h2.dht.gchan) > 0 {
+				<-h2.dht.gchan
+			}
+		}
+		idx, _ := h2.dht.GetGossiper(h1.nodeID)
+		h1Idx, _ := h1.dht.GetIdx()
+		So(idx, ShouldEqual, h1Idx)
+		cursor, err := h2.dht.getReconcileCursor(h1.nodeID)
+		So(err, ShouldBeNil)
+		So(cursor, ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,285 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// handshake implements the exchange of version and DNA information between nodes when
+// they connect so that incompatible peers can be rejected with a clear reason instead
+// of failing obscurely when decoding messages they don't understand
+
+package holochain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Handshake holds the information nodes exchange about themselves on connection
+type Handshake struct {
+	Version  int
+	DNAHash  string
+	MsgTypes []MsgType
+}
+
+// IncompatiblePeer records a peer that was rejected during the handshake and why
+type IncompatiblePeer struct {
+	ID      peer.ID `json:"-"`
+	Version int
+	DNAHash string
+	Reason  string
+	When    time.Time
+}
+
+// handshakeTracker holds the results of handshakes with currently connected peers
+type handshakeTracker struct {
+	lk           sync.RWMutex
+	handshakes   map[peer.ID]Handshake
+	incompatible map[peer.ID]string
+
+	// shake runs the handshake with a peer, it's set by the holochain using the node
+	shake func(peer.ID) error
+}
+
+var ErrIncompatiblePeer = errors.New("incompatible peer")
+
+// HandshakeRequiredMsgTypes are the message types a peer must support for us to talk to it
+var HandshakeRequiredMsgTypes = []MsgType{
+	PUT_REQUEST,
+	DEL_REQUEST,
+	MOD_REQUEST,
+	GET_REQUEST,
+	LINK_REQUEST,
+	GETLINK_REQUEST,
+	GOSSIP_REQUEST,
+	VALIDATE_PUT_REQUEST,
+	VALIDATE_LINK_REQUEST,
+	VALIDATE_DEL_REQUEST,
+	VALIDATE_MOD_REQUEST,
+	APP_MESSAGE,
+	FIND_NODE_REQUEST,
+}
+
+// SupportedMsgTypes returns all the message types this version of holochain understands
+func SupportedMsgTypes() (types []MsgType) {
+	for t := ERROR_RESPONSE; t < _msgTypeCount; t++ {
+		types = append(types, t)
+	}
+	return
+}
+
+func newHandshakeTracker() *handshakeTracker {
+	return &handshakeTracker{
+		handshakes:   make(map[peer.ID]Handshake),
+		incompatible: make(map[peer.ID]string),
+	}
+}
+
+// handshake returns the handshake information of this node
+func (node *Node) handshake() Handshake {
+	return Handshake{
+		Version:  Version,
+		DNAHash:  node.dnaHash,
+		MsgTypes: SupportedMsgTypes(),
+	}
+}
+
+// IsIncompatible checks to see if a peer was rejected in a handshake
+func (node *Node) IsIncompatible(p peer.ID) (ok bool) {
+	node.hs.lk.RLock()
+	_, ok = node.hs.incompatible[p]
+	node.hs.lk.RUnlock()
+	return
+}
+
+// PeerHandshake returns the handshake information received from a peer if any
+func (node *Node) PeerHandshake(p peer.ID) (hs Handshake, ok bool) {
+	node.hs.lk.RLock()
+	hs, ok = node.hs.handshakes[p]
+	node.hs.lk.RUnlock()
+	return
+}
+
+func (node *Node) setHandshake(p peer.ID, hs Handshake) {
+	node.hs.lk.Lock()
+	node.hs.handshakes[p] = hs
+	delete(node.hs.incompatible, p)
+	node.hs.lk.Unlock()
+}
+
+func (node *Node) setIncompatible(p peer.ID, reason string) {
+	node.hs.lk.Lock()
+	delete(node.hs.handshakes, p)
+	node.hs.incompatible[p] = reason
+	node.hs.lk.Unlock()
+}
+
+// handshakeWith runs the handshake with a peer the node connected to, if the node
+// belongs to a holochain
+func (node *Node) handshakeWith(p peer.ID) (err error) {
+	if node.hs.shake == nil {
+		return
+	}
+	err = node.hs.shake(p)
+	return
+}
+
+// forgetHandshake clears the handshake of a peer so that it happens again on reconnect
+func (node *Node) forgetHandshake(p peer.ID) {
+	node.hs.lk.Lock()
+	delete(node.hs.handshakes, p)
+	node.hs.lk.Unlock()
+}
+
+// checkHandshake returns the reason a peer is incompatible with us, or the empty string
+// if it's compatible
+func (h *Holochain) checkHandshake(hs Handshake) (reason string) {
+	if hs.DNAHash != h.node.dnaHash {
+		return fmt.Sprintf("DNA hash mismatch: peer has %s", hs.DNAHash)
+	}
+	required := h.nucleus.dna.RequiresVersion
+	if hs.Version < required {
+		return fmt.Sprintf("peer holochain version %d is below required version %d", hs.Version, required)
+	}
+	supported := make(map[MsgType]bool)
+	for _, t := range hs.MsgTypes {
+		supported[t] = true
+	}
+	var missing []string
+	for _, t := range HandshakeRequiredMsgTypes {
+		if !supported[t] {
+			missing = append(missing, t.String())
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("peer doesn't support message types: %s", strings.Join(missing, ", "))
+	}
+	return
+}
+
+// acceptHandshake checks the handshake of a peer and records the outcome
+func (h *Holochain) acceptHandshake(p peer.ID, hs Handshake) (err error) {
+	reason := h.checkHandshake(hs)
+	if reason != "" {
+		h.dht.dlog.Logf("rejecting incompatible peer %v: %s", p, reason)
+		h.rejectPeer(p, hs, reason)
+		return ErrIncompatiblePeer
+	}
+	if hs.Version != Version {
+		h.dht.dlog.Logf("peer %v is running holochain version %d (we are %d)", p, hs.Version, Version)
+	}
+	h.node.setHandshake(p, hs)
+	return h.dht.deleteIncompatiblePeer(p)
+}
+
+// Handshake exchanges version and DNA information with a peer, returning ErrIncompatiblePeer
+// if the peer was rejected by either side
+func (h *Holochain) Handshake(p peer.ID) (err error) {
+	if _, ok := h.node.PeerHandshake(p); ok {
+		return
+	}
+	msg := h.node.NewMessage(HANDSHAKE_REQUEST, h.node.handshake())
+	ctx, cancel := context.WithTimeout(h.node.ctx, DefaultSendTimeout)
+	defer cancel()
+	var r interface{}
+	r, err = h.Send(ctx, KademliaProtocol, p, msg, 0)
+	if err != nil && err != ErrIncompatiblePeer {
+		return
+	}
+	// a peer that rejects us answers with an error response carrying its handshake
+	rejected := err == ErrIncompatiblePeer
+	hs, ok := r.(Handshake)
+	if !ok && !rejected {
+		return ErrDHTUnexpectedTypeInBody
+	}
+	if ok {
+		err = h.acceptHandshake(p, hs)
+		if err != nil || !rejected {
+			return
+		}
+	}
+	// they rejected us even though we think they are fine, or without saying who they
+	// are, so take them at their word
+	h.dht.dlog.Logf("peer %v rejected our handshake", p)
+	h.rejectPeer(p, hs, "rejected by peer")
+	return ErrIncompatiblePeer
+}
+
+// rejectPeer records a peer as incompatible and stops routing to it
+func (h *Holochain) rejectPeer(p peer.ID, hs Handshake, reason string) {
+	h.node.setIncompatible(p, reason)
+	h.node.routingTable.Remove(p)
+	err := h.dht.addIncompatiblePeer(IncompatiblePeer{ID: p, Version: hs.Version, DNAHash: hs.DNAHash, Reason: reason, When: time.Now()})
+	if err != nil {
+		h.dht.dlog.Logf("error recording incompatible peer %v: %v", p, err)
+	}
+}
+
+// handshakeReceiver handles a HANDSHAKE_REQUEST responding with our own handshake information
+func handshakeReceiver(h *Holochain, m *Message) (response interface{}, err error) {
+	switch t := m.Body.(type) {
+	case Handshake:
+		response = h.node.handshake()
+		err = h.acceptHandshake(m.From, t)
+	default:
+		err = ErrDHTUnexpectedTypeInBody
+	}
+	return
+}
+
+// addIncompatiblePeer persists the record of a rejected peer
+func (dht *DHT) addIncompatiblePeer(rec IncompatiblePeer) (err error) {
+	var b []byte
+	b, err = json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set("incompatible:"+peer.IDB58Encode(rec.ID), string(b), nil)
+		return e
+	})
+	return
+}
+
+// deleteIncompatiblePeer removes the record of a rejected peer if there is one
+func (dht *DHT) deleteIncompatiblePeer(id peer.ID) (err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete("incompatible:" + peer.IDB58Encode(id))
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+// GetIncompatiblePeers returns the peers that were rejected during a handshake
+func (dht *DHT) GetIncompatiblePeers() (peers []IncompatiblePeer, err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		tx.Ascend("incompatible", func(key, value string) bool {
+			var rec IncompatiblePeer
+			e = json.Unmarshal([]byte(value), &rec)
+			if e != nil {
+				return false
+			}
+			x := strings.Split(key, ":")
+			rec.ID, e = peer.IDB58Decode(x[1])
+			if e != nil {
+				return false
+			}
+			peers = append(peers, rec)
+			return true
+		})
+		return e
+	})
+	return
+}
@@ -0,0 +1,140 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestCheckHandshake(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("our own handshake should be compatible", t, func() {
+		So(h.checkHandshake(h.node.handshake()), ShouldEqual, "")
+	})
+
+	Convey("a handshake with a different DNA hash should be incompatible", t, func() {
+		hs := h.node.handshake()
+		hs.DNAHash = "QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1"
+		So(h.checkHandshake(hs), ShouldContainSubstring, "DNA hash mismatch")
+	})
+
+	Convey("a handshake with a version lower than the DNA requires should be incompatible", t, func() {
+		hs := h.node.handshake()
+		hs.Version = h.nucleus.dna.RequiresVersion - 1
+		So(h.checkHandshake(hs), ShouldContainSubstring, "below required version")
+	})
+
+	Convey("a handshake missing required message types should be incompatible", t, func() {
+		hs := h.node.handshake()
+		hs.MsgTypes = []MsgType{PUT_REQUEST, GET_REQUEST}
+		So(h.checkHandshake(hs), ShouldContainSubstring, "GOSSIP_REQUEST")
+	})
+}
+
+func TestHandshakeReceiver(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	other, _ := makePeer("peer_other")
+
+	Convey("it should respond with our handshake to compatible peers", t, func() {
+		m := h.node.NewMessage(HANDSHAKE_REQUEST, h.node.handshake())
+		m.From = other
+		r, err := KademliaReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(r.(Handshake).Version, ShouldEqual, Version)
+		So(r.(Handshake).DNAHash, ShouldEqual, h.dnaHash.String())
+		_, ok := h.node.PeerHandshake(other)
+		So(ok, ShouldBeTrue)
+		So(h.node.IsIncompatible(other), ShouldBeFalse)
+	})
+
+	Convey("it should reject and record incompatible peers", t, func() {
+		hs := h.node.handshake()
+		hs.DNAHash = "some other dna"
+		m := h.node.NewMessage(HANDSHAKE_REQUEST, hs)
+		m.From = other
+		r, err := KademliaReceiver(h, m)
+		So(err, ShouldEqual, ErrIncompatiblePeer)
+		So(r.(Handshake).DNAHash, ShouldEqual, h.dnaHash.String())
+		So(h.node.IsIncompatible(other), ShouldBeTrue)
+
+		peers, err := h.dht.GetIncompatiblePeers()
+		So(err, ShouldBeNil)
+		So(len(peers), ShouldEqual, 1)
+		So(peers[0].ID, ShouldEqual, other)
+		So(peers[0].DNAHash, ShouldEqual, "some other dna")
+		So(peers[0].Reason, ShouldContainSubstring, "DNA hash mismatch")
+		So(peers[0].When.Before(time.Now()), ShouldBeTrue)
+	})
+
+	Convey("a later compatible handshake should clear the record", t, func() {
+		m := h.node.NewMessage(HANDSHAKE_REQUEST, h.node.handshake())
+		m.From = other
+		_, err := KademliaReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(h.node.IsIncompatible(other), ShouldBeFalse)
+		peers, err := h.dht.GetIncompatiblePeers()
+		So(err, ShouldBeNil)
+		So(len(peers), ShouldEqual, 0)
+	})
+}
+
+func TestHandshakeOnAddPeer(t *testing.T) {
+	nodesCount := 5
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+
+	Convey("compatible nodes should exchange handshakes when connecting", t, func() {
+		connect(t, mt.ctx, nodes[0], nodes[1])
+		hs, ok := nodes[0].node.PeerHandshake(nodes[1].nodeID)
+		So(ok, ShouldBeTrue)
+		So(hs.Version, ShouldEqual, Version)
+		_, ok = nodes[1].node.PeerHandshake(nodes[0].nodeID)
+		So(ok, ShouldBeTrue)
+	})
+
+	Convey("incompatible nodes should be rejected and not added to the routing table", t, func() {
+		nodes[2].node.dnaHash = "some other dna"
+		pi := nodes[2].node.peerstore.PeerInfo(nodes[2].nodeID)
+		err := nodes[0].AddPeer(pi)
+		So(err, ShouldEqual, ErrIncompatiblePeer)
+		So(nodes[0].node.IsIncompatible(nodes[2].nodeID), ShouldBeTrue)
+		So(nodes[0].node.routingTable.Find(nodes[2].nodeID), ShouldEqual, "")
+		_, err = nodes[0].node.Send(mt.ctx, ActionProtocol, nodes[2].nodeID, nodes[0].node.NewMessage(GET_REQUEST, GetReq{}))
+		So(err, ShouldEqual, ErrIncompatiblePeer)
+	})
+
+	Convey("peers that reject us should be recorded even if we think they are compatible", t, func() {
+		nodes[3].nucleus.dna.RequiresVersion = Version + 1
+		pi := nodes[3].node.peerstore.PeerInfo(nodes[3].nodeID)
+		err := nodes[0].AddPeer(pi)
+		So(err, ShouldEqual, ErrIncompatiblePeer)
+		So(nodes[0].node.IsIncompatible(nodes[3].nodeID), ShouldBeTrue)
+		peers, err := nodes[0].dht.GetIncompatiblePeers()
+		So(err, ShouldBeNil)
+		var rec IncompatiblePeer
+		for _, p := range peers {
+			if p.ID == nodes[3].nodeID {
+				rec = p
+			}
+		}
+		So(rec.Reason, ShouldEqual, "rejected by peer")
+		So(rec.Version, ShouldEqual, Version)
+	})
+
+	Convey("peers dialled outside of addPeer should be handshaken too", t, func() {
+		pi := nodes[4].node.peerstore.PeerInfo(nodes[4].nodeID)
+		nodes[1].node.peerstore.AddAddrs(pi.ID, pi.Addrs, PeerTTL)
+		So(nodes[1].node.host.Connect(mt.ctx, pi), ShouldBeNil)
+		So(nodes[1].node.handshakeWith(nodes[4].nodeID), ShouldBeNil)
+		_, ok := nodes[1].node.PeerHandshake(nodes[4].nodeID)
+		So(ok, ShouldBeTrue)
+
+		var node Node
+		node.hs = newHandshakeTracker()
+		So(node.handshakeWith(nodes[4].nodeID), ShouldBeNil)
+	})
+}
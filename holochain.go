@@ -54,20 +54,29 @@ type Loggers struct {
 
 // Config holds the non-DNA configuration for a holo-chain, from config file or environment variables
 type Config struct {
-	DHTPort          int
-	EnableMDNS       bool
-	PeerModeAuthor   bool
-	PeerModeDHTNode  bool
-	EnableNATUPnP    bool
-	EnableWorldModel bool
-	BootstrapServer  string
-	Loggers          Loggers
+	DHTPort             int
+	EnableMDNS          bool
+	PeerModeAuthor      bool
+	PeerModeDHTNode     bool
+	EnableNATUPnP       bool
+	EnableWorldModel    bool
+	BootstrapServer     string
+	ConnMgrHighWater    int // maximum number of peer connections before pruning, 0 means no limit
+	ConnMgrLowWater     int // number of peer connections to prune down to
+	GossipMaxPuts       int // maximum number of puts exchanged in a gossip round, 0 means no limit
+	GossipMaxBytes      int // maximum bytes of puts exchanged in a gossip round, 0 means no limit
+	GossipPeerMaxBytes  int // maximum bytes of puts gossiped to any one peer per minute, 0 means no limit
+	ValidationCacheSize int // maximum number of validation responses and outcomes cached, 0 disables caching
+	ValidationWorkers   int // number of incoming changes validated concurrently, 0 validates them as received
+	RibosomePoolSize    int // number of idle ribosomes kept per zome for reuse, 0 disables pooling
+	Loggers             Loggers
 
 	holdingCheckInterval     time.Duration
 	gossipInterval           time.Duration
 	bootstrapRefreshInterval time.Duration
 	routingRefreshInterval   time.Duration
 	retryInterval            time.Duration
+	pingInterval             time.Duration
 }
 
 // Progenitor holds data on the creator of the DNA
@@ -99,6 +108,8 @@ type Holochain struct {
 	gossipProtocol   *Protocol
 	actionProtocol   *Protocol
 	asyncSends       chan error
+	ribosomes        *ribosomePool
+	schedules        *schedules
 }
 
 func (h *Holochain) Nucleus() (n *Nucleus) {
@@ -194,6 +205,9 @@ func InitializeHolochain() {
 		gob.Register(FindNodeReq{})
 		gob.Register(CloserPeersResp{})
 		gob.Register(PeerInfo{})
+		gob.Register(PingReq{})
+		gob.Register(PingResp{})
+		gob.Register(Handshake{})
 
 		RegisterBultinRibosomes()
 
@@ -288,6 +302,14 @@ func (h *Holochain) createNode() (err error) {
 	}
 	listenaddr := fmt.Sprintf("/ip4/%s/tcp/%d", ip, h.Config.DHTPort)
 	h.node, err = NewNode(listenaddr, h.dnaHash.String(), h.Agent().(*LibP2PAgent), h.Config.EnableNATUPnP, &h.Config.Loggers.Debug)
+	if err != nil {
+		return
+	}
+	h.node.hs.shake = h.Handshake
+	h.node.connMgr.SetWatermarks(h.Config.ConnMgrLowWater, h.Config.ConnMgrHighWater)
+	if rf := h.RedundancyFactor(); rf > 0 {
+		h.node.connMgr.SetNeighbourhoodSize(rf)
+	}
 	return
 }
 
@@ -306,6 +328,8 @@ func (h *Holochain) Prepare() (err error) {
 	}
 
 	h.asyncSends = make(chan error, 10)
+	h.ribosomes = newRibosomePool(h.Config.RibosomePoolSize)
+	h.schedules = newSchedules()
 
 	err = h.createNode()
 	if err != nil {
@@ -540,6 +564,7 @@ func (config *Config) Setup() (err error) {
 	config.bootstrapRefreshInterval = BootstrapTTL
 	config.routingRefreshInterval = DefaultRoutingRefreshInterval
 	config.retryInterval = DefaultRetryInterval
+	config.pingInterval = DefaultPingInterval
 	err = config.SetupLogging()
 	return
 }
@@ -666,10 +691,11 @@ func (h *Holochain) GetPrivateEntryDefs() (privateDefs []EntryDef) {
 
 // Call executes an exposed function
 func (h *Holochain) Call(zomeType string, function string, arguments interface{}, exposureContext string) (result interface{}, err error) {
-	n, z, err := h.MakeRibosome(zomeType)
+	n, z, err := h.GetRibosome(zomeType)
 	if err != nil {
 		return
 	}
+	defer h.ReleaseRibosome(z, n)
 	fn, err := z.GetFunctionDef(function)
 	if err != nil {
 		return
@@ -678,7 +704,15 @@ func (h *Holochain) Call(zomeType string, function string, arguments interface{}
 		err = errors.New("function not available")
 		return
 	}
+	err = fn.ValidateInput(z.Name, arguments)
+	if err != nil {
+		return
+	}
 	result, err = n.Call(fn, arguments)
+	if err != nil {
+		return
+	}
+	err = fn.ValidateOutput(z.Name, result)
 	return
 }
 
@@ -719,6 +753,7 @@ func (h *Holochain) GetZome(zName string) (z *Zome, err error) {
 
 // Close releases the resources associated with a holochain
 func (h *Holochain) Close() {
+	h.stopSchedules()
 	if h.chain != nil {
 		h.chain.Close()
 		h.chain = nil
@@ -792,8 +827,9 @@ func (h *Holochain) SendAsync(proto int, to peer.ID, msg *Message, callback *Cal
 		response, err = h.Send(h.node.ctx, proto, to, msg, timeout)
 		if err == nil {
 			var r Ribosome
-			r, _, err := h.MakeRibosome(callback.zomeType)
+			r, z, err := h.GetRibosome(callback.zomeType)
 			if err == nil {
+				defer h.ReleaseRibosome(z, r)
 				switch t := response.(type) {
 				case AppMsg:
 					//var result interface{}
@@ -837,10 +873,12 @@ func (h *Holochain) TaskTicker(interval time.Duration, fn func(h *Holochain)) ch
 
 // StartBackgroundTasks sets the various background processes in motion
 func (h *Holochain) StartBackgroundTasks() {
+	h.DHT().vpool.start(h.Config.ValidationWorkers)
 	go h.DHT().HandleGossipPuts()
 	go h.DHT().HandleGossipWiths()
 	go h.HandleAsyncSends()
 	go h.DHT().HandleChangeRequests()
+	go h.DHT().HandleDHTEvents()
 
 	if h.Config.gossipInterval > 0 {
 		h.node.stoppers[GossipingStopper] = h.TaskTicker(h.Config.gossipInterval, GossipTask)
@@ -852,6 +890,14 @@ func (h *Holochain) StartBackgroundTasks() {
 		h.node.stoppers[HoldingStopper] = h.TaskTicker(h.Config.holdingCheckInterval, HoldingTask)
 	}
 
+	err := h.dht.ReplayQueues()
+	if err != nil {
+		h.dht.dlog.Logf("error replaying queues: %v", err)
+	}
+	err = h.dht.PurgeValidationCache()
+	if err != nil {
+		h.dht.dlog.Logf("error purging validation cache: %v", err)
+	}
 	h.node.stoppers[RetryingStopper] = h.TaskTicker(h.Config.retryInterval, RetryTask)
 	if h.Config.BootstrapServer != "" {
 		go BootstrapRefreshTask(h)
@@ -859,6 +905,11 @@ func (h *Holochain) StartBackgroundTasks() {
 	}
 
 	h.node.stoppers[RefreshingStopper] = h.TaskTicker(h.Config.routingRefreshInterval, RoutingRefreshTask)
+	h.node.stoppers[PingingStopper] = h.TaskTicker(h.Config.pingInterval, PingTask)
+
+	if err = h.StartSchedules(); err != nil {
+		h.Config.Loggers.App.Logf("error starting schedules: %v", err)
+	}
 }
 
 // BootstrapRefreshTask refreshes our node and gets nodes from the bootstrap server
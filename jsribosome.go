@@ -12,6 +12,8 @@ import (
 	. "github.com/holochain/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
 	"github.com/robertkrimen/otto"
+	"github.com/robertkrimen/otto/parser"
+	"path"
 	"strings"
 	"time"
 )
@@ -21,6 +23,10 @@ const (
 
 	ErrHandlingReturnErrorsStr = "returnErrorValue"
 	ErrHandlingThrowErrorsStr  = "throwErrors"
+
+	// jsModulesVar is the global holding the module objects of the modules required so
+	// far, which is kept in the VM so that it's part of the VM's snapshot
+	jsModulesVar = "__hcModules"
 )
 
 // JSRibosome holds data needed for the Javascript VM
@@ -29,6 +35,8 @@ type JSRibosome struct {
 	zome       *Zome
 	vm         *otto.Otto
 	lastResult *otto.Value
+	snapshot   *otto.Otto // copy of the VM after the zome's code was run, for resetting to
+	timedOut   bool       // set when code was interrupted, which may leave the VM inconsistent
 }
 
 // Type returns the string value under which this ribosome is registered
@@ -41,6 +49,18 @@ func (jsr *JSRibosome) ChainGenesis() (err error) {
 	return
 }
 
+// Reset prepares the ribosome to be reused by going back to a copy of the VM as it was
+// after the zome's code was run, so nothing a use did is seen by the next.  It can't be
+// reused after code was interrupted.
+func (jsr *JSRibosome) Reset() bool {
+	if jsr.timedOut || jsr.snapshot == nil {
+		return false
+	}
+	jsr.vm = jsr.snapshot.Copy()
+	jsr.lastResult = nil
+	return true
+}
+
 // BridgeGenesis runs the bridging genesis function
 // this function gets called on both sides of the bridging
 func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
@@ -48,12 +68,76 @@ func (jsr *JSRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err e
 	return
 }
 
+// errJSTimeout is raised by the interrupt that stops code running past its budget
+var errJSTimeout = errors.New("javascript execution timed out")
+
+// run runs code within the DNA's execution budget for the callback type
+func (jsr *JSRibosome) run(callbackType string, fnName string, src interface{}) (v otto.Value, err error) {
+	budget := jsr.h.executionBudget(callbackType)
+	jsr.vm.SetStackDepthLimit(budget.MaxStackDepth)
+	timeout := budget.timeout()
+	if timeout == 0 {
+		v, err = jsr.vm.Run(src)
+		if err != nil {
+			err = jsr.jsError(fnName, err)
+		}
+		return
+	}
+	interrupt := make(chan func(), 1)
+	jsr.vm.Interrupt = interrupt
+	timer := time.AfterFunc(timeout, func() {
+		interrupt <- func() { panic(errJSTimeout) }
+	})
+	defer func() {
+		timer.Stop()
+		jsr.vm.Interrupt = nil
+		if caught := recover(); caught != nil {
+			if caught != errJSTimeout {
+				panic(caught)
+			}
+			jsr.timedOut = true
+			err = &ExecutionTimeoutError{Zome: jsr.zome.Name, Callback: fnName, Timeout: timeout}
+		}
+	}()
+	v, err = jsr.vm.Run(src)
+	if err != nil {
+		err = jsr.jsError(fnName, err)
+	}
+	return
+}
+
+// codeFile returns the name of the zome's code file relative to the DNA directory,
+// which is what error locations in the zome's code are reported against
+func (jsr *JSRibosome) codeFile(name string) string {
+	return path.Join(jsr.zome.Name, name)
+}
+
+// jsError converts an error from otto into a RibosomeError holding where in the zome's
+// code it happened
+func (jsr *JSRibosome) jsError(fnName string, err error) error {
+	e := &RibosomeError{Zome: jsr.zome.Name, Function: fnName, Message: err.Error()}
+	switch t := err.(type) {
+	case *otto.Error:
+		e.Stack = parseJSStack(t.String())
+		e.locate()
+	case parser.ErrorList:
+		if len(t) > 0 {
+			e.File, e.Line, e.Column = t[0].Position.Filename, t[0].Position.Line, t[0].Position.Column
+		}
+	case *parser.Error:
+		e.File, e.Line, e.Column = t.Position.Filename, t.Position.Line, t.Position.Column
+	default:
+		return err
+	}
+	return e
+}
+
 func (jsr *JSRibosome) boolFn(fnName string, args string) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(fnName + "(" + args + ")")
+	v, err = jsr.run(CallbackTypeGenesis, fnName, fnName+"("+args+")")
 
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	if v.IsBoolean() {
@@ -80,9 +164,9 @@ func (jsr *JSRibosome) Receive(from string, msg string) (response string, err er
 	code = fmt.Sprintf(`JSON.stringify(%s("%s",JSON.parse("%s")))`, fnName, from, jsSanitizeString(msg))
 	jsr.h.Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(CallbackTypeReceive, fnName, code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	response, err = v.ToString()
@@ -102,9 +186,9 @@ func (jsr *JSRibosome) BundleCanceled(reason string) (response string, err error
 	code = fmt.Sprintf(`%s("%s",JSON.parse("%s"))`, fnName, jsSanitizeString(reason), jsSanitizeString(bundle.userParam))
 	jsr.h.Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(CallbackTypeBundleCanceled, fnName, code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	response, err = v.ToString()
@@ -118,9 +202,9 @@ func (jsr *JSRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	code = fmt.Sprintf(`%s("%s")`, fnName, def.Name)
 	jsr.h.Debug(code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(CallbackTypeValidate, fnName, code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	if v.IsObject() {
@@ -204,15 +288,15 @@ func buildJSValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 	srcs := mkJSSources(sources)
 
 	var pkgObj string
-	if pkg == nil || pkg.Chain == nil {
+	if p := pkg.appPackage(); p == nil {
 		pkgObj = "{}"
 	} else {
 		var j []byte
-		j, err = json.Marshal(pkg.Chain)
+		j, err = json.Marshal(p)
 		if err != nil {
 			return
 		}
-		pkgObj = fmt.Sprintf(`{"Chain":%s}`, j)
+		pkgObj = string(j)
 	}
 	code = fmt.Sprintf(`%s("%s",%s,%s,%s)`, fnName, def.Name, args, pkgObj, srcs)
 
@@ -257,9 +341,9 @@ func (jsr *JSRibosome) prepareJSValidateEntryArgs(def *EntryDef, entry Entry, so
 
 func (jsr *JSRibosome) runValidate(fnName string, code string) (err error) {
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(CallbackTypeValidate, fnName, code)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	if v.IsBoolean() {
@@ -332,6 +416,9 @@ const (
 		"}" +
 		`,LinkAction:{Add:"` + AddLinkAction + `",Del:"` + DelLinkAction + `"}` +
 		`,PkgReq:{Chain:"` + PkgReqChain + `"` +
+		`,Types:"` + PkgReqEntryTypes + `"` +
+		`,Entries:"` + PkgReqEntries + `"` +
+		`,Fields:"` + PkgReqFields + `"` +
 		`,ChainOpt:{None:` + PkgReqChainOptNoneStr +
 		`,Headers:` + PkgReqChainOptHeadersStr +
 		`,Entries:` + PkgReqChainOptEntriesStr +
@@ -381,14 +468,20 @@ func (jsr *JSRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	}
 	jsr.h.Debugf("JS Call: %s", code)
 	var v otto.Value
-	v, err = jsr.vm.Run(code)
+	v, err = jsr.run(CallbackTypeCall, fn.Name, code)
 	if err == nil {
 		if v.IsObject() && v.Class() == "Error" {
 			jsr.h.Debugf("JS Error:\n%v", v)
-			var message otto.Value
+			var message, stack otto.Value
 			message, err = v.Object().Get("message")
 			if err == nil {
-				err = errors.New(message.String())
+				e := &RibosomeError{Zome: jsr.zome.Name, Function: fn.Name, Message: message.String()}
+				stack, err = v.Object().Get("stack")
+				if err == nil && stack.IsString() {
+					e.Stack = parseJSStack(stack.String())
+					e.locate()
+				}
+				err = e
 			}
 		} else {
 			result, err = v.ToString()
@@ -639,6 +732,67 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return result, nil
 			},
 		},
+		"subscribe": fnData{
+			apiFn: &APIFnSubscribe{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnSubscribe)
+				f.zome = zome.Name
+				f.filter, err = subscriptionFilterFromMap(args[0].value.(map[string]interface{}))
+				if err != nil {
+					return
+				}
+				f.callback = args[1].value.(string)
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result, err = jsr.vm.ToValue(r)
+				return
+			},
+		},
+		"unsubscribe": fnData{
+			apiFn: &APIFnUnsubscribe{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnUnsubscribe)
+				f.id = args[0].value.(string)
+				_, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result = otto.UndefinedValue()
+				return
+			},
+		},
+		"schedule": fnData{
+			apiFn: &APIFnSchedule{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnSchedule)
+				f.zome = zome.Name
+				f.function = args[0].value.(string)
+				f.interval = args[1].value.(string)
+				_, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result = otto.UndefinedValue()
+				return
+			},
+		},
+		"unschedule": fnData{
+			apiFn: &APIFnUnschedule{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnUnschedule)
+				f.zome = zome.Name
+				f.function = args[0].value.(string)
+				_, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result = otto.UndefinedValue()
+				return
+			},
+		},
 		"getBridges": fnData{
 			apiFn: &APIFnGetBridges{},
 			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
@@ -665,6 +819,53 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return
 			},
 		},
+		"getAgent": fnData{
+			apiFn: &APIFnGetAgent{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnGetAgent)
+				f.agent = args[0].value.(Hash)
+				f.options = nil
+				if len(call.ArgumentList) == 2 {
+					if opts, ok := args[1].value.(map[string]interface{}); ok {
+						if f.options, err = getAgentOptionsFromMap(opts); err != nil {
+							return
+						}
+					}
+				}
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				var j []byte
+				j, err = json.Marshal(r)
+				if err != nil {
+					return
+				}
+				object, _ := jsr.vm.Object(string(j))
+				result, _ = jsr.vm.ToValue(object)
+				return
+			},
+		},
+		"getPendingValidations": fnData{
+			apiFn: &APIFnGetPendingValidations{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnGetPendingValidations)
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				var j []byte
+				j, err = json.Marshal(r)
+				if err != nil {
+					return
+				}
+				object, _ := jsr.vm.Object(string(j))
+				result, _ = jsr.vm.ToValue(object)
+				return
+			},
+		},
 		"sign": fnData{
 			apiFn: &APIFnSign{},
 			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
@@ -702,6 +903,35 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 				return
 			},
 		},
+		"encrypt": fnData{
+			apiFn: &APIFnEncrypt{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnEncrypt)
+				f.to = args[0].value.(Hash)
+				f.data = []byte(args[1].value.(string))
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result, err = jsr.vm.ToValue(r)
+				return
+			},
+		},
+		"decrypt": fnData{
+			apiFn: &APIFnDecrypt{},
+			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
+				f := _f.(*APIFnDecrypt)
+				f.data = args[0].value.(string)
+				var r interface{}
+				r, err = f.Call(h)
+				if err != nil {
+					return
+				}
+				result, err = jsr.vm.ToValue(r)
+				return
+			},
+		},
 		"send": fnData{
 			apiFn: &APIFnSend{},
 			f: func(args []Arg, _f APIFunction, call otto.FunctionCall) (result otto.Value, err error) {
@@ -1307,6 +1537,11 @@ func NewJSRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		}
 	}
 
+	err = jsr.vm.Set("require", jsr.requireFn(false, ""))
+	if err != nil {
+		return nil, err
+	}
+
 	l := JSLibrary
 	if h != nil {
 		l += fmt.Sprintf(`var App = {Name:"%s",DNA:{Hash:"%s"},Agent:{Hash:"%s",TopHash:"%s",String:"%s"},Key:{Hash:"%s"}};`, h.Name(), h.dnaHash, h.agentHash, h.agentTopHash, jsSanitizeString(string(h.Agent().Identity())), h.nodeIDStr)
@@ -1372,14 +1607,140 @@ function isErr(result) {
     return (result != null && (typeof result === 'object') && result.name == "` + HolochainErrorPrefix + `");
 }`
 
-	_, err = jsr.Run(l + zome.Code)
+	_, err = jsr.Run(l)
+	if err != nil {
+		return
+	}
+	// the zome's code is compiled on its own so that errors are reported against
+	// the lines of its file
+	var script *otto.Script
+	script, err = jsr.vm.Compile(jsr.codeFile(zome.CodeFileName()), zome.Code)
+	if err == nil {
+		_, err = jsr.runCode(CallbackTypeCall, "code", script)
+	} else {
+		err = prefixError("Error executing JavaScript: ", jsr.jsError("code", err))
+	}
 	if err != nil {
 		return
 	}
+	jsr.snapshot = jsr.vm.Copy()
 	n = &jsr
 	return
 }
 
+// requireFn returns the require function for code in dir of the zome, or of the shared
+// library if inLibrary is set
+func (jsr *JSRibosome) requireFn(inLibrary bool, dir string) func(call otto.FunctionCall) otto.Value {
+	return func(call otto.FunctionCall) otto.Value {
+		required, err := call.Argument(0).ToString()
+		var exports otto.Value
+		if err == nil {
+			exports, err = jsr.require(inLibrary, dir, required)
+		}
+		if err != nil {
+			panic(jsr.vm.MakeCustomError("Error", err.Error()))
+		}
+		return exports
+	}
+}
+
+// require returns the exports of a module, running its code the first time it's required
+func (jsr *JSRibosome) require(inLibrary bool, dir string, required string) (exports otto.Value, err error) {
+	if isLibraryModule(required) {
+		inLibrary = true
+		dir = ""
+	}
+	modules := jsr.zome.Modules
+	key := ""
+	if inLibrary {
+		modules = nil
+		if jsr.h != nil && jsr.h.nucleus != nil && jsr.h.nucleus.dna != nil {
+			modules = jsr.h.nucleus.dna.Library
+		}
+		key = DNALibraryDir + ":"
+	}
+	var name string
+	name, err = resolveModule(modules, dir, required, JSModuleSuffix)
+	if err != nil {
+		return
+	}
+	key += name
+
+	var loaded *otto.Object
+	loaded, err = jsr.loadedModules()
+	if err != nil {
+		return
+	}
+	var cached otto.Value
+	cached, err = loaded.Get(key)
+	if err != nil {
+		return
+	}
+	if cached.IsObject() {
+		return cached.Object().Get("exports")
+	}
+	file := jsr.codeFile(name)
+	if inLibrary {
+		file = path.Join(DNALibraryDir, name)
+	}
+	var fn otto.Value
+	var script *otto.Script
+	script, err = jsr.vm.Compile(file, "(function(module,exports,require){"+modules[name]+"\n})")
+	if err == nil {
+		fn, err = jsr.vm.Run(script)
+	}
+	if err != nil {
+		err = fmt.Errorf("error loading module %s: %v", name, err)
+		return
+	}
+	var module *otto.Object
+	module, err = jsr.vm.Object(`({exports:{}})`)
+	if err != nil {
+		return
+	}
+	var req otto.Value
+	req, err = jsr.vm.ToValue(jsr.requireFn(inLibrary, path.Dir(name)))
+	if err != nil {
+		return
+	}
+	exports, err = module.Get("exports")
+	if err != nil {
+		return
+	}
+
+	// cache the module before running it so that modules which require each other
+	// get the exports built so far rather than looping
+	if err = loaded.Set(key, module.Value()); err != nil {
+		return
+	}
+	_, err = fn.Call(otto.UndefinedValue(), module.Value(), exports, req)
+	if err != nil {
+		loaded.Set(key, otto.UndefinedValue())
+		return
+	}
+	return module.Get("exports")
+}
+
+// loadedModules returns the object holding the module objects of the modules required
+// so far, keyed by where the module came from and its name
+func (jsr *JSRibosome) loadedModules() (loaded *otto.Object, err error) {
+	var v otto.Value
+	v, err = jsr.vm.Get(jsModulesVar)
+	if err != nil {
+		return
+	}
+	if v.IsObject() {
+		loaded = v.Object()
+		return
+	}
+	loaded, err = jsr.vm.Object(`({})`)
+	if err != nil {
+		return
+	}
+	err = jsr.vm.Set(jsModulesVar, loaded)
+	return
+}
+
 func makeJSFN(jsr *JSRibosome, name string, data fnData) func(call otto.FunctionCall) (result otto.Value) {
 	return func(call otto.FunctionCall) (result otto.Value) {
 		var args []Arg
@@ -1399,11 +1760,18 @@ func makeJSFN(jsr *JSRibosome, name string, data fnData) func(call otto.Function
 
 // Run executes javascript code
 func (jsr *JSRibosome) Run(code string) (result interface{}, err error) {
-	v, err := jsr.vm.Run(code)
+	result, err = jsr.runCode(CallbackTypeCall, "code", code)
+	return
+}
+
+func (jsr *JSRibosome) runCode(callbackType string, fnName string, src interface{}) (result interface{}, err error) {
+	v, err := jsr.run(callbackType, fnName, src)
 	if err != nil {
-		errStr := err.Error()
-		if !strings.HasPrefix(errStr, "{") {
-			err = fmt.Errorf("Error executing JavaScript: " + errStr)
+		if IsExecutionTimeoutErr(err) {
+			return
+		}
+		if !strings.HasPrefix(err.Error(), "{") {
+			err = prefixError("Error executing JavaScript: ", err)
 		}
 		return
 	}
@@ -1416,7 +1784,7 @@ func (jsr *JSRibosome) RunAsyncSendResponse(response AppMsg, callback string, ca
 
 	code := fmt.Sprintf(`%s(JSON.parse("%s"),"%s")`, callback, jsSanitizeString(response.Body), jsSanitizeString(callbackID))
 	jsr.h.Debugf("Calling %s\n", code)
-	result, err = jsr.Run(code)
+	result, err = jsr.runCode(CallbackTypeReceive, callback, code)
 
 	return
 }
@@ -29,7 +29,7 @@ func TestNewJSRibosome(t *testing.T) {
 		defer CleanupTestChain(h, d)
 		v, err := NewJSRibosome(h, &Zome{RibosomeType: JSRibosomeType, Code: "\n1+ )"})
 		So(v, ShouldBeNil)
-		So(err.Error(), ShouldEqual, "Error executing JavaScript: (anonymous): Line 38:4 Unexpected token )")
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: .js: Line 2:4 Unexpected token )")
 	})
 
 	Convey("you can set the error handling configuration", t, func() {
@@ -242,6 +242,14 @@ func TestNewJSRibosome(t *testing.T) {
 			So(hash1.String(), ShouldEqual, profileHash.String())
 		})
 
+		Convey("getPendingValidations", func() {
+			_, err = z.Run(`getPendingValidations()`)
+			So(err, ShouldBeNil)
+			z := v.(*JSRibosome)
+			s, _ := z.lastResult.Export()
+			So(fmt.Sprintf("%v", s), ShouldEqual, "[]")
+		})
+
 		Convey("getBridges", func() {
 			_, err = z.Run(`getBridges()`)
 			So(err, ShouldBeNil)
@@ -323,6 +331,15 @@ func TestNewJSRibosome(t *testing.T) {
 			So(z.lastResult.String(), ShouldEqual, "false")
 		})
 
+		Convey("encrypt and decrypt", func() {
+			_, err := z.Run(fmt.Sprintf(`decrypt(encrypt("%s","secret"))`, h.agentHash.String()))
+			So(err, ShouldBeNil)
+			So(z.lastResult.String(), ShouldEqual, "secret")
+
+			_, err = z.Run(`decrypt("bogus")`)
+			So(err, ShouldNotBeNil)
+		})
+
 		Convey("call", func() {
 			// a string calling function
 			_, err := z.Run(`call("zySampleZome","addEven","432")`)
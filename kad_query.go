@@ -32,6 +32,9 @@ type dhtQuery struct {
 	qfunc       queryFunc // the function to execute per peer
 	concurrency int       // the concurrency parameter
 	log         *Logger
+
+	// if set, peers that are equally close to the key are queried in order of latency
+	metrics pstore.Metrics
 }
 
 type dhtQueryResult struct {
@@ -54,6 +57,13 @@ func (node *Node) newQuery(k Hash, f queryFunc) *dhtQuery {
 	}
 }
 
+// constructs a query which prefers lower latency peers among equally close ones
+func (node *Node) newLatencyQuery(k Hash, f queryFunc) *dhtQuery {
+	q := node.newQuery(k, f)
+	q.metrics = node.metrics
+	return q
+}
+
 // QueryFunc is a function that runs a particular query with a given peer.
 // It returns either:
 // - the value
@@ -96,9 +106,15 @@ type dhtQueryRunner struct {
 func newQueryRunner(q *dhtQuery) *dhtQueryRunner {
 	proc := process.WithParent(process.Background())
 	ctx := ctxproc.OnClosingContext(proc)
+	var pq queue.PeerQueue
+	if q.metrics != nil {
+		pq = queue.NewXORDistanceLatencyPQ(q.key, q.metrics)
+	} else {
+		pq = queue.NewXORDistancePQ(q.key)
+	}
 	return &dhtQueryRunner{
 		query:          q,
-		peersToQuery:   queue.NewChanQueue(ctx, queue.NewXORDistancePQ(q.key)),
+		peersToQuery:   queue.NewChanQueue(ctx, pq),
 		peersRemaining: todoctr.NewSyncCounter(),
 		peersSeen:      pset.New(),
 		rateLimit:      make(chan struct{}, q.concurrency),
@@ -269,6 +285,21 @@ func (r *dhtQueryRunner) queryPeer(proc process.Process, p peer.ID) {
 			<-r.rateLimit // need to grab it again, as we deferred.
 			return
 		}
+
+		// peers we dial here have to pass the handshake just like those added with addPeer
+		if err := r.query.node.handshakeWith(p); err == ErrIncompatiblePeer {
+			r.query.log.Logf("Dropping incompatible peer %v", p)
+			r.query.node.peerstore.ClearAddrs(p)
+			r.query.node.host.Network().ClosePeer(p)
+			r.Lock()
+			r.errs = append(r.errs, err)
+			r.Unlock()
+			<-r.rateLimit // need to grab it again, as we deferred.
+			return
+		} else if err != nil {
+			// peers that don't answer handshakes (i.e. older nodes) are given the benefit of the doubt
+			r.query.log.Logf("Handshake with peer %v failed (%v)", p, err)
+		}
 		<-r.rateLimit // need to grab it again, as we deferred.
 		r.query.log.Log("connected. dial success.")
 	}
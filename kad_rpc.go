@@ -18,7 +18,7 @@ import (
 	pstore "github.com/libp2p/go-libp2p-peerstore"
 	ma "github.com/multiformats/go-multiaddr"
 	_ "sync"
-	_ "time"
+	"time"
 )
 
 var ErrDHTUnexpectedTypeInBody error = errors.New("unexpected type in message body")
@@ -27,6 +27,16 @@ type FindNodeReq struct {
 	H Hash
 }
 
+// PingReq holds a latency measuring ping request
+type PingReq struct {
+	Sent time.Time
+}
+
+// PingResp holds the response to a ping, echoing back the time the ping was sent
+type PingResp struct {
+	Sent time.Time
+}
+
 // an encodable version of pstore.PeerInfo which gob doesn't like
 // also libp2p encodes other stuff like connection type into this
 // which we may have to do too.
@@ -73,6 +83,49 @@ func (node *Node) findPeerSingle(ctx context.Context, p peer.ID, hash Hash) (clo
 	return
 }
 
+// Ping sends a PING_REQUEST to a peer on the kademlia protocol and records
+// the measured round-trip time in the node's latency metrics
+func (node *Node) Ping(ctx context.Context, p peer.ID) (rtt time.Duration, err error) {
+	start := time.Now()
+	pmes := node.NewMessage(PING_REQUEST, PingReq{Sent: start})
+	var resp Message
+	resp, err = node.Send(ctx, KademliaProtocol, p, pmes)
+	if err != nil {
+		return
+	}
+	if _, ok := resp.Body.(PingResp); !ok {
+		err = ErrDHTUnexpectedTypeInBody
+		return
+	}
+	rtt = time.Since(start)
+	node.metrics.RecordLatency(p, rtt)
+	return
+}
+
+// Latency returns the moving average of measured round-trip times to a peer
+// or zero if the peer has never been measured
+func (node *Node) Latency(p peer.ID) time.Duration {
+	return node.metrics.LatencyEWMA(p)
+}
+
+// PingTask pings the peers in the routing table to keep their latency metrics fresh
+func PingTask(h *Holochain) {
+	node := h.node
+	if node == nil {
+		return
+	}
+	for _, p := range node.routingTable.ListPeers() {
+		ctx, cancel := context.WithTimeout(node.ctx, DefaultSendTimeout)
+		rtt, err := node.Ping(ctx, p)
+		cancel()
+		if err != nil {
+			node.log.Logf("ping of %v failed: %v", p, err)
+		} else {
+			node.log.Logf("ping of %v took %v", p, rtt)
+		}
+	}
+}
+
 // nearestPeersToHash returns the routing tables closest peers to a given hash
 func (node *Node) nearestPeersToHash(hash *Hash, count int) []peer.ID {
 	//	fmt.Printf("%v NearestPeers to %s: ", node.HashAddr.Pretty()[2:4], hash.String())
@@ -216,6 +269,15 @@ func KademliaReceiver(h *Holochain, m *Message) (response interface{}, err error
 		default:
 			err = ErrDHTUnexpectedTypeInBody
 		}
+	case HANDSHAKE_REQUEST:
+		response, err = handshakeReceiver(h, m)
+	case PING_REQUEST:
+		switch t := m.Body.(type) {
+		case PingReq:
+			response = PingResp{Sent: t.Sent}
+		default:
+			err = ErrDHTUnexpectedTypeInBody
+		}
 	default:
 		err = fmt.Errorf("message type %d not in holochain-kademlia protocol", int(m.Type))
 	}
@@ -123,3 +123,33 @@ func TestNodeBetterPeers(t *testing.T) {
 		//		fmt.Printf("%v", closest)
 	})
 }
+
+func TestNodePing(t *testing.T) {
+	nodesCount := 2
+	mt := setupMultiNodeTesting(nodesCount)
+	defer mt.cleanupMultiNodeTesting()
+	nodes := mt.nodes
+	node0 := nodes[0].node
+	node1 := nodes[1].node
+
+	Convey("a peer should start with no latency measurement", t, func() {
+		So(node0.Latency(node1.HashAddr), ShouldEqual, 0)
+	})
+
+	connect(t, mt.ctx, nodes[0], nodes[1])
+
+	Convey("Ping should measure and record latency to the peer", t, func() {
+		rtt, err := node0.Ping(mt.ctx, node1.HashAddr)
+		So(err, ShouldBeNil)
+		So(rtt, ShouldBeGreaterThan, 0)
+		So(node0.Latency(node1.HashAddr), ShouldBeGreaterThan, 0)
+	})
+
+	Convey("KademliaReceiver should echo ping requests", t, func() {
+		now := time.Now().Round(0)
+		m := node1.NewMessage(PING_REQUEST, PingReq{Sent: now})
+		r, err := KademliaReceiver(nodes[0], m)
+		So(err, ShouldBeNil)
+		So(r.(PingResp).Sent, ShouldEqual, now)
+	})
+}
@@ -83,6 +83,10 @@ const (
 	// Kademlia messages
 
 	FIND_NODE_REQUEST
+	PING_REQUEST
+	HANDSHAKE_REQUEST
+
+	_msgTypeCount
 )
 
 func (msgType MsgType) String() string {
@@ -102,7 +106,9 @@ func (msgType MsgType) String() string {
 		"VALIDATE_MOD_REQUEST",
 		"APP_MESSAGE",
 		"LISTADD_REQUEST",
-		"FIND_NODE_REQUEST"}[msgType]
+		"FIND_NODE_REQUEST",
+		"PING_REQUEST",
+		"HANDSHAKE_REQUEST"}[msgType]
 }
 
 var ErrBlockedListed = errors.New("node blockedlisted")
@@ -128,6 +134,7 @@ const (
 	BootstrappingStopper
 	RefreshingStopper
 	HoldingStopper
+	PingingStopper
 	_StopperCount
 )
 
@@ -141,6 +148,10 @@ type Node struct {
 	protocols    [_protocolCount]*Protocol
 	peerstore    pstore.Peerstore
 	routingTable *RoutingTable
+	metrics      pstore.Metrics
+	dnaHash      string
+	hs           *handshakeTracker
+	connMgr      *ConnManager
 	nat          *nat.NAT
 	log          *Logger
 
@@ -173,6 +184,7 @@ const (
 	DefaultRoutingRefreshInterval = time.Minute
 	DefaultGossipInterval         = time.Second * 2
 	DefaultHoldingCheckInterval   = time.Second * 30
+	DefaultPingInterval           = time.Second * 30
 )
 
 // implement peer found function for mdns discovery
@@ -217,6 +229,19 @@ func (h *Holochain) addPeer(pi pstore.PeerInfo, confirm bool) (err error) {
 	// attempt a connection to see if this is actually valid
 	if confirm {
 		err = h.node.host.Connect(h.node.ctx, pi)
+		if err == nil {
+			err = h.Handshake(pi.ID)
+			if err == ErrIncompatiblePeer {
+				h.node.peerstore.ClearAddrs(pi.ID)
+				h.node.host.Network().ClosePeer(pi.ID)
+				return
+			}
+			if err != nil {
+				// peers that don't answer handshakes (i.e. older nodes) are given the benefit of the doubt
+				h.dht.dlog.Logf("Handshake with peer %v failed (%v)\n", pi.ID, err)
+				err = nil
+			}
+		}
 	}
 	if err != nil {
 		h.dht.dlog.Logf("Clearing peer %v, connection failed (%v)\n", pi.ID, err)
@@ -411,6 +436,8 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 	ps.AddAddrs(nodeID, []ma.Multiaddr{n.NetAddr}, pstore.PermanentAddrTTL)
 
 	n.HashAddr = nodeID
+	n.dnaHash = protoMux
+	n.hs = newHandshakeTracker()
 	priv := agent.PrivKey()
 	ps.AddPrivKey(nodeID, priv)
 	ps.AddPubKey(nodeID, priv.GetPublic())
@@ -449,9 +476,10 @@ func NewNode(listenAddr string, protoMux string, agent *LibP2PAgent, enableNATUP
 
 	n.host = rhost.Wrap(bh, &n)
 
-	m := pstore.NewMetrics()
-	n.routingTable = NewRoutingTable(KValue, nodeID, time.Minute, m)
+	n.metrics = pstore.NewMetrics()
+	n.routingTable = NewRoutingTable(KValue, nodeID, time.Minute, n.metrics)
 	n.peers = make(map[peer.ID]*peerTracker)
+	n.connMgr = NewConnManager(&n, 0, 0, DefaultConnMgrGracePeriod)
 
 	node = &n
 
@@ -547,6 +575,8 @@ func (node *Node) StartProtocol(h *Holochain, proto int) (err error) {
 		} else {
 			if node.IsBlocked(s.Conn().RemotePeer()) {
 				err = ErrBlockedListed
+			} else if m.Type != HANDSHAKE_REQUEST && node.IsIncompatible(s.Conn().RemotePeer()) {
+				err = ErrIncompatiblePeer
 			}
 
 			if err == nil {
@@ -572,12 +602,24 @@ func (node *Node) Close() error {
 
 // Send delivers a message to a node via the given protocol
 func (node *Node) Send(ctx context.Context, proto int, addr peer.ID, m *Message) (response Message, err error) {
+	defer func() {
+		if err == nil {
+			node.connMgr.Active(addr)
+		} else if err != ErrBlockedListed && err != ErrIncompatiblePeer {
+			node.connMgr.Failed(addr)
+		}
+	}()
 
 	if node.IsBlocked(addr) {
 		err = ErrBlockedListed
 		return
 	}
 
+	if m.Type != HANDSHAKE_REQUEST && node.IsIncompatible(addr) {
+		err = ErrIncompatiblePeer
+		return
+	}
+
 	s, err := node.host.NewStream(ctx, addr, node.protocols[proto].ID)
 	if err != nil {
 		return
@@ -662,6 +704,7 @@ const (
 	ErrLinkNotFoundCode
 	ErrEntryTypeMismatchCode
 	ErrBlockedListedCode
+	ErrIncompatiblePeerCode
 )
 
 // NewErrorResponse encodes standard errors for transmitting
@@ -681,6 +724,8 @@ func NewErrorResponse(err error) (errResp ErrorResponse) {
 		errResp.Code = ErrEntryTypeMismatchCode
 	case ErrBlockedListed:
 		errResp.Code = ErrBlockedListedCode
+	case ErrIncompatiblePeer:
+		errResp.Code = ErrIncompatiblePeerCode
 	default:
 		errResp.Message = err.Error() //Code will be set to ErrUnknown by default cus it's 0
 	}
@@ -704,6 +749,8 @@ func (errResp ErrorResponse) DecodeResponseError() (err error) {
 		err = ErrEntryTypeMismatch
 	case ErrBlockedListedCode:
 		err = ErrBlockedListed
+	case ErrIncompatiblePeerCode:
+		err = ErrIncompatiblePeer
 	default:
 		err = errors.New(errResp.Message)
 	}
@@ -720,6 +767,11 @@ func (node *Node) Distance(id peer.ID) *big.Int {
 	return distance(id, HashFromPeerID(node.HashAddr))
 }
 
+// ConnManager returns the node's connection manager
+func (node *Node) ConnManager() *ConnManager {
+	return node.connMgr
+}
+
 // Context return node's context
 func (node *Node) Context() context.Context {
 	return node.ctx
@@ -37,6 +37,7 @@ func TestNodeConstants(t *testing.T) {
 		So(APP_MESSAGE, ShouldEqual, 14)
 		So(LISTADD_REQUEST, ShouldEqual, 15)
 		So(FIND_NODE_REQUEST, ShouldEqual, 16)
+		So(PING_REQUEST, ShouldEqual, 17)
 	})
 }
 
@@ -53,8 +53,9 @@ func (nn *netNotifiee) Connected(n inet.Network, v inet.Conn) {
 	}
 
 	// Check if canceled under the lock.
-	if ctx.Err() == nil {
+	if ctx.Err() == nil && !node.IsIncompatible(v.RemotePeer()) {
 		node.routingTable.Update(v.RemotePeer())
+		node.connMgr.Connected(v.RemotePeer())
 	}
 }
 
@@ -80,6 +81,8 @@ func (nn *netNotifiee) Disconnected(n inet.Network, v inet.Conn) {
 		delete(nn.peers, v.RemotePeer())
 		conn.cancel()
 		node.routingTable.Remove(v.RemotePeer())
+		node.forgetHandshake(v.RemotePeer())
+		node.connMgr.Disconnected(v.RemotePeer())
 	}
 }
 
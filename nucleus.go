@@ -23,13 +23,17 @@ type DNA struct {
 	DHTConfig                 DHTConfig
 	Progenitor                Progenitor
 	Zomes                     []Zome
+	ExecutionBudgets          *ExecutionBudgets
+	Library                   map[string]string // modules shared by the zomes, keyed by path in the library directory
 	propertiesSchemaValidator SchemaValidator
 }
 
 func (dna *DNA) check() (err error) {
 	if dna.RequiresVersion > Version {
 		err = fmt.Errorf("Chain requires Holochain version %d", dna.RequiresVersion)
+		return
 	}
+	err = checkShardingMethod(dna.DHTConfig.ShardingMethod)
 	return
 }
 
@@ -89,19 +93,43 @@ type AppMsg struct {
 
 // ActionReceiver handles messages on the action protocol
 func ActionReceiver(h *Holochain, msg *Message) (response interface{}, err error) {
-	return actionReceiver(h, msg, MaxRetries)
+	return actionReceiver(h, msg, 0)
 }
 
 func isRelatedHoldMessage(msg *Message) bool {
 	return msg.Type == MOD_REQUEST || msg.Type == DEL_REQUEST || msg.Type == LINK_REQUEST
 }
 
-func actionReceiver(h *Holochain, msg *Message, retries int) (response interface{}, err error) {
+// validatesInPool returns true for the changes that are validated in the validation pool,
+// other messages, like the queries validation itself makes, are handled as they arrive so
+// they can't end up waiting for a worker that is waiting on them
+func validatesInPool(msg *Message) bool {
+	switch msg.Type {
+	case PUT_REQUEST, MOD_REQUEST, DEL_REQUEST, LINK_REQUEST:
+		return true
+	}
+	return false
+}
+
+// actionReceiver validates changes in the validation pool and waits for the result,
+// handling any other message inline
+func actionReceiver(h *Holochain, msg *Message, attempts int) (response interface{}, err error) {
 	dht := h.dht
 	// to protect against crashes from background routines after close
 	if dht == nil {
 		return
 	}
+	if !validatesInPool(msg) {
+		return receiveAction(h, msg, attempts)
+	}
+	dht.vpool.do(validationKey(msg), func() {
+		response, err = receiveAction(h, msg, attempts)
+	})
+	return
+}
+
+func receiveAction(h *Holochain, msg *Message, attempts int) (response interface{}, err error) {
+	dht := h.dht
 	var a Action
 	a, err = MakeActionFromMessage(msg)
 	if err == nil {
@@ -115,10 +143,10 @@ func actionReceiver(h *Holochain, msg *Message, retries int) (response interface
 			if err != nil {
 				if err == ErrHashNotFound {
 					dht.dlog.Logf("don't yet have %s, trying again later", t.RelatedHash)
-					retry := &retry{msg: *msg, retries: retries}
-					dht.retryQueue <- retry
-					response = DHTChangeUnknownHashQueuedForRetry
-					err = nil
+					err = dht.queueRetry(msg, attempts)
+					if err == nil {
+						response = DHTChangeUnknownHashQueuedForRetry
+					}
 				}
 			}
 
@@ -131,6 +159,11 @@ func actionReceiver(h *Holochain, msg *Message, retries int) (response interface
 		// The Receive functions understand this and use the values from the message body
 		// TODO, this indicates an architectural error, so fix!
 		response, err = a.Receive(dht, msg)
+		if err == ErrValidationSourceUnreachable || IsExecutionTimeoutErr(err) {
+			response, err = dht.validationPending(a, msg, attempts)
+		} else if err == nil {
+			err = dht.validationDone(msg)
+		}
 	}
 	return
 }
@@ -0,0 +1,152 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// latency based PeerQueue implementations using the peerstore's latency metrics
+
+package peerqueue
+
+import (
+	"container/heap"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// UnknownLatency is the latency assumed for peers that have never been measured
+// so that they sort after all peers for which we do have a measurement
+const UnknownLatency = time.Duration(1<<63 - 1)
+
+// latencyMetric tracks a peer, its closeness bucket and its latency
+type latencyMetric struct {
+	peer peer.ID
+
+	// number of leading bits shared with the key (larger is closer)
+	prefix int
+
+	latency time.Duration
+
+	// full XOR distance, used as a final tie-breaker
+	distance *big.Int
+}
+
+// latencyHeap implements a heap of latencyMetrics
+type latencyHeap []*latencyMetric
+
+func (lh latencyHeap) Len() int {
+	return len(lh)
+}
+
+func (lh latencyHeap) Less(i, j int) bool {
+	if lh[i].prefix != lh[j].prefix {
+		return lh[i].prefix > lh[j].prefix
+	}
+	if lh[i].latency != lh[j].latency {
+		return lh[i].latency < lh[j].latency
+	}
+	if lh[i].distance == nil || lh[j].distance == nil {
+		return false
+	}
+	return -1 == lh[i].distance.Cmp(lh[j].distance)
+}
+
+func (lh latencyHeap) Swap(i, j int) {
+	lh[i], lh[j] = lh[j], lh[i]
+}
+
+func (lh *latencyHeap) Push(x interface{}) {
+	item := x.(*latencyMetric)
+	*lh = append(*lh, item)
+}
+
+func (lh *latencyHeap) Pop() interface{} {
+	old := *lh
+	n := len(old)
+	item := old[n-1]
+	*lh = old[0 : n-1]
+	return item
+}
+
+// latencyPQ implements heap.Interface and PeerQueue
+type latencyPQ struct {
+	// from is the Key this PQ measures closeness against, may be empty
+	from Hash
+
+	// metrics holds the latency measurements of peers
+	metrics pstore.Metrics
+
+	heap latencyHeap
+
+	sync.RWMutex
+}
+
+// PeerLatency returns the measured latency of a peer or UnknownLatency
+// if the peer has never been measured
+func PeerLatency(m pstore.Metrics, p peer.ID) time.Duration {
+	l := m.LatencyEWMA(p)
+	if l == 0 {
+		return UnknownLatency
+	}
+	return l
+}
+
+func (pq *latencyPQ) Len() int {
+	pq.Lock()
+	defer pq.Unlock()
+	return len(pq.heap)
+}
+
+func (pq *latencyPQ) Enqueue(p peer.ID) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	m := latencyMetric{
+		peer:    p,
+		latency: PeerLatency(pq.metrics, p),
+	}
+	if pq.from != "" {
+		h := HashFromPeerID(p)
+		m.prefix = ZeroPrefixLen(XOR([]byte(h), []byte(pq.from)))
+		m.distance = HashXORDistance(h, pq.from)
+	}
+	heap.Push(&pq.heap, &m)
+}
+
+func (pq *latencyPQ) Dequeue() peer.ID {
+	pq.Lock()
+	defer pq.Unlock()
+
+	if len(pq.heap) < 1 {
+		panic("called Dequeue on an empty PeerQueue")
+		// will panic internally anyway, but we can help debug here
+	}
+
+	o := heap.Pop(&pq.heap)
+	p := o.(*latencyMetric)
+	return p.peer
+}
+
+// NewLatencyPQ returns a PeerQueue which maintains its peers sorted by
+// their measured round-trip latency, fastest first.  Peers that have never
+// been measured come out last.
+func NewLatencyPQ(m pstore.Metrics) PeerQueue {
+	return &latencyPQ{
+		metrics: m,
+		heap:    latencyHeap{},
+	}
+}
+
+// NewXORDistanceLatencyPQ returns a PeerQueue which maintains its peers sorted
+// by closeness to a key, where closeness is measured in k-bucket terms (i.e.
+// the length of the common prefix with the key).  Peers that are equally close
+// are ordered by their measured latency, and then by their full XOR distance.
+func NewXORDistanceLatencyPQ(from Hash, m pstore.Metrics) PeerQueue {
+	return &latencyPQ{
+		from:    from,
+		metrics: m,
+		heap:    latencyHeap{},
+	}
+}
@@ -11,6 +11,7 @@ import (
 
 	. "github.com/holochain/holochain-proto/hash"
 	peer "github.com/libp2p/go-libp2p-peer"
+	pstore "github.com/libp2p/go-libp2p-peerstore"
 	mh "github.com/multiformats/go-multihash"
 )
 
@@ -67,6 +68,86 @@ func TestQueue(t *testing.T) {
 	}
 }
 
+func TestLatencyQueue(t *testing.T) {
+	h1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	h2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	h3, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+
+	p1 := PeerIDFromHash(h1)
+	p2 := PeerIDFromHash(h2)
+	p3 := PeerIDFromHash(h3)
+
+	m := pstore.NewMetrics()
+	m.RecordLatency(p1, 300*time.Millisecond)
+	m.RecordLatency(p2, 10*time.Millisecond)
+
+	pq := NewLatencyPQ(m)
+	pq.Enqueue(p3)
+	pq.Enqueue(p1)
+	pq.Enqueue(p2)
+
+	// should come out as: p2, p1, then the unmeasured p3
+	if d := pq.Dequeue(); d != p2 {
+		t.Error("ordering failed")
+	}
+	if d := pq.Dequeue(); d != p1 {
+		t.Error("ordering failed")
+	}
+	if d := pq.Dequeue(); d != p3 {
+		t.Error("ordering failed")
+	}
+
+	if PeerLatency(m, p3) != UnknownLatency {
+		t.Error("expected unmeasured peer to have unknown latency")
+	}
+}
+
+func TestXORDistanceLatencyQueue(t *testing.T) {
+	h1, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	h2, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+	h3, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh3")
+	h4, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh4")
+
+	p2 := PeerIDFromHash(h2)
+	p3 := PeerIDFromHash(h3)
+	p4 := PeerIDFromHash(h4)
+
+	// p3 and p4 are equally close to h1 in bucket terms (they only differ
+	// from it in the same low bits) so latency decides between them
+	m := pstore.NewMetrics()
+	m.RecordLatency(p2, 200*time.Millisecond)
+	m.RecordLatency(p3, 50*time.Millisecond)
+	m.RecordLatency(p4, 5*time.Millisecond)
+
+	pq := NewXORDistanceLatencyPQ(h1, m)
+	pq.Enqueue(p3)
+	pq.Enqueue(p4)
+
+	if d := pq.Dequeue(); d != p4 {
+		t.Error("ordering failed, expected lower latency peer first")
+	}
+	if d := pq.Dequeue(); d != p3 {
+		t.Error("ordering failed")
+	}
+
+	// closeness still trumps latency
+	pq = NewXORDistanceLatencyPQ(h2, m)
+	pq.Enqueue(p4)
+	pq.Enqueue(p2)
+	pq.Enqueue(p3)
+	prefix := func(p peer.ID) int {
+		return ZeroPrefixLen(XOR([]byte(HashFromPeerID(p)), []byte(h2)))
+	}
+	last := -1
+	for pq.Len() > 0 {
+		p := pq.Dequeue()
+		if last != -1 && prefix(p) > last {
+			t.Error("ordering failed, closer peer came out after farther one")
+		}
+		last = prefix(p)
+	}
+}
+
 func newPeerTime(t time.Time) peer.ID {
 	s := fmt.Sprintf("hmmm time: %v", t)
 	h, _ := mh.Sum([]byte(s), mh.SHA2_256, -1)
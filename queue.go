@@ -0,0 +1,247 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// queue implements the persistent queues of DHT changes that still have to be sent to
+// the network or retried, so that changes made while offline, or received before the
+// data they relate to, survive a restart and are retried with exponential backoff.
+
+package holochain
+
+import (
+	"errors"
+	. "github.com/holochain/holochain-proto/hash"
+	"github.com/tidwall/buntdb"
+	"sort"
+	"time"
+)
+
+const (
+	// RetryQueue holds received changes whose related hash we don't yet have
+	RetryQueue = "retry"
+
+	// ChangeQueue holds our own changes that no remote node has yet accepted
+	ChangeQueue = "change"
+
+	// MaxRetryDelay caps the exponential backoff between attempts
+	MaxRetryDelay = time.Hour
+)
+
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// QueuedChange is the persisted record of a change waiting in one of the queues
+type QueuedChange struct {
+	Queue    string
+	Key      Hash // for changes, the hash to whose closest peers the change is sent
+	Msg      Message
+	Attempts int       // the number of attempts made so far
+	Next     time.Time // when the next attempt is due
+}
+
+// retryDelay returns how long to wait after the given number of attempts
+func (dht *DHT) retryDelay(attempts int) time.Duration {
+	interval := dht.h.Config.retryInterval
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 32 {
+		return MaxRetryDelay
+	}
+	delay := interval << uint(attempts-1)
+	if delay <= 0 || delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	return delay
+}
+
+// queueKey returns the key a queued change is stored under
+func queueKey(q *QueuedChange) (key string, err error) {
+	if q.Queue != RetryQueue && q.Queue != ChangeQueue {
+		err = ErrUnknownQueue
+		return
+	}
+	var f Hash
+	f, err = q.Msg.Fingerprint()
+	if err != nil {
+		return
+	}
+	key = q.Queue + ":" + f.String()
+	return
+}
+
+// enqueue persists a queued change, replacing any earlier record of the same message
+func (dht *DHT) enqueue(q *QueuedChange) (err error) {
+	var key string
+	key, err = queueKey(q)
+	if err != nil {
+		return
+	}
+	var b []byte
+	b, err = ByteEncoder(q)
+	if err != nil {
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set(key, string(b), nil)
+		return e
+	})
+	return
+}
+
+// dequeue removes a queued change if it's still there
+func (dht *DHT) dequeue(q *QueuedChange) (err error) {
+	var key string
+	key, err = queueKey(q)
+	if err != nil {
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete(key)
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+// GetQueued returns the changes waiting in a queue ordered by when they are next due
+func (dht *DHT) GetQueued(queue string) (queued []QueuedChange, err error) {
+	if queue != RetryQueue && queue != ChangeQueue {
+		err = ErrUnknownQueue
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.Ascend(queue, func(key, value string) bool {
+			var q QueuedChange
+			e = ByteDecoder([]byte(value), &q)
+			if e != nil {
+				return false
+			}
+			queued = append(queued, q)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	sort.Slice(queued, func(i, j int) bool { return queued[i].Next.Before(queued[j].Next) })
+	return
+}
+
+// queueRetry persists a received change whose related hash we don't yet have
+func (dht *DHT) queueRetry(msg *Message, attempts int) (err error) {
+	attempts++
+	q := QueuedChange{Queue: RetryQueue, Msg: *msg, Attempts: attempts, Next: time.Now().Add(dht.retryDelay(attempts))}
+	err = dht.enqueue(&q)
+	return
+}
+
+// queueChange persists one of our changes until a remote node accepts it
+func (dht *DHT) queueChange(req changeReq, attempts int) (err error) {
+	q := QueuedChange{Queue: ChangeQueue, Key: req.key, Msg: req.msg, Attempts: attempts, Next: time.Now().Add(dht.retryDelay(attempts))}
+	err = dht.enqueue(&q)
+	return
+}
+
+// pushChange adds a change request to the change queue without blocking, returning
+// false if it couldn't, in which case it stays persisted for a later attempt
+func (dht *DHT) pushChange(req changeReq) (pushed bool) {
+	pushed = dht.trySend(&dht.changeQueue, req)
+	return
+}
+
+// retryQueued makes a due attempt at a queued change
+func (dht *DHT) retryQueued(q *QueuedChange) (err error) {
+	switch q.Queue {
+	case RetryQueue:
+		// changes pending validation are retried until their validation times out
+		if q.Attempts > MaxRetries && !dht.isPendingValidation(&q.Msg) {
+			dht.dlog.Logf("max retries for %v, ignoring", q.Msg)
+			err = dht.dequeue(q)
+			return
+		}
+		var resp interface{}
+		resp, err = actionReceiver(dht.h, &q.Msg, q.Attempts)
+		dht.dlog.Logf("retry %d of %v, response: %v error: %v", q.Attempts, q.Msg, resp, err)
+		if resp != DHTChangeUnknownHashQueuedForRetry && resp != DHTChangeValidationPendingQueuedForRetry {
+			// otherwise actionReceiver will have re-queued it with a later time
+			err = dht.dequeue(q)
+		}
+	case ChangeQueue:
+		// push the next attempt out so the change isn't sent again while it's
+		// waiting in the change queue, change will remove it once it's accepted
+		q.Next = time.Now().Add(dht.retryDelay(q.Attempts + 1))
+		err = dht.enqueue(q)
+		if err != nil {
+			return
+		}
+		dht.dlog.Logf("resending change %d of %v", q.Attempts, q.Msg)
+		dht.pushChange(changeReq{key: q.Key, msg: q.Msg, attempts: q.Attempts})
+	default:
+		err = ErrUnknownQueue
+	}
+	return
+}
+
+// ReplayQueues makes everything persisted in the queues due so that changes left over
+// from before a restart are attempted straight away
+func (dht *DHT) ReplayQueues() (err error) {
+	if e := dht.expirePendingValidations(); e != nil {
+		dht.dlog.Logf("error expiring pending validations: %v", e)
+	}
+	now := time.Now()
+	for _, queue := range []string{RetryQueue, ChangeQueue} {
+		var queued []QueuedChange
+		queued, err = dht.GetQueued(queue)
+		if err != nil {
+			return
+		}
+		if len(queued) > 0 {
+			dht.dlog.Logf("replaying %d queued %s changes", len(queued), queue)
+		}
+		for i := range queued {
+			queued[i].Next = now
+			err = dht.enqueue(&queued[i])
+			if err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// RetryTask makes an attempt at any queued changes that are due
+func RetryTask(h *Holochain) {
+	dht := h.dht
+	if dht == nil {
+		return
+	}
+	now := time.Now()
+	for _, queue := range []string{RetryQueue, ChangeQueue} {
+		queued, err := dht.GetQueued(queue)
+		if err != nil {
+			dht.dlog.Logf("error getting %s queue: %v", queue, err)
+			return
+		}
+		for i := range queued {
+			q := &queued[i]
+			if q.Next.After(now) {
+				// they're ordered by due time so the rest are later
+				break
+			}
+			err = dht.retryQueued(q)
+			if err != nil {
+				dht.dlog.Logf("error retrying %v: %v", q.Msg, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// REPL evaluates zome code typed in by a developer against a running holochain
+
+package holochain
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	zygo "github.com/glycerine/zygomys/zygo"
+	"github.com/robertkrimen/otto"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	REPLCommandPrefix = ":"
+)
+
+var ErrREPLQuit = errors.New("quit")
+
+const replHelp = `Enter zome code to evaluate it in the current zome, or one of:
+  :zome [name]    switch to the named zome, or list the zomes
+  :chain [index]  show the source chain, from index if given
+  :dht            show the DHT
+  :help           show this help
+  :quit           leave the REPL
+`
+
+// REPL holds the ribosomes of the zomes code is evaluated in so that what's defined
+// in a zome stays defined when switching back to it
+type REPL struct {
+	h         *Holochain
+	zome      *Zome
+	ribosomes map[string]Ribosome
+}
+
+// NewREPL returns a REPL evaluating code in the named zome, or the DNA's first zome if
+// the name is empty
+func NewREPL(h *Holochain, zomeName string) (r *REPL, err error) {
+	r = &REPL{h: h, ribosomes: make(map[string]Ribosome)}
+	if zomeName == "" {
+		zomes := h.nucleus.dna.Zomes
+		if len(zomes) == 0 {
+			err = errors.New("DNA has no zomes")
+			return
+		}
+		zomeName = zomes[0].Name
+	}
+	err = r.use(zomeName)
+	return
+}
+
+// Zome returns the name of the zome code is evaluated in
+func (r *REPL) Zome() string {
+	return r.zome.Name
+}
+
+// use switches to the named zome making its ribosome the first time it's used
+func (r *REPL) use(zomeName string) (err error) {
+	if _, ok := r.ribosomes[zomeName]; !ok {
+		var rb Ribosome
+		var z *Zome
+		rb, z, err = r.h.MakeRibosome(zomeName)
+		if err != nil {
+			return
+		}
+		r.ribosomes[zomeName] = rb
+		r.zome = z
+		return
+	}
+	r.zome, err = r.h.GetZome(zomeName)
+	return
+}
+
+// Eval evaluates a line of input, which is either a command or code for the current
+// zome, and returns what to show for it
+func (r *REPL) Eval(line string) (output string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	if strings.HasPrefix(line, REPLCommandPrefix) {
+		output, err = r.command(strings.Fields(line[len(REPLCommandPrefix):]))
+		return
+	}
+	var result interface{}
+	result, err = r.ribosomes[r.zome.Name].Run(line)
+	if err != nil {
+		return
+	}
+	output = r.format(result)
+	return
+}
+
+func (r *REPL) command(args []string) (output string, err error) {
+	if len(args) == 0 {
+		err = errors.New("missing command, try :help")
+		return
+	}
+	switch args[0] {
+	case "zome":
+		if len(args) == 1 {
+			for _, z := range r.h.nucleus.dna.Zomes {
+				current := " "
+				if z.Name == r.zome.Name {
+					current = "*"
+				}
+				output += fmt.Sprintf("%s %s (%s)\n", current, z.Name, z.RibosomeType)
+			}
+			return
+		}
+		err = r.use(args[1])
+	case "chain":
+		start := 0
+		if len(args) > 1 {
+			start, err = strconv.Atoi(args[1])
+			if err != nil {
+				return
+			}
+		}
+		output = r.h.Chain().Dump(start)
+	case "dht":
+		output = r.h.DHT().String()
+	case "help":
+		output = replHelp
+	case "quit", "exit":
+		err = ErrREPLQuit
+	default:
+		err = fmt.Errorf("unknown command %s, try :help", args[0])
+	}
+	return
+}
+
+// format returns a value returned by a ribosome as it's shown to the developer,
+// with objects shown as JSON
+func (r *REPL) format(result interface{}) string {
+	switch t := result.(type) {
+	case *otto.Value:
+		if t.IsObject() && t.Class() != "Function" {
+			if jsr, ok := r.ribosomes[r.zome.Name].(*JSRibosome); ok {
+				j, err := jsr.vm.Call("JSON.stringify", nil, *t)
+				if err == nil && j.IsString() {
+					return j.String()
+				}
+			}
+		}
+		return t.String()
+	case *zygo.SexpStr:
+		return strconv.Quote(t.S)
+	case *zygo.SexpRaw:
+		return string(t.Val)
+	case *zygo.SexpHash:
+		return cleanZygoJson(zygo.SexpToJson(t))
+	case *zygo.SexpInt:
+		return fmt.Sprintf("%d", t.Val)
+	case *zygo.SexpBool:
+		return fmt.Sprintf("%v", t.Val)
+	case *zygo.SexpSentinel:
+		return "nil"
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Sprintf("%v", result)
+	}
+	return string(b)
+}
+
+// Run reads lines from in evaluating them and writing what they returned to out
+// until in is closed or the developer quits
+func (r *REPL) Run(in io.Reader, out io.Writer) (err error) {
+	fmt.Fprint(out, "Type :help for help\n")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(out, "%s> ", r.zome.Name)
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			err = scanner.Err()
+			return
+		}
+		var output string
+		output, err = r.Eval(scanner.Text())
+		if err == ErrREPLQuit {
+			err = nil
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(out, "error: %v\n", err)
+			if re, ok := err.(*RibosomeError); ok {
+				fmt.Fprint(out, re.Trace())
+			}
+			continue
+		}
+		if output != "" {
+			fmt.Fprintln(out, strings.TrimSuffix(output, "\n"))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package holochain
+
+import (
+	"bytes"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should start in the first zome if none is given", t, func() {
+		r, err := NewREPL(h, "")
+		So(err, ShouldBeNil)
+		So(r.Zome(), ShouldEqual, h.nucleus.dna.Zomes[0].Name)
+		_, err = NewREPL(h, "bogusZome")
+		So(err.Error(), ShouldEqual, "unknown zome: bogusZome")
+	})
+
+	r, _ := NewREPL(h, "jsSampleZome")
+
+	Convey("it should evaluate code in the zome keeping what's defined", t, func() {
+		out, err := r.Eval("var x = 20; x + 1")
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "21")
+		out, err = r.Eval(`({x: x, s: "fish"})`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, `{"x":20,"s":"fish"}`)
+	})
+
+	Convey("it should call the API functions", t, func() {
+		hash, err := r.Eval(`commit("oddNumbers","7")`)
+		So(err, ShouldBeNil)
+		out, err := r.Eval(`get("` + hash + `")`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "7")
+	})
+
+	Convey("it should switch zomes", t, func() {
+		out, err := r.Eval(":zome")
+		So(err, ShouldBeNil)
+		So(out, ShouldContainSubstring, "* jsSampleZome (js)")
+		_, err = r.Eval(":zome zySampleZome")
+		So(err, ShouldBeNil)
+		So(r.Zome(), ShouldEqual, "zySampleZome")
+		out, err = r.Eval(`(+ 1 2)`)
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, "3")
+		_, err = r.Eval(":zome jsSampleZome")
+		So(err, ShouldBeNil)
+		out, _ = r.Eval("x")
+		So(out, ShouldEqual, "20")
+	})
+
+	Convey("it should show the chain", t, func() {
+		out, err := r.Eval(":chain")
+		So(err, ShouldBeNil)
+		So(out, ShouldEqual, h.Chain().Dump(0))
+	})
+
+	Convey("it should read lines until quit", t, func() {
+		var out bytes.Buffer
+		err := r.Run(strings.NewReader("1+1\nnotDefined\n:quit\n2+2\n"), &out)
+		So(err, ShouldBeNil)
+		So(out.String(), ShouldContainSubstring, "jsSampleZome> 2\n")
+		So(out.String(), ShouldContainSubstring, "error: Error executing JavaScript: ReferenceError: 'notDefined' is not defined")
+		So(out.String(), ShouldNotContainSubstring, "jsSampleZome> 4")
+	})
+}
@@ -72,6 +72,13 @@ type FunctionDef struct {
 	Name        string
 	CallingType string
 	Exposure    string
+
+	// optional JSON Schemas for the function's arguments and result
+	InputSchema  string `json:",omitempty"`
+	OutputSchema string `json:",omitempty"`
+
+	inputValidator  SchemaValidator
+	outputValidator SchemaValidator
 }
 
 // ValidExposure verifies that the function can be called in the given context
@@ -114,6 +121,8 @@ func RegisterRibosome(name string, factory RibosomeFactory) {
 func RegisterBultinRibosomes() {
 	RegisterRibosome(ZygoRibosomeType, NewZygoRibosome)
 	RegisterRibosome(JSRibosomeType, NewJSRibosome)
+	RegisterRibosome(WASMRibosomeType, NewWASMRibosome)
+	RegisterRibosome(GoRibosomeType, NewGoRibosome)
 }
 
 // CreateRibosome returns a new Ribosome of the given type
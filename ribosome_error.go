@@ -0,0 +1,104 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// RibosomeError carries where in a zome's code an error happened
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// StackFrame is a frame of the stack trace of an error in zome code
+type StackFrame struct {
+	Function string `json:"function,omitempty"`
+	File     string `json:"file"` // relative to the DNA directory
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// RibosomeError is an error raised by zome code
+type RibosomeError struct {
+	Zome     string       `json:"zome"`
+	Function string       `json:"function"` // the zome function or callback that was running
+	Message  string       `json:"message"`
+	File     string       `json:"file,omitempty"` // where the error happened, relative to the DNA directory
+	Line     int          `json:"line,omitempty"`
+	Column   int          `json:"column,omitempty"`
+	Stack    []StackFrame `json:"stack,omitempty"`
+}
+
+func (e *RibosomeError) Error() string {
+	return e.Message
+}
+
+// prefixError adds a prefix to the message of an error keeping where it happened if it's
+// a RibosomeError
+func prefixError(prefix string, err error) error {
+	if e, ok := err.(*RibosomeError); ok {
+		e.Message = prefix + e.Message
+		return e
+	}
+	return errors.New(prefix + err.Error())
+}
+
+// Trace returns the stack trace of the error one frame per line
+func (e *RibosomeError) Trace() (trace string) {
+	for _, f := range e.Stack {
+		trace += "    at " + f.String() + "\n"
+	}
+	return
+}
+
+func (f StackFrame) String() string {
+	loc := f.File
+	if f.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Column)
+	}
+	if f.Function == "" {
+		return loc
+	}
+	return fmt.Sprintf("%s (%s)", f.Function, loc)
+}
+
+var stackLocationRegexp = regexp.MustCompile(`^(.*):(\d+):(\d+)$`)
+
+// parseJSStack parses the frames of a JS stack trace, which are lines of the form
+// "at name (file:line:column)"
+func parseJSStack(trace string) (frames []StackFrame) {
+	for _, line := range strings.Split(trace, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "at ") {
+			continue
+		}
+		var f StackFrame
+		loc := line[3:]
+		if i := strings.Index(loc, " ("); i >= 0 && strings.HasSuffix(loc, ")") {
+			f.Function = loc[:i]
+			loc = loc[i+2 : len(loc)-1]
+		}
+		if m := stackLocationRegexp.FindStringSubmatch(loc); m != nil {
+			f.File = m[1]
+			f.Line, _ = strconv.Atoi(m[2])
+			f.Column, _ = strconv.Atoi(m[3])
+		} else {
+			f.File = loc
+		}
+		frames = append(frames, f)
+	}
+	return
+}
+
+// locate sets where the error happened to the innermost frame in a file of the DNA
+func (e *RibosomeError) locate() {
+	for _, f := range e.Stack {
+		if f.Line > 0 && !strings.HasPrefix(f.File, "<") {
+			e.File, e.Line, e.Column = f.File, f.Line, f.Column
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestParseJSStack(t *testing.T) {
+	Convey("it should parse the frames of a JS stack trace", t, func() {
+		frames := parseJSStack("Error: oops\n    at inner (z/z.js:3:7)\n    at <native code>\n    at <anonymous>:1:1\n")
+		So(frames, ShouldResemble, []StackFrame{
+			{Function: "inner", File: "z/z.js", Line: 3, Column: 7},
+			{File: "<native code>"},
+			{File: "<anonymous>", Line: 1, Column: 1},
+		})
+		e := RibosomeError{Stack: frames}
+		e.locate()
+		So(e.File, ShouldEqual, "z/z.js")
+		So(e.Line, ShouldEqual, 3)
+		So(e.Trace(), ShouldEqual, "    at inner (z/z.js:3:7)\n    at <native code>\n    at <anonymous>:1:1\n")
+	})
+}
+
+func TestJSRibosomeErrors(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("errors thrown by zome functions should say where in the zome's file they happened", t, func() {
+		_, err := h.Call("jsSampleZome", "throwError", "oops", PUBLIC_EXPOSURE)
+		So(err.Error(), ShouldEqual, "Error: oops")
+		re, ok := err.(*RibosomeError)
+		So(ok, ShouldBeTrue)
+		So(re.Zome, ShouldEqual, "jsSampleZome")
+		So(re.Function, ShouldEqual, "throwError")
+		So(re.File, ShouldEqual, "jsSampleZome/jsSampleZome.js")
+		So(re.Line, ShouldEqual, 11)
+		So(re.Stack[0].Function, ShouldEqual, "throwError")
+	})
+
+	Convey("syntax errors should be reported against the zome's file", t, func() {
+		_, err := NewJSRibosome(h, &Zome{Name: "bad", RibosomeType: JSRibosomeType, Code: "\n1+ )"})
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: bad/bad.js: Line 2:4 Unexpected token )")
+		re := err.(*RibosomeError)
+		So(re.File, ShouldEqual, "bad/bad.js")
+		So(re.Line, ShouldEqual, 2)
+		So(re.Column, ShouldEqual, 4)
+	})
+
+	Convey("errors in modules should be reported against the module's file", t, func() {
+		zome := &Zome{Name: "modular", RibosomeType: JSRibosomeType,
+			Modules: map[string]string{"util.js": "exports.fail = function() {\n  throw new Error('failed')\n}"},
+			Code:    `var util = require("./util"); function fail() {util.fail()}`,
+		}
+		z, err := NewJSRibosome(h, zome)
+		So(err, ShouldBeNil)
+		_, err = z.Run("fail()")
+		So(err.Error(), ShouldEqual, "Error executing JavaScript: Error: failed")
+		re := err.(*RibosomeError)
+		So(re.File, ShouldEqual, "modular/util.js")
+		So(re.Line, ShouldEqual, 2)
+		So(re.Stack[1].File, ShouldEqual, "modular/modular.js")
+	})
+}
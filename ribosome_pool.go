@@ -0,0 +1,164 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// ribosome pooling keeps initialized ribosomes of each zome so that calls don't have to
+// build a new VM and load the zome's code every time
+
+package holochain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+const (
+	// DefaultRibosomePoolSize is the number of idle ribosomes kept per zome
+	DefaultRibosomePoolSize = 4
+)
+
+// ReusableRibosome is implemented by ribosomes that can be pooled and used for more than
+// one call
+type ReusableRibosome interface {
+	Ribosome
+
+	// Reset prepares the ribosome for its next use, returning false if it can't be reused
+	Reset() bool
+}
+
+// ribosomePool holds the idle ribosomes of the zomes of an app
+type ribosomePool struct {
+	lk    sync.Mutex
+	size  int
+	zomes map[string]*zomeRibosomes
+	out   map[Ribosome]string // fingerprints of the code of the ribosomes in use
+}
+
+// zomeRibosomes holds the idle ribosomes of a zome
+type zomeRibosomes struct {
+	fingerprint string // of the code the ribosomes were made from
+	idle        []Ribosome
+}
+
+func newRibosomePool(size int) *ribosomePool {
+	return &ribosomePool{
+		size:  size,
+		zomes: make(map[string]*zomeRibosomes),
+		out:   make(map[Ribosome]string),
+	}
+}
+
+// codeFingerprint returns a hash of everything a zome's ribosome is made from so that
+// ribosomes made from code that has since changed aren't reused
+func codeFingerprint(h *Holochain, zome *Zome) string {
+	hash := sha256.New()
+	write := func(s string) {
+		hash.Write([]byte(s))
+		hash.Write([]byte{0})
+	}
+	writeModules := func(modules map[string]string) {
+		names := make([]string, 0, len(modules))
+		for name := range modules {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			write(name)
+			write(modules[name])
+		}
+	}
+	write(zome.RibosomeType)
+	write(zome.Code)
+	writeModules(zome.Modules)
+	if h.nucleus != nil && h.nucleus.dna != nil {
+		writeModules(h.nucleus.dna.Library)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns an idle ribosome of the zome or makes a new one
+func (p *ribosomePool) get(h *Holochain, zome *Zome) (r Ribosome, err error) {
+	if p == nil || p.size <= 0 {
+		r, err = zome.MakeRibosome(h)
+		return
+	}
+	fingerprint := codeFingerprint(h, zome)
+	p.lk.Lock()
+	zr, ok := p.zomes[zome.Name]
+	if !ok || zr.fingerprint != fingerprint {
+		zr = &zomeRibosomes{fingerprint: fingerprint}
+		p.zomes[zome.Name] = zr
+	}
+	if l := len(zr.idle); l > 0 {
+		r = zr.idle[l-1]
+		zr.idle = zr.idle[:l-1]
+	}
+	p.lk.Unlock()
+
+	if r == nil {
+		r, err = zome.MakeRibosome(h)
+		if err != nil {
+			return
+		}
+	}
+	p.lk.Lock()
+	p.out[r] = fingerprint
+	p.lk.Unlock()
+	return
+}
+
+// put gives back a ribosome got from the pool, keeping it for reuse if it can be reset,
+// was made from the zome's current code, and the pool isn't full
+func (p *ribosomePool) put(zome *Zome, r Ribosome) {
+	if p == nil || r == nil {
+		return
+	}
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	fingerprint, ok := p.out[r]
+	if !ok {
+		return
+	}
+	delete(p.out, r)
+	zr, ok := p.zomes[zome.Name]
+	if !ok || zr.fingerprint != fingerprint || len(zr.idle) >= p.size {
+		return
+	}
+	reusable, ok := r.(ReusableRibosome)
+	if !ok || !reusable.Reset() {
+		return
+	}
+	zr.idle = append(zr.idle, r)
+}
+
+// invalidate drops all the idle ribosomes
+func (p *ribosomePool) invalidate() {
+	if p == nil {
+		return
+	}
+	p.lk.Lock()
+	p.zomes = make(map[string]*zomeRibosomes)
+	p.lk.Unlock()
+}
+
+// GetRibosome returns a ribosome for a zome, reusing an idle one if there is one.
+// The ribosome must be given back with ReleaseRibosome once it's no longer used.
+func (h *Holochain) GetRibosome(zomeName string) (r Ribosome, z *Zome, err error) {
+	z, err = h.GetZome(zomeName)
+	if err != nil {
+		return
+	}
+	r, err = h.ribosomes.get(h, z)
+	return
+}
+
+// ReleaseRibosome gives back a ribosome returned by GetRibosome
+func (h *Holochain) ReleaseRibosome(z *Zome, r Ribosome) {
+	h.ribosomes.put(z, r)
+}
+
+// InvalidateRibosomes drops the idle ribosomes so that all zomes get new ones
+func (h *Holochain) InvalidateRibosomes() {
+	h.ribosomes.invalidate()
+}
@@ -0,0 +1,105 @@
+package holochain
+
+import (
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestRibosomePool(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should reuse released ribosomes", t, func() {
+		r1, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r2, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r1 == r2, ShouldBeFalse)
+		h.ReleaseRibosome(z, r1)
+		r3, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r3 == r1, ShouldBeTrue)
+		h.ReleaseRibosome(z, r2)
+		h.ReleaseRibosome(z, r3)
+	})
+
+	Convey("it should not reuse ribosomes that can't be reset", t, func() {
+		r1, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		r1.(*JSRibosome).timedOut = true
+		h.ReleaseRibosome(z, r1)
+		r2, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2 == r1, ShouldBeFalse)
+		h.ReleaseRibosome(z, r2)
+	})
+
+	Convey("it should drop ribosomes made from code that has changed", t, func() {
+		r1, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+
+		zome := &h.nucleus.dna.Zomes[1]
+		So(zome.Name, ShouldEqual, "jsSampleZome")
+		code := zome.Code
+		zome.Code = code + "\nfunction added() {return 1}"
+		r2, z2, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2 == r1, ShouldBeFalse)
+		result, err := r2.Run("added()")
+		So(err, ShouldBeNil)
+		i, _ := result.(*otto.Value).ToInteger()
+		So(i, ShouldEqual, 1)
+
+		// ribosomes of the old code given back after the change aren't kept
+		h.ReleaseRibosome(z, r1)
+		h.ReleaseRibosome(z2, r2)
+		r3, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r3 == r2, ShouldBeTrue)
+		h.ReleaseRibosome(z2, r3)
+		zome.Code = code
+	})
+
+	Convey("it should not let one use of a ribosome see what an earlier one did", t, func() {
+		r1, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = r1.Run("var leaked = 42; App.Name = 'changed'")
+		So(err, ShouldBeNil)
+		h.ReleaseRibosome(z, r1)
+
+		r2, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2 == r1, ShouldBeTrue)
+		result, err := r2.Run("typeof leaked")
+		So(err, ShouldBeNil)
+		So(result.(*otto.Value).String(), ShouldEqual, "undefined")
+		result, err = r2.Run("App.Name")
+		So(err, ShouldBeNil)
+		So(result.(*otto.Value).String(), ShouldEqual, h.Name())
+		h.ReleaseRibosome(z, r2)
+	})
+
+	Convey("it should not reuse zygo ribosomes", t, func() {
+		r1, z, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		_, err = r1.Run("(def leaked 42)")
+		So(err, ShouldBeNil)
+		h.ReleaseRibosome(z, r1)
+		r2, _, err := h.GetRibosome("zySampleZome")
+		So(err, ShouldBeNil)
+		So(r2 == r1, ShouldBeFalse)
+		_, err = r2.Run("leaked")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("it should make new ribosomes when pooling is off", t, func() {
+		h.ribosomes = newRibosomePool(0)
+		r1, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		h.ReleaseRibosome(z, r1)
+		r2, _, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		So(r2 == r1, ShouldBeFalse)
+	})
+}
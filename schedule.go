@@ -0,0 +1,279 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// Schedules have zome functions called periodically by the background task tickers, so
+// apps can do expiry, digests or re-publication without the UI being open.  They are
+// declared in a zome's DNA or added with the schedule API, which are kept in the schedules
+// database so they survive restarts.
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	// MinScheduleInterval is the shortest interval a function can be scheduled at
+	MinScheduleInterval = time.Second
+
+	scheduleKeyPrefix = "schedule:"
+)
+
+var ErrUnknownSchedule = errors.New("unknown schedule")
+var ErrScheduleInDNA = errors.New("schedules declared in the DNA can't be removed")
+
+// ScheduleDef declares a function of a zome to be called at an interval, e.g. "30s" or "24h"
+type ScheduleDef struct {
+	Function string
+	Interval string
+}
+
+// Schedule holds a zome function scheduled to be called
+type Schedule struct {
+	Zome     string
+	Function string
+	Interval string
+}
+
+// schedules holds the database of schedules added through the API and the stoppers of
+// the tickers of the running ones
+type schedules struct {
+	lk      sync.Mutex
+	db      *buntdb.DB
+	started bool
+	running map[string]chan bool
+}
+
+func newSchedules() *schedules {
+	return &schedules{running: make(map[string]chan bool)}
+}
+
+func scheduleKey(zome string, function string) string {
+	return scheduleKeyPrefix + zome + ":" + function
+}
+
+// parseScheduleInterval returns the interval of a schedule
+func parseScheduleInterval(interval string) (d time.Duration, err error) {
+	d, err = time.ParseDuration(interval)
+	if err != nil {
+		return
+	}
+	if d < MinScheduleInterval {
+		err = fmt.Errorf("interval %s is shorter than %v", interval, MinScheduleInterval)
+	}
+	return
+}
+
+// checkSchedule returns an error if the schedule isn't of a function of the zome or its
+// interval is bad
+func (zome *Zome) checkSchedule(def ScheduleDef) (err error) {
+	if _, err = zome.GetFunctionDef(def.Function); err != nil {
+		return
+	}
+	_, err = parseScheduleInterval(def.Interval)
+	return
+}
+
+func (h *Holochain) openSchedulesDB() (err error) {
+	s := h.schedules
+	if s.db == nil {
+		s.db, err = buntdb.Open(filepath.Join(h.DBPath(), SchedulesDBFileName))
+	}
+	return
+}
+
+// Schedule has the function of the zome called at the interval from when background
+// tasks are started, replacing any schedule the function already had
+func (h *Holochain) Schedule(zome string, function string, interval string) (err error) {
+	var z *Zome
+	if z, err = h.GetZome(zome); err != nil {
+		return
+	}
+	sched := Schedule{Zome: zome, Function: function, Interval: interval}
+	if err = z.checkSchedule(ScheduleDef{Function: function, Interval: interval}); err != nil {
+		return
+	}
+	var j []byte
+	if j, err = json.Marshal(sched); err != nil {
+		return
+	}
+
+	s := h.schedules
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if err = h.openSchedulesDB(); err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *buntdb.Tx) (e error) {
+		_, _, e = tx.Set(scheduleKey(zome, function), string(j), nil)
+		return
+	})
+	if err != nil {
+		return
+	}
+	h.Debugf("scheduled %s:%s every %s", zome, function, interval)
+	if s.started {
+		h.startSchedule(sched)
+	}
+	return
+}
+
+// Unschedule removes the schedule of a function added with Schedule
+func (h *Holochain) Unschedule(zome string, function string) (err error) {
+	s := h.schedules
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if err = h.openSchedulesDB(); err != nil {
+		return
+	}
+	key := scheduleKey(zome, function)
+	err = s.db.Update(func(tx *buntdb.Tx) (e error) {
+		_, e = tx.Delete(key)
+		return
+	})
+	if err == buntdb.ErrNotFound {
+		err = ErrUnknownSchedule
+		if z, e := h.GetZome(zome); e == nil {
+			for _, def := range z.Schedules {
+				if def.Function == function {
+					err = ErrScheduleInDNA
+				}
+			}
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	if stop := s.running[key]; stop != nil {
+		stop <- true
+		delete(s.running, key)
+	}
+	return
+}
+
+// Schedules returns the schedules declared in the DNA and added with Schedule, the
+// latter replacing the former for the same function
+func (h *Holochain) Schedules() (scheds []Schedule, err error) {
+	s := h.schedules
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return h.getSchedules()
+}
+
+func (h *Holochain) getSchedules() (scheds []Schedule, err error) {
+	added := make(map[string]Schedule)
+	if err = h.openSchedulesDB(); err != nil {
+		return
+	}
+	err = h.schedules.db.View(func(tx *buntdb.Tx) (e error) {
+		ascendErr := tx.AscendKeys(scheduleKeyPrefix+"*", func(key, value string) bool {
+			var sched Schedule
+			if e = json.Unmarshal([]byte(value), &sched); e != nil {
+				return false
+			}
+			added[key] = sched
+			return true
+		})
+		if e == nil {
+			e = ascendErr
+		}
+		return
+	})
+	if err != nil {
+		return
+	}
+	for _, z := range h.nucleus.dna.Zomes {
+		for _, def := range z.Schedules {
+			key := scheduleKey(z.Name, def.Function)
+			if _, ok := added[key]; !ok {
+				scheds = append(scheds, Schedule{Zome: z.Name, Function: def.Function, Interval: def.Interval})
+			}
+		}
+	}
+	for _, sched := range added {
+		scheds = append(scheds, sched)
+	}
+	return
+}
+
+// StartSchedules starts the tickers calling the scheduled functions
+func (h *Holochain) StartSchedules() (err error) {
+	s := h.schedules
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	var scheds []Schedule
+	if scheds, err = h.getSchedules(); err != nil {
+		return
+	}
+	s.started = true
+	for _, sched := range scheds {
+		h.startSchedule(sched)
+	}
+	return
+}
+
+// startSchedule starts the ticker of a schedule, stopping any the function already has
+func (h *Holochain) startSchedule(sched Schedule) {
+	s := h.schedules
+	key := scheduleKey(sched.Zome, sched.Function)
+	if stop := s.running[key]; stop != nil {
+		stop <- true
+		delete(s.running, key)
+	}
+	interval, err := parseScheduleInterval(sched.Interval)
+	if err != nil {
+		h.Config.Loggers.App.Logf("not running schedule of %s:%s: %v", sched.Zome, sched.Function, err)
+		return
+	}
+	s.running[key] = h.TaskTicker(interval, func(h *Holochain) { h.runScheduled(sched) })
+}
+
+// runScheduled calls a scheduled function, logging any failure
+func (h *Holochain) runScheduled(sched Schedule) (err error) {
+	defer func() {
+		if err != nil {
+			h.Config.Loggers.App.Logf("scheduled call of %s:%s failed: %v", sched.Zome, sched.Function, err)
+		}
+	}()
+	var z *Zome
+	if z, err = h.GetZome(sched.Zome); err != nil {
+		return
+	}
+	var fn *FunctionDef
+	if fn, err = z.GetFunctionDef(sched.Function); err != nil {
+		return
+	}
+	args := ""
+	if fn.CallingType == JSON_CALLING {
+		args = "{}"
+	}
+	_, err = h.Call(sched.Zome, sched.Function, args, ZOME_EXPOSURE)
+	return
+}
+
+// stopSchedules stops the tickers of the scheduled functions and closes their database
+func (h *Holochain) stopSchedules() {
+	s := h.schedules
+	if s == nil {
+		return
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for key, stop := range s.running {
+		stop <- true
+		delete(s.running, key)
+	}
+	s.started = false
+	if s.db != nil {
+		s.db.Close()
+		s.db = nil
+	}
+}
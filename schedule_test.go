@@ -0,0 +1,87 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestScheduleCheck(t *testing.T) {
+	zome := Zome{Name: "z", Functions: []FunctionDef{{Name: "tidy"}}}
+	Convey("it should only allow schedules of the zome's functions at long enough intervals", t, func() {
+		So(zome.checkSchedule(ScheduleDef{Function: "tidy", Interval: "1h"}), ShouldBeNil)
+		So(zome.checkSchedule(ScheduleDef{Function: "bogus", Interval: "1h"}).Error(), ShouldEqual, "unknown exposed function: bogus")
+		So(zome.checkSchedule(ScheduleDef{Function: "tidy", Interval: "10ms"}).Error(), ShouldEqual, "interval 10ms is shorter than 1s")
+		So(zome.checkSchedule(ScheduleDef{Function: "tidy", Interval: "often"}), ShouldNotBeNil)
+	})
+}
+
+func TestSchedule(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	var zome *Zome
+	for i := range h.nucleus.dna.Zomes {
+		if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" {
+			zome = &h.nucleus.dna.Zomes[i]
+		}
+	}
+	code := zome.Code
+	functions := zome.Functions
+	zome.Code += `
+function tidy() {debug("tidied")}`
+	zome.Functions = append(append([]FunctionDef{}, functions...), FunctionDef{Name: "tidy", CallingType: STRING_CALLING})
+	defer func() { zome.Code = code; zome.Functions = functions }()
+
+	Convey("it should persist schedules added with the API", t, func() {
+		r, z, err := h.GetRibosome("jsSampleZome")
+		So(err, ShouldBeNil)
+		_, err = r.Run(`schedule("tidy","1h")`)
+		h.ReleaseRibosome(z, r)
+		So(err, ShouldBeNil)
+
+		err = h.Schedule("jsSampleZome", "bogus", "1h")
+		So(err.Error(), ShouldEqual, "unknown exposed function: bogus")
+
+		h.stopSchedules()
+		scheds, err := h.Schedules()
+		So(err, ShouldBeNil)
+		So(scheds, ShouldResemble, []Schedule{{Zome: "jsSampleZome", Function: "tidy", Interval: "1h"}})
+	})
+
+	Convey("it should call scheduled functions and log their failures", t, func() {
+		ShouldLog(&h.Config.Loggers.App, func() {
+			err := h.runScheduled(Schedule{Zome: "jsSampleZome", Function: "tidy"})
+			So(err, ShouldBeNil)
+		}, "tidied")
+		ShouldLog(&h.Config.Loggers.App, func() {
+			err := h.runScheduled(Schedule{Zome: "jsSampleZome", Function: "throwError"})
+			So(err, ShouldNotBeNil)
+		}, "scheduled call of jsSampleZome:throwError failed: Error: ")
+	})
+
+	Convey("it should run schedules on the task ticker once started", t, func() {
+		err := h.Schedule("jsSampleZome", "tidy", "1s")
+		So(err, ShouldBeNil)
+		ShouldLog(&h.Config.Loggers.App, func() {
+			err = h.StartSchedules()
+			So(err, ShouldBeNil)
+			So(len(h.schedules.running), ShouldEqual, 1)
+			time.Sleep(time.Millisecond * 1500)
+		}, "tidied")
+		h.stopSchedules()
+		So(len(h.schedules.running), ShouldEqual, 0)
+	})
+
+	Convey("it should remove schedules but not those declared in the DNA", t, func() {
+		So(h.Unschedule("jsSampleZome", "tidy"), ShouldBeNil)
+		So(h.Unschedule("jsSampleZome", "tidy"), ShouldEqual, ErrUnknownSchedule)
+
+		zome.Schedules = []ScheduleDef{{Function: "tidy", Interval: "24h"}}
+		defer func() { zome.Schedules = nil }()
+		So(h.Unschedule("jsSampleZome", "tidy"), ShouldEqual, ErrScheduleInDNA)
+		scheds, err := h.Schedules()
+		So(err, ShouldBeNil)
+		So(scheds, ShouldResemble, []Schedule{{Zome: "jsSampleZome", Function: "tidy", Interval: "24h"}})
+	})
+}
@@ -33,6 +33,7 @@ const (
 	ChainDNADir          string = "dna"         // Sub-directory for all chain definition files
 	ChainUIDir           string = "ui"          // Sub-directory for all chain user interface files
 	ChainTestDir         string = "test"        // Sub-directory for all chain test files
+	DNALibraryDir        string = "lib"         // Sub-directory of the DNA for modules shared by zomes
 	DNAFileName          string = "dna"         // Definition of the Holochain
 	ConfigFileName       string = "config"      // Settings of the Holochain
 	SysFileName          string = "system.conf" // Server & System settings
@@ -42,6 +43,7 @@ const (
 	DNAHashFileName      string = "dna.hash"    // Filename for storing the hash of the holochain
 	DHTStoreFileName     string = "dht.db"      // Filname for storing the dht
 	BridgeDBFileName     string = "bridge.db"   // Filname for storing bridge keys
+	SchedulesDBFileName  string = "schedule.db" // Filename for storing schedules added by zomes
 
 	TestConfigFileName string = "_config.json"
 
@@ -91,6 +93,7 @@ type EntryDefFile struct {
 	Schema     string
 	SchemaFile string // file name of schema or language schema directive
 	Sharing    string
+	Rules      *ValidationRules `json:",omitempty"`
 }
 
 type ZomeFile struct {
@@ -102,6 +105,7 @@ type ZomeFile struct {
 	Config       map[string]interface{}
 	Entries      []EntryDefFile
 	Functions    []FunctionDef
+	Schedules    []ScheduleDef `json:",omitempty"`
 }
 
 type DNAFile struct {
@@ -115,6 +119,7 @@ type DNAFile struct {
 	DHTConfig            DHTConfig
 	Progenitor           Progenitor
 	Zomes                []ZomeFile
+	ExecutionBudgets     *ExecutionBudgets `json:",omitempty"`
 }
 
 // AgentFixture defines an agent for the purposes of tests
@@ -372,6 +377,7 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 	dna.RequiresVersion = dnaFile.RequiresVersion
 	dna.DHTConfig = dnaFile.DHTConfig
 	dna.Progenitor = dnaFile.Progenitor
+	dna.ExecutionBudgets = dnaFile.ExecutionBudgets
 	dna.Properties = dnaFile.Properties
 	dna.PropertiesSchema = string(propertiesSchema)
 	dna.propertiesSchemaValidator = validator
@@ -397,6 +403,10 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 				ext = ".js"
 			case "zygo":
 				ext = ".zy"
+			case "wasm":
+				ext = ".wasm"
+			case "go":
+				ext = ".gozome"
 			}
 			dnaFile.Zomes[i].CodeFile = zome.Name + ext
 		}
@@ -411,15 +421,37 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		dna.Zomes[i].Description = zome.Description
 		dna.Zomes[i].RibosomeType = zome.RibosomeType
 		dna.Zomes[i].Functions = zome.Functions
+		for j := range dna.Zomes[i].Functions {
+			if err = dna.Zomes[i].Functions[j].BuildSchemaValidators(); err != nil {
+				return
+			}
+		}
 		dna.Zomes[i].Config = zome.Config
 		dna.Zomes[i].BridgeFuncs = zome.BridgeFuncs
+		dna.Zomes[i].Schedules = zome.Schedules
+		for _, def := range zome.Schedules {
+			if err = dna.Zomes[i].checkSchedule(def); err != nil {
+				err = fmt.Errorf("bad schedule in zome %s: %v", zome.Name, err)
+				return
+			}
+		}
 
 		var code []byte
 		code, err = ReadFile(zomePath, zome.CodeFile)
 		if err != nil {
 			return
 		}
-		dna.Zomes[i].Code = string(code[:])
+		if zome.RibosomeType == WASMRibosomeType {
+			dna.Zomes[i].Code = encodeWASMCode(code)
+		} else {
+			dna.Zomes[i].Code = string(code[:])
+		}
+		if zome.RibosomeType == JSRibosomeType {
+			dna.Zomes[i].Modules, err = readModules(zomePath, JSModuleSuffix, dnaFile.Zomes[i].CodeFile)
+			if err != nil {
+				return
+			}
+		}
 
 		dna.Zomes[i].Entries = make([]EntryDef, len(zome.Entries))
 		for j, entry := range zome.Entries {
@@ -427,6 +459,7 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 			dna.Zomes[i].Entries[j].DataFormat = entry.DataFormat
 			dna.Zomes[i].Entries[j].Sharing = entry.Sharing
 			dna.Zomes[i].Entries[j].Schema = entry.Schema
+			dna.Zomes[i].Entries[j].Rules = entry.Rules
 			if entry.Schema == "" && entry.SchemaFile != "" {
 				schemaFilePath := filepath.Join(zomePath, entry.SchemaFile)
 				if !FileExists(schemaFilePath) {
@@ -448,6 +481,11 @@ func (s *Service) loadDNA(path string, filename string, format string) (dnaP *DN
 		}
 	}
 
+	dna.Library, err = readModules(filepath.Join(path, DNALibraryDir), JSModuleSuffix, "")
+	if err != nil {
+		return
+	}
+
 	dnaP = &dna
 	return
 }
@@ -575,6 +613,10 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 		suffix = ".js"
 	case ZygoRibosomeType:
 		suffix = ".zy"
+	case WASMRibosomeType:
+		suffix = ".wasm"
+	case GoRibosomeType:
+		suffix = ".gozome"
 	default:
 	}
 	return
@@ -582,12 +624,20 @@ func suffixByRibosomeType(ribosomeType string) (suffix string) {
 
 func _makeConfig(s *Service) (config Config, err error) {
 	config = Config{
-		DHTPort:         DefaultDHTPort,
-		PeerModeDHTNode: s.Settings.DefaultPeerModeDHTNode,
-		PeerModeAuthor:  s.Settings.DefaultPeerModeAuthor,
-		BootstrapServer: s.Settings.DefaultBootstrapServer,
-		EnableNATUPnP:   s.Settings.DefaultEnableNATUPnP,
-		EnableMDNS:      s.Settings.DefaultEnableMDNS,
+		DHTPort:             DefaultDHTPort,
+		PeerModeDHTNode:     s.Settings.DefaultPeerModeDHTNode,
+		PeerModeAuthor:      s.Settings.DefaultPeerModeAuthor,
+		BootstrapServer:     s.Settings.DefaultBootstrapServer,
+		EnableNATUPnP:       s.Settings.DefaultEnableNATUPnP,
+		EnableMDNS:          s.Settings.DefaultEnableMDNS,
+		ConnMgrHighWater:    DefaultConnMgrHighWater,
+		ConnMgrLowWater:     DefaultConnMgrLowWater,
+		GossipMaxPuts:       DefaultGossipMaxPuts,
+		GossipMaxBytes:      DefaultGossipMaxBytes,
+		GossipPeerMaxBytes:  DefaultGossipPeerMaxBytes,
+		ValidationCacheSize: DefaultValidationCacheSize,
+		ValidationWorkers:   DefaultValidationWorkers,
+		RibosomePoolSize:    DefaultRibosomePoolSize,
 		Loggers: Loggers{
 			Debug:      Logger{Name: "Debug", Format: "HC: %{file}.%{line}: %{message}", Enabled: false},
 			App:        Logger{Name: "App", Format: "%{color:cyan}%{message}", Enabled: false},
@@ -631,6 +681,24 @@ func _makeConfig(s *Service) (config Config, err error) {
 		Debugf("makeConfig: using environment variable to set enableNATUPnP to: %s", val)
 		config.EnableNATUPnP = val == "true"
 	}
+
+	val = os.Getenv("HOLOCHAINCONFIG_CONNMGRHIGHWATER")
+	if val != "" {
+		Debugf("makeConfig: using environment variable to set connMgrHighWater to: %s", val)
+		config.ConnMgrHighWater, err = strconv.Atoi(val)
+		if err != nil {
+			return
+		}
+	}
+
+	val = os.Getenv("HOLOCHAINCONFIG_CONNMGRLOWWATER")
+	if val != "" {
+		Debugf("makeConfig: using environment variable to set connMgrLowWater to: %s", val)
+		config.ConnMgrLowWater, err = strconv.Atoi(val)
+		if err != nil {
+			return
+		}
+	}
 	return
 }
 
@@ -939,13 +1007,23 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		RequiresVersion:      dna.RequiresVersion,
 		DHTConfig:            dna.DHTConfig,
 		Progenitor:           dna.Progenitor,
+		ExecutionBudgets:     dna.ExecutionBudgets,
 	}
 	for _, z := range dna.Zomes {
 		zpath := filepath.Join(dnaPath, z.Name)
 		if err = os.MkdirAll(zpath, os.ModePerm); err != nil {
 			return
 		}
-		if err = WriteFile([]byte(z.Code), zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
+		code := []byte(z.Code)
+		if z.RibosomeType == WASMRibosomeType {
+			if code, err = decodeWASMCode(z.Code); err != nil {
+				return
+			}
+		}
+		if err = WriteFile(code, zpath, z.Name+suffixByRibosomeType(z.RibosomeType)); err != nil {
+			return
+		}
+		if err = writeModules(zpath, z.Modules); err != nil {
 			return
 		}
 
@@ -956,6 +1034,7 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 			Functions:    z.Functions,
 			BridgeFuncs:  z.BridgeFuncs,
 			Config:       z.Config,
+			Schedules:    z.Schedules,
 		}
 
 		for _, e := range z.Entries {
@@ -963,6 +1042,7 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 				Name:       e.Name,
 				DataFormat: e.DataFormat,
 				Sharing:    e.Sharing,
+				Rules:      e.Rules,
 			}
 			if e.DataFormat == DataFormatJSON && e.Schema != "" {
 				entryDefFile.SchemaFile = e.Name + ".json"
@@ -976,6 +1056,10 @@ func (s *Service) saveDNAFile(root string, dna *DNA, encodingFormat string, over
 		dnaFile.Zomes = append(dnaFile.Zomes, zomeFile)
 	}
 
+	if err = writeModules(filepath.Join(dnaPath, DNALibraryDir), dna.Library); err != nil {
+		return
+	}
+
 	if dna.PropertiesSchema != "" {
 		if err = WriteFile([]byte(dna.PropertiesSchema), dnaPath, "properties_schema.json"); err != nil {
 			return
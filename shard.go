@@ -0,0 +1,265 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// shard implements the neighbourhood arcs nodes are responsible for holding, so that
+// gossip only exchanges the data each node actually needs to hold
+
+package holochain
+
+import (
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"math/big"
+)
+
+// ShardingMethod identifies how the DHT's data is split amongst nodes
+type ShardingMethod string
+
+const (
+	// ShardingNone means every node holds all the data
+	ShardingNone ShardingMethod = "none"
+
+	// ShardingXOR means nodes hold data whose hash is within the XOR distance
+	// of their RedundancyFactor closest peers
+	ShardingXOR ShardingMethod = "XOR"
+
+	// ShardingHashmask means nodes hold data whose hash shares a prefix with their
+	// own, where the prefix length grows with the size of the network
+	ShardingHashmask ShardingMethod = "hashmask"
+)
+
+// ShardArc describes the part of the hash space a node is responsible for holding
+type ShardArc struct {
+	Method   ShardingMethod
+	Center   Hash
+	Radius   []byte // for XOR sharding, the maximum distance from the center
+	MaskBits int    // for hashmask sharding, the number of prefix bits shared with the center
+}
+
+// checkShardingMethod returns an error if the sharding method is unknown
+func checkShardingMethod(m ShardingMethod) (err error) {
+	switch m {
+	case "", ShardingNone, ShardingXOR, ShardingHashmask:
+	default:
+		err = fmt.Errorf("unknown sharding method: %s", m)
+	}
+	return
+}
+
+// digest returns the digest part of a multihash for comparing hashes bit by bit
+func digest(h Hash) []byte {
+	b := []byte(h)
+	if len(b) < 2 {
+		return b
+	}
+	return b[2:]
+}
+
+// Contains returns true if the hash falls within the arc.  A nil arc contains everything.
+func (a *ShardArc) Contains(h Hash) bool {
+	if a == nil {
+		return true
+	}
+	c, d := digest(a.Center), digest(h)
+	if len(c) != len(d) {
+		// we can't compare hashes of different types so err on the side of holding
+		return true
+	}
+	switch a.Method {
+	case ShardingXOR:
+		radius := big.NewInt(0).SetBytes(a.Radius)
+		return big.NewInt(0).SetBytes(XOR(c, d)).Cmp(radius) <= 0
+	case ShardingHashmask:
+		return ZeroPrefixLen(XOR(c, d)) >= a.MaskBits
+	}
+	return true
+}
+
+// Covers returns true if everything in arc b is also in arc a.  A nil arc covers
+// everything and is covered only by a nil arc.
+func (a *ShardArc) Covers(b *ShardArc) bool {
+	if a == nil {
+		return true
+	}
+	if b == nil || a.Method != b.Method || a.Center.String() != b.Center.String() {
+		return false
+	}
+	switch a.Method {
+	case ShardingXOR:
+		return big.NewInt(0).SetBytes(a.Radius).Cmp(big.NewInt(0).SetBytes(b.Radius)) >= 0
+	case ShardingHashmask:
+		return a.MaskBits <= b.MaskBits
+	}
+	return true
+}
+
+// ShardingMethod returns the sharding method in use.  If not set in the DNA it
+// defaults to XOR when there's a RedundancyFactor, and none otherwise.
+func (dht *DHT) ShardingMethod() ShardingMethod {
+	if dht.config.RedundancyFactor <= 1 {
+		return ShardingNone
+	}
+	if dht.config.ShardingMethod == "" {
+		return ShardingXOR
+	}
+	return dht.config.ShardingMethod
+}
+
+// ShardArc returns the arc of the hash space we are responsible for given what we
+// know of the network, or nil if we are responsible for all of it
+func (dht *DHT) ShardArc() *ShardArc {
+	method := dht.ShardingMethod()
+	if method == ShardingNone {
+		return nil
+	}
+	rf := dht.config.RedundancyFactor
+	peers := dht.h.node.routingTable.ListPeers()
+	me := HashFromPeerID(dht.h.nodeID)
+	switch method {
+	case ShardingXOR:
+		// we are one of the rf closest nodes to anything nearer to us than our
+		// rf-th closest peer, assuming nodes are evenly spread
+		if len(peers) < rf {
+			return nil
+		}
+		closest := SortClosestPeers(peers, me)
+		radius := XOR(digest(me), digest(HashFromPeerID(closest[rf-1])))
+		return &ShardArc{Method: method, Center: me, Radius: radius}
+	case ShardingHashmask:
+		// mask off as many bits as leave at least rf nodes sharing each prefix
+		n := len(peers) + 1
+		bits := 0
+		for n>>uint(bits+1) >= rf {
+			bits++
+		}
+		if bits == 0 {
+			return nil
+		}
+		return &ShardArc{Method: method, Center: me, MaskBits: bits}
+	}
+	return nil
+}
+
+// putShardHash returns the hash that determines which arc a put falls in, and
+// false if the put isn't sharded and should be gossiped to everyone
+func putShardHash(m *Message) (h Hash, ok bool) {
+	req, ok := m.Body.(HoldReq)
+	if !ok {
+		return
+	}
+	if m.Type == LINK_REQUEST {
+		// links are held with their base
+		return req.RelatedHash, true
+	}
+	return req.EntryHash, true
+}
+
+// filterPutsByArc returns only the puts that fall within the arc
+func filterPutsByArc(puts []Put, arc *ShardArc) []Put {
+	if arc == nil {
+		return puts
+	}
+	filtered := make([]Put, 0, len(puts))
+	for _, p := range puts {
+		h, ok := putShardHash(&p.M)
+		if !ok || arc.Contains(h) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// filterPeersByArc returns only the peers that fall within the arc, or all of them
+// if none do
+func filterPeersByArc(peers []peer.ID, arc *ShardArc) []peer.ID {
+	if arc == nil {
+		return peers
+	}
+	var filtered []peer.ID
+	for _, p := range peers {
+		if arc.Contains(HashFromPeerID(p)) {
+			filtered = append(filtered, p)
+		}
+	}
+	if len(filtered) == 0 {
+		return peers
+	}
+	return filtered
+}
+
+// savedArc wraps the arc we last gossiped with for storing, as gob can't encode the nil
+// arc of a node holding everything
+type savedArc struct {
+	Arc *ShardArc
+}
+
+// lastShardArc returns the arc we last gossiped with, and false if we haven't saved one
+func (dht *DHT) lastShardArc() (arc *ShardArc, found bool, err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		value, e := tx.Get("arc")
+		if e == buntdb.ErrNotFound {
+			return nil
+		}
+		if e != nil {
+			return e
+		}
+		var saved savedArc
+		if e = ByteDecoder([]byte(value), &saved); e != nil {
+			return e
+		}
+		arc, found = saved.Arc, true
+		return nil
+	})
+	return
+}
+
+// saveShardArc records the arc we are gossiping with.  It's gob encoded as the center
+// is a hash of raw bytes which wouldn't survive being stored as JSON.
+func (dht *DHT) saveShardArc(arc *ShardArc) (err error) {
+	var b []byte
+	b, err = ByteEncoder(savedArc{Arc: arc})
+	if err != nil {
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set("arc", string(b), nil)
+		return e
+	})
+	return
+}
+
+// checkArcGrowth compares our arc with the one we last gossiped with and, if it has
+// grown, resets our gossipers so that we reconcile with them.  The indexes we reached
+// with them only cover what was in our old arc, so carrying on from them would never
+// get us the puts already made in the part of the hash space we've taken on.
+func (dht *DHT) checkArcGrowth(arc *ShardArc) (err error) {
+	var last *ShardArc
+	var found bool
+	last, found, err = dht.lastShardArc()
+	if err != nil {
+		return
+	}
+	if found && !last.Covers(arc) {
+		var glist []peer.ID
+		glist, err = dht._getGossipers()
+		if err != nil {
+			return
+		}
+		dht.glog.Logf("arc grew, reconciling with %d gossipers", len(glist))
+		for _, id := range glist {
+			if err = dht.resetGossiper(id); err != nil {
+				return
+			}
+		}
+	}
+	if found && last.Covers(arc) && arc.Covers(last) {
+		return
+	}
+	err = dht.saveShardArc(arc)
+	return
+}
@@ -0,0 +1,195 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestShardArcContains(t *testing.T) {
+	center, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	other, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqz2")
+
+	Convey("a nil arc should contain everything", t, func() {
+		var arc *ShardArc
+		So(arc.Contains(other), ShouldBeTrue)
+	})
+
+	Convey("an XOR arc should contain hashes within its radius", t, func() {
+		d := XOR(digest(center), digest(other))
+		arc := ShardArc{Method: ShardingXOR, Center: center, Radius: d}
+		So(arc.Contains(center), ShouldBeTrue)
+		So(arc.Contains(other), ShouldBeTrue)
+		arc.Radius = make([]byte, len(d))
+		So(arc.Contains(center), ShouldBeTrue)
+		So(arc.Contains(other), ShouldBeFalse)
+	})
+
+	Convey("a hashmask arc should contain hashes sharing its prefix", t, func() {
+		shared := ZeroPrefixLen(XOR(digest(center), digest(other)))
+		arc := ShardArc{Method: ShardingHashmask, Center: center, MaskBits: shared}
+		So(arc.Contains(other), ShouldBeTrue)
+		arc.MaskBits = shared + 1
+		So(arc.Contains(other), ShouldBeFalse)
+		So(arc.Contains(center), ShouldBeTrue)
+	})
+}
+
+func TestShardingMethod(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+
+	Convey("it should default to none without a redundancy factor", t, func() {
+		So(dht.ShardingMethod(), ShouldEqual, ShardingNone)
+		So(dht.ShardArc(), ShouldBeNil)
+	})
+
+	Convey("it should default to XOR with a redundancy factor", t, func() {
+		h.nucleus.dna.DHTConfig.RedundancyFactor = 3
+		So(dht.ShardingMethod(), ShouldEqual, ShardingXOR)
+		h.nucleus.dna.DHTConfig.ShardingMethod = ShardingHashmask
+		So(dht.ShardingMethod(), ShouldEqual, ShardingHashmask)
+	})
+
+	Convey("unknown sharding methods should fail the DNA check", t, func() {
+		dna := DNA{DHTConfig: DHTConfig{ShardingMethod: "bogus"}}
+		So(dna.check().Error(), ShouldEqual, "unknown sharding method: bogus")
+		dna.DHTConfig.ShardingMethod = ShardingXOR
+		So(dna.check(), ShouldBeNil)
+	})
+}
+
+func TestShardArc(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+	h.nucleus.dna.DHTConfig.RedundancyFactor = 3
+	me := HashFromPeerID(h.nodeID)
+
+	var peers []peer.ID
+	addPeers := func(count int) {
+		for i := len(peers); i < count; i++ {
+			p, _ := makePeer(fmt.Sprintf("peer_%d", i))
+			peers = append(peers, p)
+			h.node.routingTable.Update(p)
+		}
+	}
+
+	Convey("it should hold everything while the network is smaller than the redundancy factor", t, func() {
+		addPeers(2)
+		h.nucleus.dna.DHTConfig.ShardingMethod = ShardingXOR
+		So(dht.ShardArc(), ShouldBeNil)
+		h.nucleus.dna.DHTConfig.ShardingMethod = ShardingHashmask
+		So(dht.ShardArc(), ShouldBeNil)
+	})
+
+	Convey("an XOR arc should reach out to the redundancy factor-th closest peer", t, func() {
+		addPeers(20)
+		h.nucleus.dna.DHTConfig.ShardingMethod = ShardingXOR
+		arc := dht.ShardArc()
+		So(arc, ShouldNotBeNil)
+		So(arc.Center, ShouldEqual, me)
+		closest := SortClosestPeers(h.node.routingTable.ListPeers(), me)
+		So(arc.Contains(HashFromPeerID(closest[2])), ShouldBeTrue)
+		So(arc.Contains(HashFromPeerID(closest[3])), ShouldBeFalse)
+	})
+
+	Convey("a hashmask arc should grow its mask with the network", t, func() {
+		h.nucleus.dna.DHTConfig.ShardingMethod = ShardingHashmask
+		arc := dht.ShardArc()
+		So(arc, ShouldNotBeNil)
+		n := h.node.routingTable.Size() + 1
+		So(n>>uint(arc.MaskBits), ShouldBeGreaterThanOrEqualTo, 3)
+		So(n>>uint(arc.MaskBits+1), ShouldBeLessThan, 3)
+	})
+}
+
+func TestFilterPutsByArc(t *testing.T) {
+	base, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh1")
+	entry, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqz2")
+	puts := []Put{
+		{Idx: 1, M: Message{Type: PUT_REQUEST, Body: HoldReq{EntryHash: entry}}},
+		{Idx: 2, M: Message{Type: LINK_REQUEST, Body: HoldReq{RelatedHash: base, EntryHash: entry}}},
+		{Idx: 3, M: Message{Type: LISTADD_REQUEST, Body: ListAddReq{ListType: BlockedList}}},
+	}
+
+	Convey("a nil arc should keep all the puts", t, func() {
+		So(len(filterPutsByArc(puts, nil)), ShouldEqual, 3)
+	})
+
+	Convey("links should be sharded by their base and unsharded puts always kept", t, func() {
+		arc := ShardArc{Method: ShardingXOR, Center: base, Radius: []byte{0}}
+		filtered := filterPutsByArc(puts, &arc)
+		So(len(filtered), ShouldEqual, 2)
+		So(filtered[0].Idx, ShouldEqual, 2)
+		So(filtered[1].Idx, ShouldEqual, 3)
+	})
+}
+
+func TestCheckArcGrowth(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+	me := HashFromPeerID(h.nodeID)
+	p, _ := makePeer("gossiper")
+
+	Convey("an arc should cover the arcs inside it", t, func() {
+		var all *ShardArc
+		small := &ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{1}}
+		wide := &ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{2}}
+		So(all.Covers(small), ShouldBeTrue)
+		So(small.Covers(all), ShouldBeFalse)
+		So(wide.Covers(small), ShouldBeTrue)
+		So(small.Covers(wide), ShouldBeFalse)
+		mask := &ShardArc{Method: ShardingHashmask, Center: me, MaskBits: 2}
+		So(mask.Covers(&ShardArc{Method: ShardingHashmask, Center: me, MaskBits: 3}), ShouldBeTrue)
+		So(mask.Covers(&ShardArc{Method: ShardingHashmask, Center: me, MaskBits: 1}), ShouldBeFalse)
+		So(mask.Covers(small), ShouldBeFalse)
+	})
+
+	Convey("it should save and load the arc unchanged", t, func() {
+		_, found, err := dht.lastShardArc()
+		So(err, ShouldBeNil)
+		So(found, ShouldBeFalse)
+
+		arc := &ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{0xff, 0x80}}
+		So(dht.saveShardArc(arc), ShouldBeNil)
+		loaded, found, err := dht.lastShardArc()
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(loaded.Center.String(), ShouldEqual, me.String())
+		So(loaded.Covers(arc), ShouldBeTrue)
+		So(arc.Covers(loaded), ShouldBeTrue)
+
+		So(dht.saveShardArc(nil), ShouldBeNil)
+		loaded, found, err = dht.lastShardArc()
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(loaded, ShouldBeNil)
+	})
+
+	Convey("it should keep the gossipers' indexes while the arc doesn't grow", t, func() {
+		So(dht.UpdateGossiper(p, 5), ShouldBeNil)
+		So(dht.checkArcGrowth(&ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{2}}), ShouldBeNil)
+		So(dht.checkArcGrowth(&ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{1}}), ShouldBeNil)
+		idx, err := dht.GetGossiper(p)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 5)
+	})
+
+	Convey("it should reset the gossipers when the arc grows", t, func() {
+		So(dht.checkArcGrowth(&ShardArc{Method: ShardingXOR, Center: me, Radius: []byte{2}}), ShouldBeNil)
+		idx, err := dht.GetGossiper(p)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 0)
+
+		So(dht.UpdateGossiper(p, 5), ShouldBeNil)
+		So(dht.checkArcGrowth(nil), ShouldBeNil)
+		idx, err = dht.GetGossiper(p)
+		So(err, ShouldBeNil)
+		So(idx, ShouldEqual, 0)
+	})
+}
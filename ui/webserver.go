@@ -20,6 +20,14 @@ import (
 	"strings"
 )
 
+// functionSignature describes a zome function to clients
+type functionSignature struct {
+	Name         string
+	CallingType  string
+	InputSchema  json.RawMessage `json:",omitempty"`
+	OutputSchema json.RawMessage `json:",omitempty"`
+}
+
 type WebServer struct {
 	h      *holo.Holochain
 	port   string
@@ -98,6 +106,45 @@ func (ws *WebServer) Start() {
 		}
 	})
 
+	// pushes the DHT changes matching the zomes' subscriptions to the client as JSON
+	mux.HandleFunc("/_events/", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			ws.errs.Logf(err.Error())
+			return
+		}
+		defer conn.Close()
+
+		events, remove := ws.h.DHT().AddDHTEventListener()
+		defer remove()
+
+		// reading notices the client closing the connection
+		closed := make(chan bool)
+		go func() {
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					close(closed)
+					return
+				}
+			}
+		}()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if err = conn.WriteJSON(event); err != nil {
+					ws.errs.Log(err)
+					return
+				}
+			case <-closed:
+				return
+			}
+		}
+	})
+
 	mux.HandleFunc("/fn/", func(w http.ResponseWriter, r *http.Request) {
 
 		var err error
@@ -105,6 +152,17 @@ func (ws *WebServer) Start() {
 		defer func() {
 			if err != nil {
 				ws.log.Logf("ERROR:%s,code:%d", err.Error(), errCode)
+				switch e := err.(type) {
+				case *holo.FunctionSchemaError:
+					jsonError(w, e, errCode)
+					return
+				case *holo.RibosomeError:
+					// clients that accept JSON get errors from zome code with where they happened
+					if strings.Contains(r.Header.Get("Accept"), "application/json") {
+						jsonError(w, e, errCode)
+						return
+					}
+				}
 				http.Error(w, err.Error(), errCode)
 			}
 		}()
@@ -147,6 +205,50 @@ func (ws *WebServer) Start() {
 		}
 	})
 
+	// returns the public functions of a zome with their schemas for generating clients
+	mux.HandleFunc("/functions/", func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		var errCode = 400
+		defer func() {
+			if err != nil {
+				ws.log.Logf("ERROR:%s,code:%d", err.Error(), errCode)
+				http.Error(w, err.Error(), errCode)
+			}
+		}()
+
+		AddCors(w)
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		path := strings.Split(r.URL.Path, "/")
+		if len(path) != 3 {
+			errCode, err = mkErr("bad request", 400)
+			return
+		}
+		zome, err := ws.h.GetZome(path[2])
+		if err != nil {
+			errCode = 404
+			return
+		}
+		fns := []functionSignature{}
+		for _, f := range zome.Functions {
+			if f.Exposure != holo.PUBLIC_EXPOSURE {
+				continue
+			}
+			sig := functionSignature{Name: f.Name, CallingType: f.CallingType}
+			if f.InputSchema != "" {
+				sig.InputSchema = json.RawMessage(f.InputSchema)
+			}
+			if f.OutputSchema != "" {
+				sig.OutputSchema = json.RawMessage(f.OutputSchema)
+			}
+			fns = append(fns, sig)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(fns)
+	})
+
 	mux.HandleFunc("/setup-bridge/", func(w http.ResponseWriter, r *http.Request) {
 		var err error
 		var errCode = 400
@@ -278,12 +380,21 @@ func mkErr(etext string, code int) (int, error) {
 	return code, errors.New(etext)
 }
 
+// jsonError replies to a request with an error as JSON
+func jsonError(w http.ResponseWriter, err error, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(err)
+}
+
 func (ws *WebServer) call(zome string, function string, args string) (result interface{}, err error) {
 
 	ws.log.Logf("calling %s:%s(%s)\n", zome, function, args)
 	result, err = ws.h.Call(zome, function, args, holo.PUBLIC_EXPOSURE)
 
-	if err != nil {
+	switch err.(type) {
+	case nil, *holo.RibosomeError, *holo.FunctionSchemaError:
+	default:
 		_, err = mkErr(err.Error(), 400)
 	}
 	return
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"bytes"
+	"encoding/json"
 	. "github.com/holochain/holochain-proto"
 	. "github.com/holochain/holochain-proto/hash"
 	. "github.com/smartystreets/goconvey/convey"
@@ -77,7 +78,7 @@ func TestWebServer(t *testing.T) {
 		b, err = ioutil.ReadAll(resp.Body)
 		So(err, ShouldBeNil)
 		So(resp.StatusCode, ShouldEqual, 400)
-		So(string(b), ShouldEqual, `{"errorMessage":"Validation Failed: 2 is not odd","function":"commit","name":"HolochainError","source":{"column":"28","functionName":"addOdd","line":"45"}}
+		So(string(b), ShouldEqual, `{"errorMessage":"Validation Failed: 2 is not odd","function":"commit","name":"HolochainError","source":{"column":"28","functionName":"addOdd","line":"9"}}
 `)
 	})
 
@@ -93,6 +94,59 @@ func TestWebServer(t *testing.T) {
 		So(string(b), ShouldEqual, "Error: myError\n")
 	})
 
+	Convey("it should return app thrown errors with where they happened to clients accepting JSON", t, func() {
+		req, err := http.NewRequest("POST", "http://0.0.0.0:31415/fn/jsSampleZome/throwError", bytes.NewBuffer([]byte("myError")))
+		So(err, ShouldBeNil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/json")
+		var re RibosomeError
+		err = json.NewDecoder(resp.Body).Decode(&re)
+		So(err, ShouldBeNil)
+		So(re.Message, ShouldEqual, "Error: myError")
+		So(re.Function, ShouldEqual, "throwError")
+		So(re.File, ShouldEqual, "jsSampleZome/jsSampleZome.js")
+		So(re.Line, ShouldEqual, 11)
+	})
+
+	Convey("it should return schema errors as JSON and list functions with their schemas", t, func() {
+		var fn *FunctionDef
+		for i, z := range h.Nucleus().DNA().Zomes {
+			if z.Name == "jsSampleZome" {
+				for j, f := range z.Functions {
+					if f.Name == "getProperty" {
+						fn = &h.Nucleus().DNA().Zomes[i].Functions[j]
+					}
+				}
+			}
+		}
+		fn.InputSchema = `{"type":"string","enum":["language"]}`
+		defer func() { fn.InputSchema = "" }()
+
+		resp, err := http.Post("http://0.0.0.0:31415/fn/jsSampleZome/getProperty", "", bytes.NewBuffer([]byte("bogus")))
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, 400)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "application/json")
+		var se FunctionSchemaError
+		err = json.NewDecoder(resp.Body).Decode(&se)
+		So(err, ShouldBeNil)
+		So(se.Function, ShouldEqual, "getProperty")
+		So(se.Schema, ShouldEqual, FunctionSchemaInput)
+
+		resp, err = http.Get("http://0.0.0.0:31415/functions/jsSampleZome")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		var b []byte
+		b, err = ioutil.ReadAll(resp.Body)
+		So(err, ShouldBeNil)
+		So(string(b), ShouldContainSubstring, `{"Name":"getProperty","CallingType":"string","InputSchema":{"type":"string","enum":["language"]}}`)
+		So(string(b), ShouldNotContainSubstring, "testStrFn1")
+	})
+
 	fakeFromApp, _ := NewHash("QmVGtdTZdTFaLsaj2RwdVG8jcjNNcp1DE914DKZ2kHmXHx")
 	token, _ := h.AddBridgeAsCallee(fakeFromApp, "")
 
@@ -9,20 +9,45 @@ package holochain
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	. "github.com/holochain/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"strings"
+	"time"
 )
 
 // Package holds app specified data needed for validation (wire package)
 type Package struct {
-	Chain []byte
+	Chain   []byte
+	Entries []PackagedEntry
+}
+
+// PackagedEntry holds an entry referenced by the data being validated, along with its
+// signed header and the public key of its author so that it can be verified
+type PackagedEntry struct {
+	Type      string
+	Header    Header
+	HeaderSig Signature // author's signature of the whole header, whose own only covers the entry
+	Entry     GobEntry
+	Author    []byte // marshaled public key of the entry's author
+}
+
+// ReferencedEntry holds a verified entry from a validation package for passing into the app
+type ReferencedEntry struct {
+	Type   string
+	Entry  string
+	Time   time.Time
+	Source string // the node ID of the entry's author
 }
 
 // ValidationPackage holds app specified data needed for validation. This version
 // holds the package with any chain data un-marshaled after validation for passing
 // into the app for app level validation
 type ValidationPackage struct {
-	Chain *Chain
+	Chain   *Chain
+	Entries map[string]ReferencedEntry // referenced entries by hash
 }
 
 const (
@@ -37,6 +62,15 @@ const (
 	// the chain to
 	PkgReqEntryTypes = "types"
 
+	// PkgReqEntries is the key whose value is an array of hashes of entries to
+	// include in the package
+	PkgReqEntries = "entries"
+
+	// PkgReqFields is the key whose value is an array of paths to fields of the
+	// entry being validated, e.g. "post.hash", whose values are hashes of entries
+	// to include in the package
+	PkgReqFields = "fields"
+
 	// Constant mask values for PkgReqChain key of the validation request object
 
 	PkgReqChainOptNone       = 0x00
@@ -59,19 +93,20 @@ type ValidateQuery struct {
 
 // ValidateResponse holds the response to committing validates (PUT/MOD/DEL)
 type ValidateResponse struct {
-	Type    string
-	Header  Header
-	Entry   GobEntry
-	Package Package
+	Type       string
+	Header     Header
+	HeaderSig  Signature // responder's signature of the whole header, see signHeader
+	Entry      GobEntry
+	Package    Package
+	PackageSig Signature // responder's signature of the package, see signPackage
 }
 
 // MakePackage converts a package request into a package, loading chain data as necessary
 // this is the package that gets sent over the wire.  Chain DNA is omitted in this package
 // because it can be added at the destination and the chain will still validate.
 func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
-	if f, ok := req[PkgReqChain]; ok {
+	if flags, ok := pkgReqChainFlags(req); ok {
 		var b bytes.Buffer
-		flags := f.(int64)
 		var mflags int64
 		if (flags & PkgReqChainOptHeaders) == 0 {
 			mflags += ChainMarshalFlagsNoHeaders
@@ -82,7 +117,7 @@ func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
 
 		var types []string
 		if t, ok := req[PkgReqEntryTypes]; ok {
-			types = t.([]string)
+			types = pkgReqStrings(t)
 		}
 
 		privateEntries := h.GetPrivateEntryDefs()
@@ -94,9 +129,242 @@ func MakePackage(h *Holochain, req PackagingReq) (pkg Package, err error) {
 		h.chain.MarshalChain(&b, mflags+ChainMarshalFlagsOmitDNA, types, privateTypeNames)
 		pkg.Chain = b.Bytes()
 	}
+	if e, ok := req[PkgReqEntries]; ok {
+		for _, s := range pkgReqStrings(e) {
+			var hash Hash
+			hash, err = NewHash(s)
+			if err != nil {
+				return
+			}
+			var pe PackagedEntry
+			pe, err = h.packageEntry(hash)
+			if err != nil {
+				return
+			}
+			pkg.Entries = append(pkg.Entries, pe)
+		}
+	}
+	return
+}
+
+// pkgReqStrings converts a packaging request value to strings, as the ribosomes
+// export arrays differently
+func pkgReqStrings(v interface{}) (strs []string) {
+	switch t := v.(type) {
+	case []string:
+		strs = t
+	case string:
+		strs = []string{t}
+	case []interface{}:
+		for _, s := range t {
+			if str, ok := s.(string); ok {
+				strs = append(strs, str)
+			}
+		}
+	}
 	return
 }
 
+// pkgReqChainFlags returns the chain option mask of a packaging request, as the
+// ribosomes export numbers as different types
+func pkgReqChainFlags(req PackagingReq) (flags int64, ok bool) {
+	ok = true
+	switch t := req[PkgReqChain].(type) {
+	case int64:
+		flags = t
+	case int:
+		flags = int64(t)
+	case int32:
+		flags = int64(t)
+	case float64:
+		flags = int64(t)
+	case float32:
+		flags = int64(t)
+	default:
+		ok = false
+	}
+	return
+}
+
+// resolvePkgReqFields adds the hashes found at the requested field paths of a JSON entry
+// to the entries of a packaging request
+func resolvePkgReqFields(req PackagingReq, def *EntryDef, entry Entry) (PackagingReq, error) {
+	f, ok := req[PkgReqFields]
+	if !ok {
+		return req, nil
+	}
+	if def.DataFormat != DataFormatJSON {
+		return req, fmt.Errorf("can't package fields of %s entries", def.DataFormat)
+	}
+	var content interface{}
+	err := json.Unmarshal([]byte(entry.Content().(string)), &content)
+	if err != nil {
+		return req, err
+	}
+	hashes := pkgReqStrings(req[PkgReqEntries])
+	for _, path := range pkgReqStrings(f) {
+		v := content
+		for _, field := range strings.Split(path, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				v = nil
+				break
+			}
+			v = m[field]
+		}
+		// a field may hold a single hash or an array of them
+		hashes = append(hashes, pkgReqStrings(v)...)
+	}
+	req[PkgReqEntries] = hashes
+	delete(req, PkgReqFields)
+	return req, nil
+}
+
+// packageEntry gets an entry with its header and author's key, from our chain if we
+// authored it, otherwise from the node that did
+func (h *Holochain) packageEntry(hash Hash) (pe PackagedEntry, err error) {
+	var entry Entry
+	entry, pe.Type, err = h.chain.GetEntry(hash)
+	if err == nil {
+		var hd *Header
+		hd, err = h.chain.GetEntryHeader(hash)
+		if err != nil {
+			return
+		}
+		pe.Header = *hd
+		pe.Entry = *(entry.(*GobEntry))
+		if pe.HeaderSig, err = h.signHeader(hd); err != nil {
+			return
+		}
+		pe.Author, err = ic.MarshalPublicKey(h.agent.PubKey())
+		return
+	}
+	if err != ErrHashNotFound {
+		return
+	}
+
+	var resp GetResp
+	resp, err = h.getEntryInfo(hash, GetMaskSources)
+	if err != nil {
+		return
+	}
+	if len(resp.Sources) == 0 {
+		err = ErrHashNotFound
+		return
+	}
+	var author peer.ID
+	author, err = peer.IDB58Decode(resp.Sources[0])
+	if err != nil {
+		return
+	}
+	var vr ValidateResponse
+	vr, err = h.getValidationResponse(author, VALIDATE_PUT_REQUEST, hash)
+	if err != nil {
+		return
+	}
+	var pubKey ic.PubKey
+	pubKey, err = h.getNodePubKey(author)
+	if err != nil {
+		return
+	}
+	pe.Type = vr.Type
+	pe.Header = vr.Header
+	pe.HeaderSig = vr.HeaderSig
+	pe.Entry = vr.Entry
+	pe.Author, err = ic.MarshalPublicKey(pubKey)
+	return
+}
+
+// signHeader signs the whole of a header of our chain, so that others can trust its type
+// and time and not just the entry the header's own signature covers
+func (h *Holochain) signHeader(hd *Header) (sig Signature, err error) {
+	var b []byte
+	if b, err = hd.Marshal(); err != nil {
+		return
+	}
+	sig, err = h.Sign(b)
+	return
+}
+
+// signPackage signs the encoding of a validation package we made, so that others can
+// show the package came from us
+func (h *Holochain) signPackage(pkg *Package) (sig Signature, err error) {
+	var b []byte
+	if b, err = ByteEncoder(pkg); err != nil {
+		return
+	}
+	sig, err = h.Sign(b)
+	return
+}
+
+// verify checks that a packaged entry matches its header and that both were signed by
+// its author, returning the entry for passing into the app
+func (pe *PackagedEntry) verify(h *Holochain) (ref ReferencedEntry, err error) {
+	var author Hash
+	var authorKey ic.PubKey
+	author, authorKey, err = keyHash(pe.Author)
+	if err != nil {
+		return
+	}
+	var hash Hash
+	hash, err = pe.Entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(pe.Header.EntryLink) || pe.Type != pe.Header.Type {
+		err = ValidationFailed("packaged entry doesn't match header")
+		return
+	}
+	var matches bool
+	matches, err = authorKey.Verify([]byte(pe.Header.EntryLink), pe.Header.Sig.S)
+	if err != nil {
+		return
+	}
+	if !matches {
+		err = ValidationFailed("packaged entry not signed by author")
+		return
+	}
+	var b []byte
+	if b, err = pe.Header.Marshal(); err != nil {
+		return
+	}
+	if matches, err = authorKey.Verify(b, pe.HeaderSig.S); err != nil {
+		return
+	}
+	if !matches {
+		err = ValidationFailed("packaged entry header not signed by author")
+		return
+	}
+	content, ok := pe.Entry.C.(string)
+	if !ok {
+		err = ValidationFailed(fmt.Sprintf("packaged entry content is a %T not a string", pe.Entry.C))
+		return
+	}
+	ref = ReferencedEntry{
+		Type:   pe.Type,
+		Entry:  content,
+		Time:   pe.Header.Time,
+		Source: author.String(),
+	}
+	return
+}
+
+// appPackage returns the package as passed into the app's validation functions, or nil
+// if there is nothing in it
+func (vpkg *ValidationPackage) appPackage() map[string]interface{} {
+	if vpkg == nil || (vpkg.Chain == nil && len(vpkg.Entries) == 0) {
+		return nil
+	}
+	p := make(map[string]interface{})
+	if vpkg.Chain != nil {
+		p["Chain"] = vpkg.Chain
+	}
+	if len(vpkg.Entries) > 0 {
+		p["Entries"] = vpkg.Entries
+	}
+	return p
+}
+
 // MakeValidationPackage converts a received Package into a ValidationPackage and validates
 // any chain data that was included
 func MakeValidationPackage(h *Holochain, pkg *Package) (vpkg *ValidationPackage, err error) {
@@ -119,6 +387,17 @@ func MakeValidationPackage(h *Holochain, pkg *Package) (vpkg *ValidationPackage,
 			}
 		}
 	}
+	if pkg != nil && len(pkg.Entries) > 0 {
+		vp.Entries = make(map[string]ReferencedEntry)
+		for i := range pkg.Entries {
+			var ref ReferencedEntry
+			ref, err = pkg.Entries[i].verify(h)
+			if err != nil {
+				return
+			}
+			vp.Entries[pkg.Entries[i].Header.EntryLink.String()] = ref
+		}
+	}
 	vpkg = &vp
 	return
 }
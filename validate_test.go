@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	. "github.com/holochain/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	. "github.com/smartystreets/goconvey/convey"
 	"strings"
 	"testing"
@@ -253,3 +254,71 @@ func TestMakeValidatePackage(t *testing.T) {
 
 	})
 }
+
+func TestValidationPackageEntries(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	profileHash := commit(h, "profile", `{"firstName":"Zippy","lastName":"Pinhead"}`)
+	_, def, _ := h.GetEntryDef("profile")
+
+	Convey("it should resolve field paths of the entry to hashes", t, func() {
+		entry := &GobEntry{C: fmt.Sprintf(`{"ref":{"profile":"%s"},"other":["%s"]}`, profileHash.String(), profileHash.String())}
+		req, err := resolvePkgReqFields(PackagingReq{PkgReqFields: []interface{}{"ref.profile", "other", "missing.field"}}, def, entry)
+		So(err, ShouldBeNil)
+		So(req[PkgReqEntries], ShouldResemble, []string{profileHash.String(), profileHash.String()})
+		_, ok := req[PkgReqFields]
+		So(ok, ShouldBeFalse)
+
+		_, rdef, _ := h.GetEntryDef("rating")
+		_, err = resolvePkgReqFields(PackagingReq{PkgReqFields: []string{"Links"}}, rdef, entry)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("it should package and verify referenced entries", t, func() {
+		pkg, err := MakePackage(h, PackagingReq{PkgReqEntries: []string{profileHash.String()}})
+		So(err, ShouldBeNil)
+		So(len(pkg.Entries), ShouldEqual, 1)
+		So(pkg.Entries[0].Header.EntryLink.String(), ShouldEqual, profileHash.String())
+
+		vpkg, err := MakeValidationPackage(h, &pkg)
+		So(err, ShouldBeNil)
+		ref := vpkg.Entries[profileHash.String()]
+		So(ref.Type, ShouldEqual, "profile")
+		So(ref.Entry, ShouldEqual, `{"firstName":"Zippy","lastName":"Pinhead"}`)
+		So(ref.Source, ShouldEqual, h.nodeIDStr)
+
+		code, err := buildJSValidateAction(NewPutAction("profile", &GobEntry{C: "{}"}, &Header{}), def, vpkg, []string{"fake_src_hash"})
+		So(err, ShouldBeNil)
+		So(code, ShouldContainSubstring, `{"Entries":{"`+profileHash.String()+`":{"Type":"profile"`)
+	})
+
+	Convey("it should reject tampered referenced entries", t, func() {
+		pkg, _ := MakePackage(h, PackagingReq{PkgReqEntries: []string{profileHash.String()}})
+		pkg.Entries[0].Entry.C = `{"firstName":"Zerbina","lastName":"Pinhead"}`
+		_, err := MakeValidationPackage(h, &pkg)
+		So(err, ShouldNotBeNil)
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+
+		pkg, _ = MakePackage(h, PackagingReq{PkgReqEntries: []string{profileHash.String()}})
+		_, key := makePeer("other")
+		pkg.Entries[0].Author, _ = ic.MarshalPublicKey(key.GetPublic())
+		_, err = MakeValidationPackage(h, &pkg)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "not signed by author")
+
+		pkg, _ = MakePackage(h, PackagingReq{PkgReqEntries: []string{profileHash.String()}})
+		pkg.Entries[0].Header.Time = pkg.Entries[0].Header.Time.Add(-time.Hour)
+		_, err = MakeValidationPackage(h, &pkg)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "header not signed by author")
+	})
+
+	Convey("it should reject referenced entries whose content isn't a string", t, func() {
+		pkg, _ := MakePackage(h, PackagingReq{PkgReqEntries: []string{profileHash.String()}})
+		pkg.Entries[0].Entry.C = 3
+		var err error
+		So(func() { _, err = MakeValidationPackage(h, &pkg) }, ShouldNotPanic)
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+	})
+}
@@ -0,0 +1,246 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// validation_cache implements a bounded, persisted cache of validation responses fetched
+// from authors and of the outcomes of validating them, so that data we have already
+// validated isn't fetched and run through the ribosome again, e.g. during gossip catch-up.
+// Records are keyed by the DNA hash so they are invalidated when the DNA changes.
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultValidationCacheSize = 10000
+
+	vcachePrefix = "vcache:"
+	vcacheStamp  = 20 // length of the zero padded timestamp each record starts with
+)
+
+var errNoValidationHeader = errors.New("no header to key validation outcome by")
+
+// validationOutcome is the cached result of validating an action
+type validationOutcome struct {
+	Err string // the validation failure, or empty if the action was valid
+}
+
+// validationCache tracks the number of cached records so it can be kept in bounds
+type validationCache struct {
+	lk     sync.Mutex
+	count  int
+	loaded bool
+}
+
+// vcacheLess orders cache records by the time they were stored
+func vcacheLess(a, b string) bool {
+	if len(a) < vcacheStamp || len(b) < vcacheStamp {
+		return a < b
+	}
+	return a[:vcacheStamp] < b[:vcacheStamp]
+}
+
+// vcacheKey returns the key of a cache record for the current DNA
+func (dht *DHT) vcacheKey(kind string, id string) string {
+	return vcachePrefix + dht.h.dnaHash.String() + ":" + kind + ":" + id
+}
+
+// vcacheGet decodes the cached record into value, returning false if there isn't one
+func (dht *DHT) vcacheGet(key string, value interface{}) (found bool, err error) {
+	if dht.h.Config.ValidationCacheSize <= 0 {
+		return
+	}
+	var v string
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		v, e = tx.Get(key)
+		return e
+	})
+	if err == buntdb.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil || len(v) < vcacheStamp {
+		return
+	}
+	err = ByteDecoder([]byte(v[vcacheStamp:]), value)
+	found = err == nil
+	return
+}
+
+// vcacheSet stores a record in the cache evicting the oldest records if it's full
+func (dht *DHT) vcacheSet(key string, value interface{}) (err error) {
+	max := dht.h.Config.ValidationCacheSize
+	if max <= 0 {
+		return
+	}
+	var b []byte
+	b, err = ByteEncoder(value)
+	if err != nil {
+		return
+	}
+	v := fmt.Sprintf("%0*d", vcacheStamp, time.Now().UnixNano()) + string(b)
+
+	c := dht.vcache
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		if !c.loaded {
+			c.count = 0
+			tx.Ascend("vcache", func(key, value string) bool {
+				c.count++
+				return true
+			})
+			c.loaded = true
+		}
+		_, replaced, e := tx.Set(key, v, nil)
+		if e != nil {
+			return e
+		}
+		if !replaced {
+			c.count++
+		}
+		if c.count <= max {
+			return nil
+		}
+		var evict []string
+		tx.Ascend("vcache", func(key, value string) bool {
+			evict = append(evict, key)
+			return len(evict) < c.count-max
+		})
+		for _, k := range evict {
+			_, e = tx.Delete(k)
+			if e != nil {
+				return e
+			}
+			c.count--
+		}
+		return nil
+	})
+	return
+}
+
+// PurgeValidationCache removes cached records that were made under a different DNA
+func (dht *DHT) PurgeValidationCache() (err error) {
+	current := vcachePrefix + dht.h.dnaHash.String() + ":"
+	c := dht.vcache
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		var stale []string
+		tx.Ascend("vcache", func(key, value string) bool {
+			if !strings.HasPrefix(key, current) {
+				stale = append(stale, key)
+			}
+			return true
+		})
+		for _, k := range stale {
+			_, e := tx.Delete(k)
+			if e != nil {
+				return e
+			}
+		}
+		if len(stale) > 0 {
+			dht.dlog.Logf("purged %d validation cache records from a previous DNA", len(stale))
+		}
+		return nil
+	})
+	c.loaded = false
+	return
+}
+
+// getValidationResponse returns the validation response for a query, from the cache if
+// we have already fetched it from the source and otherwise from the source itself
+func (h *Holochain) getValidationResponse(source peer.ID, msgType MsgType, query Hash) (resp ValidateResponse, err error) {
+	dht := h.dht
+	key := dht.vcacheKey("pkg", fmt.Sprintf("%d:%s:%v", msgType, peer.IDB58Encode(source), query))
+	var found bool
+	found, err = dht.vcacheGet(key, &resp)
+	if err != nil || found {
+		return
+	}
+	var r interface{}
+	msg := h.node.NewMessage(msgType, ValidateQuery{H: query})
+	r, err = h.Send(h.node.ctx, ValidateProtocol, source, msg, 0)
+	if err != nil {
+		return
+	}
+	switch t := r.(type) {
+	case ValidateResponse:
+		resp = t
+	default:
+		err = fmt.Errorf("expected ValidateResponse from validator got %T", r)
+		return
+	}
+	if e := dht.vcacheSet(key, &resp); e != nil {
+		dht.dlog.Logf("error caching validation response for %v: %v", query, e)
+	}
+	return
+}
+
+// validationOutcomeKey returns the cache key for the outcome of validating an action with
+// the given header
+func (dht *DHT) validationOutcomeKey(a ValidatingAction, header *Header) (key string, err error) {
+	if header == nil || header.EntryLink == "" {
+		// e.g. key entries which don't come with a header
+		err = errNoValidationHeader
+		return
+	}
+	var hash Hash
+	hash, _, err = header.Sum(dht.h.hashSpec)
+	if err != nil {
+		return
+	}
+	id := a.Name() + ":" + hash.String()
+	if l, ok := a.(*ActionLink); ok {
+		// link validation also depends on the base being linked from
+		id += ":" + l.validationBase.String()
+	}
+	key = dht.vcacheKey("outcome", id)
+	return
+}
+
+// validateReceived validates an action received from the DHT, using the cached outcome
+// if we have validated the same action with the same header before.  Only valid actions
+// and validation failures are cached, so that transient errors are retried.
+func (h *Holochain) validateReceived(a ValidatingAction, header *Header, entryType string, pkg *Package, sources []peer.ID) (err error) {
+	dht := h.dht
+	key, e := dht.validationOutcomeKey(a, header)
+	if e == nil {
+		var outcome validationOutcome
+		var found bool
+		found, e = dht.vcacheGet(key, &outcome)
+		if e == nil && found {
+			dht.dlog.Logf("using cached %s validation outcome", a.Name())
+			if outcome.Err != "" {
+				err = errors.New(outcome.Err)
+			}
+			return
+		}
+	}
+
+	_, err = h.ValidateAction(a, entryType, pkg, sources)
+	if e != nil || (err != nil && !IsValidationFailedErr(err)) {
+		return
+	}
+	outcome := validationOutcome{}
+	if err != nil {
+		outcome.Err = err.Error()
+	}
+	if e = dht.vcacheSet(key, &outcome); e != nil {
+		dht.dlog.Logf("error caching validation outcome: %v", e)
+	}
+	return
+}
@@ -0,0 +1,102 @@
+package holochain
+
+import (
+	"fmt"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/tidwall/buntdb"
+	"testing"
+)
+
+func TestValidationCache(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+	sources := []peer.ID{h.nodeID}
+	h.Config.ValidationCacheSize = DefaultValidationCacheSize
+
+	countCached := func() (count int) {
+		dht.ht.(*BuntHT).db.View(func(tx *buntdb.Tx) error {
+			return tx.Ascend("vcache", func(key, value string) bool {
+				count++
+				return true
+			})
+		})
+		return
+	}
+
+	Convey("it should cache validation outcomes by header", t, func() {
+		entry := &GobEntry{C: "1"}
+		hash, _ := entry.Sum(h.hashSpec)
+		header := &Header{Type: "evenNumbers", EntryLink: hash}
+		a := NewPutAction("evenNumbers", entry, header)
+		err := h.validateReceived(a, header, a.entryType, nil, sources)
+		So(IsValidationFailedErr(err), ShouldBeTrue)
+
+		key, err := dht.validationOutcomeKey(a, header)
+		So(err, ShouldBeNil)
+		var outcome validationOutcome
+		found, err := dht.vcacheGet(key, &outcome)
+		So(err, ShouldBeNil)
+		So(found, ShouldBeTrue)
+		So(outcome.Err, ShouldStartWith, ValidationFailedErrMsg)
+
+		// the cached outcome should be used instead of validating again
+		dht.vcacheSet(key, &validationOutcome{})
+		So(h.validateReceived(a, header, a.entryType, nil, sources), ShouldBeNil)
+	})
+
+	Convey("it should not cache errors other than validation failures", t, func() {
+		entry := &GobEntry{C: "foo"}
+		hash, _ := entry.Sum(h.hashSpec)
+		header := &Header{Type: "bogusType", EntryLink: hash}
+		a := NewPutAction("bogusType", entry, header)
+		err := h.validateReceived(a, header, a.entryType, nil, sources)
+		So(err.Error(), ShouldEqual, "no definition for entry type: bogusType")
+		key, _ := dht.validationOutcomeKey(a, header)
+		var outcome validationOutcome
+		found, _ := dht.vcacheGet(key, &outcome)
+		So(found, ShouldBeFalse)
+	})
+
+	Convey("it should not cache outcomes without a header", t, func() {
+		a := NewPutAction("evenNumbers", &GobEntry{C: "2"}, nil)
+		_, err := dht.validationOutcomeKey(a, nil)
+		So(err, ShouldEqual, errNoValidationHeader)
+		So(h.validateReceived(a, nil, a.entryType, nil, sources), ShouldBeNil)
+	})
+
+	Convey("it should evict the oldest records when full", t, func() {
+		h.Config.ValidationCacheSize = 3
+		for i := 0; i < 5; i++ {
+			err := dht.vcacheSet(dht.vcacheKey("test", fmt.Sprintf("%d", i)), &validationOutcome{})
+			So(err, ShouldBeNil)
+		}
+		So(countCached(), ShouldEqual, 3)
+		var outcome validationOutcome
+		found, _ := dht.vcacheGet(dht.vcacheKey("test", "0"), &outcome)
+		So(found, ShouldBeFalse)
+		found, _ = dht.vcacheGet(dht.vcacheKey("test", "4"), &outcome)
+		So(found, ShouldBeTrue)
+	})
+
+	Convey("it should purge records made under a different DNA", t, func() {
+		stale := vcachePrefix + "QmOldDNA:test:x"
+		So(dht.vcacheSet(stale, &validationOutcome{}), ShouldBeNil)
+		So(dht.PurgeValidationCache(), ShouldBeNil)
+		var outcome validationOutcome
+		found, _ := dht.vcacheGet(stale, &outcome)
+		So(found, ShouldBeFalse)
+		found, _ = dht.vcacheGet(dht.vcacheKey("test", "4"), &outcome)
+		So(found, ShouldBeTrue)
+	})
+
+	Convey("it should do nothing when disabled", t, func() {
+		h.Config.ValidationCacheSize = 0
+		key := dht.vcacheKey("test", "disabled")
+		So(dht.vcacheSet(key, &validationOutcome{}), ShouldBeNil)
+		var outcome validationOutcome
+		found, _ := dht.vcacheGet(key, &outcome)
+		So(found, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,242 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// validation_pending implements tracking of DHT changes that can't yet be validated
+// because their source can't be reached, or their validation ran out of time.  They are
+// retried until the DNA's ValidationTimeout passes, after which the data is marked as
+// rejected.
+
+package holochain
+
+import (
+	"errors"
+	. "github.com/holochain/holochain-proto/hash"
+	net "github.com/libp2p/go-libp2p-net"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/tidwall/buntdb"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultValidationTimeout is the validation timeout in seconds used when the DNA
+	// doesn't set one
+	DefaultValidationTimeout = 60 * 60 * 24
+)
+
+var ErrValidationSourceUnreachable = errors.New("validation source unreachable")
+var ErrValidationTimedOut = errors.New("validation timed out")
+
+// PendingValidation holds the state of a change that is waiting for its source to come
+// back online, or for another try at running its validation, so it can be validated
+type PendingValidation struct {
+	Hash     Hash      // the hash of the entry awaiting validation
+	Action   string    // the name of the action being validated
+	Source   string    // the node the validation package is being requested from
+	Since    time.Time // when we first failed to validate it
+	Deadline time.Time // when we give up and reject the data
+	Attempts int
+	Msg      Message `json:"-"`
+}
+
+// ValidationTimeout returns how long data stays pending validation before it is rejected
+func (dht *DHT) ValidationTimeout() time.Duration {
+	timeout := dht.config.ValidationTimeout
+	if timeout <= 0 {
+		timeout = DefaultValidationTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// isUnreachable returns true if an error sending to a node was because we couldn't reach
+// it, rather than an error response from it
+func (h *Holochain) isUnreachable(to peer.ID, err error) bool {
+	if err == SendTimeoutErr {
+		return true
+	}
+	if to == h.nodeID || h.node == nil {
+		return false
+	}
+	return h.node.host.Network().Connectedness(to) != net.Connected
+}
+
+func pendingKey(hash Hash) string {
+	return "pending:" + hash.String()
+}
+
+// getPending returns the pending validation of a hash, if there is one
+func (dht *DHT) getPending(hash Hash) (p *PendingValidation, err error) {
+	db := dht.ht.(*BuntHT).db
+	var v string
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		v, e = tx.Get(pendingKey(hash))
+		return e
+	})
+	if err == buntdb.ErrNotFound {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	var pv PendingValidation
+	err = ByteDecoder([]byte(v), &pv)
+	if err != nil {
+		return
+	}
+	p = &pv
+	return
+}
+
+// setPending persists a pending validation
+func (dht *DHT) setPending(p *PendingValidation) (err error) {
+	var b []byte
+	b, err = ByteEncoder(p)
+	if err != nil {
+		return
+	}
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, _, e := tx.Set(pendingKey(p.Hash), string(b), nil)
+		return e
+	})
+	return
+}
+
+// deletePending removes a pending validation if there is one
+func (dht *DHT) deletePending(hash Hash) (err error) {
+	db := dht.ht.(*BuntHT).db
+	err = db.Update(func(tx *buntdb.Tx) error {
+		_, e := tx.Delete(pendingKey(hash))
+		if e == buntdb.ErrNotFound {
+			e = nil
+		}
+		return e
+	})
+	return
+}
+
+// GetPendingValidations returns the changes waiting for their source to be reachable,
+// ordered by deadline
+func (dht *DHT) GetPendingValidations() (pending []PendingValidation, err error) {
+	pending = make([]PendingValidation, 0)
+	db := dht.ht.(*BuntHT).db
+	err = db.View(func(tx *buntdb.Tx) error {
+		var e error
+		err := tx.Ascend("pending", func(key, value string) bool {
+			var p PendingValidation
+			e = ByteDecoder([]byte(value), &p)
+			if e != nil {
+				return false
+			}
+			pending = append(pending, p)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		return e
+	})
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Deadline.Before(pending[j].Deadline) })
+	return
+}
+
+// validationPending records that a received change couldn't be validated because its
+// source was unreachable or its validation timed out, queueing it for retry or rejecting
+// it if its deadline passed
+func (dht *DHT) validationPending(a Action, msg *Message, attempts int) (response interface{}, err error) {
+	hash := msg.Body.(HoldReq).EntryHash
+	var p *PendingValidation
+	p, err = dht.getPending(hash)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if p == nil {
+		p = &PendingValidation{
+			Hash:     hash,
+			Action:   a.Name(),
+			Source:   peer.IDB58Encode(msg.From),
+			Since:    now,
+			Deadline: now.Add(dht.ValidationTimeout()),
+			Msg:      *msg,
+		}
+	}
+	p.Attempts++
+	if now.After(p.Deadline) {
+		err = dht.rejectPending(p)
+		if err == nil {
+			err = ErrValidationTimedOut
+		}
+		return
+	}
+	dht.dlog.Logf("couldn't validate %v from %s yet, trying again later", hash, p.Source)
+	err = dht.setPending(p)
+	if err != nil {
+		return
+	}
+	err = dht.queueRetry(msg, attempts)
+	if err == nil {
+		response = DHTChangeValidationPendingQueuedForRetry
+	}
+	return
+}
+
+// rejectPending marks data whose validation timed out as rejected and stops tracking it
+func (dht *DHT) rejectPending(p *PendingValidation) (err error) {
+	dht.dlog.Logf("validation of %v timed out, rejecting", p.Hash)
+	err = dht.Exists(p.Hash, StatusAny)
+	if err == ErrHashNotFound {
+		// record the hash as rejected so we don't try to validate it again
+		err = dht.Put(&p.Msg, "", p.Hash, p.Msg.From, []byte{}, StatusRejected)
+	} else if err == nil {
+		// we hold it already having validated it by other means, so leave it be
+		dht.dlog.Logf("already holding %v, not rejecting", p.Hash)
+	}
+	if err != nil {
+		return
+	}
+	err = dht.deletePending(p.Hash)
+	return
+}
+
+// isPendingValidation returns true if the message is waiting for its source to be reachable
+func (dht *DHT) isPendingValidation(msg *Message) bool {
+	t, ok := msg.Body.(HoldReq)
+	if !ok {
+		return false
+	}
+	p, err := dht.getPending(t.EntryHash)
+	return err == nil && p != nil
+}
+
+// validationDone stops tracking a change once it has been validated
+func (dht *DHT) validationDone(msg *Message) (err error) {
+	if dht.isPendingValidation(msg) {
+		err = dht.deletePending(msg.Body.(HoldReq).EntryHash)
+	}
+	return
+}
+
+// expirePendingValidations rejects any pending validations whose deadline has passed
+func (dht *DHT) expirePendingValidations() (err error) {
+	var pending []PendingValidation
+	pending, err = dht.GetPendingValidations()
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for i := range pending {
+		if now.Before(pending[i].Deadline) {
+			// they're ordered by deadline so the rest are later
+			break
+		}
+		err = dht.rejectPending(&pending[i])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package holochain
+
+import (
+	"errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestPendingValidation(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+	dht := h.dht
+
+	author, _ := makePeer("author")
+	e := GobEntry{C: "4"}
+	hash, _ := e.Sum(h.hashSpec)
+	m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash})
+	m.From = author
+	a, _ := MakeActionFromMessage(m)
+
+	Convey("it should default the validation timeout", t, func() {
+		So(dht.ValidationTimeout(), ShouldEqual, DefaultValidationTimeout*time.Second)
+		dht.config.ValidationTimeout = 60
+		So(dht.ValidationTimeout(), ShouldEqual, time.Minute)
+	})
+
+	Convey("it should tell unreachable nodes from error responses", t, func() {
+		So(h.isUnreachable(author, errors.New("some error")), ShouldBeTrue)
+		So(h.isUnreachable(h.nodeID, errors.New("some error")), ShouldBeFalse)
+		So(h.isUnreachable(h.nodeID, SendTimeoutErr), ShouldBeTrue)
+	})
+
+	Convey("it should track changes whose source is unreachable and queue them for retry", t, func() {
+		r, err := dht.validationPending(a, m, 0)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, DHTChangeValidationPendingQueuedForRetry)
+		pending, err := dht.GetPendingValidations()
+		So(err, ShouldBeNil)
+		So(len(pending), ShouldEqual, 1)
+		p := pending[0]
+		So(p.Hash.String(), ShouldEqual, hash.String())
+		So(p.Action, ShouldEqual, "put")
+		So(p.Attempts, ShouldEqual, 1)
+		So(p.Deadline.Sub(p.Since), ShouldEqual, time.Minute)
+		So(dht.isPendingValidation(m), ShouldBeTrue)
+
+		queued, _ := dht.GetQueued(RetryQueue)
+		So(len(queued), ShouldEqual, 1)
+
+		r, err = dht.validationPending(a, m, queued[0].Attempts)
+		So(r, ShouldEqual, DHTChangeValidationPendingQueuedForRetry)
+		pending, _ = dht.GetPendingValidations()
+		So(pending[0].Attempts, ShouldEqual, 2)
+		So(pending[0].Since, ShouldResemble, p.Since)
+	})
+
+	Convey("it should stop tracking changes once validated", t, func() {
+		So(dht.validationDone(m), ShouldBeNil)
+		So(dht.isPendingValidation(m), ShouldBeFalse)
+	})
+
+	Convey("it should reject changes whose validation timed out", t, func() {
+		dht.config.ValidationTimeout = 1
+		_, err := dht.validationPending(a, m, 0)
+		So(err, ShouldBeNil)
+		pending, _ := dht.GetPendingValidations()
+		pending[0].Deadline = time.Now().Add(-time.Second)
+		So(dht.setPending(&pending[0]), ShouldBeNil)
+
+		So(dht.expirePendingValidations(), ShouldBeNil)
+		pending, _ = dht.GetPendingValidations()
+		So(len(pending), ShouldEqual, 0)
+		_, _, _, status, err := dht.Get(hash, StatusAny, GetMaskAll)
+		So(err, ShouldBeNil)
+		So(status, ShouldEqual, StatusRejected)
+	})
+
+	Convey("the app should be able to query pending validations", t, func() {
+		_, err := dht.validationPending(a, m, 0)
+		So(err, ShouldBeNil)
+		f := &APIFnGetPendingValidations{}
+		r, err := f.Call(h)
+		So(err, ShouldBeNil)
+		So(len(r.([]PendingValidation)), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,186 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// validation_pool implements a bounded pool of workers for validating incoming DHT
+// changes concurrently.  Changes to the same hash are validated in the order they were
+// received, so that for example a Mod waits for the Put of the entry it modifies.
+
+package holochain
+
+import (
+	"sync"
+)
+
+const (
+	DefaultValidationWorkers = 4
+)
+
+// ValidationQueueStats holds metrics on the validation worker pool
+type ValidationQueueStats struct {
+	Workers   int // number of workers validating changes
+	Queued    int // changes waiting to be validated, including those waiting on the same hash
+	Active    int // changes being validated
+	Processed int // changes validated since the pool was started
+	MaxQueued int // the longest the queue has been
+}
+
+type validationJob struct {
+	key  string
+	fn   func()
+	done chan struct{}
+}
+
+type validationPool struct {
+	lk      sync.Mutex
+	cond    *sync.Cond
+	closed  bool
+	ready   []*validationJob
+	waiting map[string][]*validationJob // jobs waiting for an earlier job on the same hash
+	busy    map[string]bool             // hashes with a job ready or being validated
+	stats   ValidationQueueStats
+}
+
+func newValidationPool() *validationPool {
+	p := &validationPool{
+		waiting: make(map[string][]*validationJob),
+		busy:    make(map[string]bool),
+	}
+	p.cond = sync.NewCond(&p.lk)
+	return p
+}
+
+// validationKey returns the hash whose changes must be validated in order, which for
+// changes relating to an entry is the entry's hash
+func validationKey(msg *Message) string {
+	t, ok := msg.Body.(HoldReq)
+	if !ok {
+		return ""
+	}
+	if isRelatedHoldMessage(msg) {
+		return t.RelatedHash.String()
+	}
+	return t.EntryHash.String()
+}
+
+// start starts the pool's workers, until then jobs are run as they are submitted
+func (p *validationPool) start(workers int) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	if workers <= 0 || p.stats.Workers > 0 || p.closed {
+		return
+	}
+	p.stats.Workers = workers
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+}
+
+// stop stops the pool's workers, abandoning any jobs not yet started
+func (p *validationPool) stop() {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	p.closed = true
+	for _, j := range p.ready {
+		close(j.done)
+	}
+	for _, w := range p.waiting {
+		for _, j := range w {
+			close(j.done)
+		}
+	}
+	p.ready = nil
+	p.waiting = make(map[string][]*validationJob)
+	p.stats.Queued = 0
+	p.cond.Broadcast()
+}
+
+// submit adds a job to the pool returning a channel that is closed when it is done.
+// Jobs with the same key are run in the order they are submitted, an empty key
+// means the job doesn't need to be ordered.
+func (p *validationPool) submit(key string, fn func()) (done chan struct{}) {
+	done = make(chan struct{})
+	p.lk.Lock()
+	if p.closed {
+		p.lk.Unlock()
+		close(done)
+		return
+	}
+	if p.stats.Workers == 0 {
+		p.lk.Unlock()
+		fn()
+		close(done)
+		return
+	}
+	j := &validationJob{key: key, fn: fn, done: done}
+	if key != "" && p.busy[key] {
+		p.waiting[key] = append(p.waiting[key], j)
+	} else {
+		if key != "" {
+			p.busy[key] = true
+		}
+		p.ready = append(p.ready, j)
+		p.cond.Signal()
+	}
+	p.stats.Queued++
+	if p.stats.Queued > p.stats.MaxQueued {
+		p.stats.MaxQueued = p.stats.Queued
+	}
+	p.lk.Unlock()
+	return
+}
+
+// do runs a job in the pool and waits for it to finish.  It must never be called from
+// a job, as with every worker waiting on a job that can't start the pool deadlocks, so
+// anything a job needs done is done inline by the job itself.
+func (p *validationPool) do(key string, fn func()) {
+	<-p.submit(key, fn)
+}
+
+func (p *validationPool) work() {
+	for {
+		p.lk.Lock()
+		for len(p.ready) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.lk.Unlock()
+			return
+		}
+		j := p.ready[0]
+		p.ready = p.ready[1:]
+		p.stats.Queued--
+		p.stats.Active++
+		p.lk.Unlock()
+
+		j.fn()
+
+		p.lk.Lock()
+		p.stats.Active--
+		p.stats.Processed++
+		if j.key != "" && !p.closed {
+			if w := p.waiting[j.key]; len(w) > 0 {
+				// the next job on this hash can now be validated
+				p.ready = append(p.ready, w[0])
+				if len(w) == 1 {
+					delete(p.waiting, j.key)
+				} else {
+					p.waiting[j.key] = w[1:]
+				}
+				p.cond.Signal()
+			} else {
+				delete(p.busy, j.key)
+			}
+		}
+		p.lk.Unlock()
+		close(j.done)
+	}
+}
+
+// ValidationQueueStats returns metrics on the validation of incoming changes
+func (dht *DHT) ValidationQueueStats() ValidationQueueStats {
+	p := dht.vpool
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	return p.stats
+}
@@ -0,0 +1,123 @@
+package holochain
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidationPool(t *testing.T) {
+	Convey("it should run jobs as submitted when not started", t, func() {
+		p := newValidationPool()
+		ran := false
+		p.do("x", func() { ran = true })
+		So(ran, ShouldBeTrue)
+	})
+
+	Convey("it should validate jobs concurrently", t, func() {
+		p := newValidationPool()
+		p.start(3)
+		defer p.stop()
+		var wg sync.WaitGroup
+		wg.Add(3)
+		release := make(chan struct{})
+		for _, k := range []string{"a", "b", "c"} {
+			p.submit(k, func() {
+				wg.Done()
+				<-release
+			})
+		}
+		// all three have to be running at once for this to return
+		wg.Wait()
+		p.lk.Lock()
+		So(p.stats.Active, ShouldEqual, 3)
+		p.lk.Unlock()
+		close(release)
+	})
+
+	Convey("it should validate jobs on the same hash in order", t, func() {
+		p := newValidationPool()
+		p.start(4)
+		defer p.stop()
+		var lk sync.Mutex
+		var order []int
+		var last chan struct{}
+		for i := 0; i < 10; i++ {
+			n := i
+			last = p.submit("same", func() {
+				time.Sleep(time.Millisecond * time.Duration(10-n))
+				lk.Lock()
+				order = append(order, n)
+				lk.Unlock()
+			})
+		}
+		<-last
+		So(order, ShouldResemble, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+		p.lk.Lock()
+		So(p.stats.Processed, ShouldEqual, 10)
+		So(p.stats.Queued, ShouldEqual, 0)
+		So(p.stats.MaxQueued, ShouldBeGreaterThan, 1)
+		So(len(p.busy), ShouldEqual, 0)
+		p.lk.Unlock()
+	})
+
+	Convey("it should abandon jobs when stopped", t, func() {
+		p := newValidationPool()
+		p.start(1)
+		release := make(chan struct{})
+		p.submit("a", func() { <-release })
+		ran := false
+		done := p.submit("a", func() { ran = true })
+		p.stop()
+		<-done
+		close(release)
+		So(ran, ShouldBeFalse)
+	})
+
+	Convey("it should key changes by the hash they relate to", t, func() {
+		d, _, h := PrepareTestChain("test")
+		defer CleanupTestChain(h, d)
+		hash := commit(h, "evenNumbers", "2")
+		modHash := commit(h, "evenNumbers", "4")
+		m := h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash})
+		So(validationKey(m), ShouldEqual, hash.String())
+		m = h.node.NewMessage(MOD_REQUEST, HoldReq{EntryHash: modHash, RelatedHash: hash})
+		So(validationKey(m), ShouldEqual, hash.String())
+		So(h.dht.ValidationQueueStats().Workers, ShouldEqual, 0)
+	})
+
+	Convey("it should answer queries while every worker is busy", t, func() {
+		d, _, h := PrepareTestChain("test")
+		defer CleanupTestChain(h, d)
+		hash := commit(h, "evenNumbers", "2")
+		h.dht.vpool.start(2)
+		release := make(chan struct{})
+		for _, k := range []string{"a", "b"} {
+			h.dht.vpool.submit(k, func() { <-release })
+		}
+
+		got := make(chan interface{}, 1)
+		go func() {
+			r, _ := ActionReceiver(h, h.node.NewMessage(GET_REQUEST, GetReq{H: hash, StatusMask: StatusLive}))
+			got <- r
+		}()
+		var r interface{}
+		select {
+		case r = <-got:
+		case <-time.After(time.Second):
+		}
+		So(r, ShouldNotBeNil)
+		So(r.(GetResp).Entry.C, ShouldEqual, "2")
+
+		held := make(chan struct{})
+		go func() {
+			ActionReceiver(h, h.node.NewMessage(PUT_REQUEST, HoldReq{EntryHash: hash}))
+			close(held)
+		}()
+		time.Sleep(time.Millisecond * 50)
+		So(h.dht.ValidationQueueStats().Queued, ShouldEqual, 1)
+		close(release)
+		<-held
+	})
+}
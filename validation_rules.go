@@ -0,0 +1,354 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+
+// validation_rules implements declarative validation rules that can be set on an entry
+// definition in the DNA and are enforced natively, before (or instead of) calling the
+// ribosome's validation functions.
+
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"reflect"
+	"time"
+)
+
+// ValidationRules holds the declarative validation rules of an entry type.
+// UniquePerAgent and RateLimit are checked against the author's chain in the validation
+// package so every node reaches the same result. AuthorOnlyModify, ImmutableFields,
+// LinkTarget and MaxLinks depend on what the checking node can find on the DHT, so they
+// are source-only rules: they are only checked by the author when committing, and a
+// change that breaks them is never treated as invalid by the nodes that receive it.
+type ValidationRules struct {
+	// NoRibosome : (bool) if true only these rules are checked, and the ribosome's
+	// validation and packaging functions for the entry type are never called
+	NoRibosome bool
+
+	// AuthorOnlyModify : (bool) only the author of an entry may modify or delete it
+	AuthorOnlyModify bool
+
+	// ImmutableFields : ([]string) fields of a JSON entry that modifications may not change
+	ImmutableFields []string
+
+	// UniquePerAgent : (bool) each agent may commit only one entry of this type, other
+	// than modifications of it
+	UniquePerAgent bool
+
+	// LinkTarget : (string) for links entries, the entry type all link targets must be
+	LinkTarget string
+
+	// MaxLinks : (integer) for links entries, the maximum number of live links from a base
+	MaxLinks int
+
+	// RateLimit : the maximum number of entries of this type an agent may commit in a period
+	RateLimit *RateLimit
+}
+
+// RateLimit limits how many entries an agent may commit in a period of time
+type RateLimit struct {
+	Count  int // maximum number of entries
+	Period int // in seconds
+}
+
+const (
+	ValidationFailureAuthorOnlyModify = "only the author may modify or delete this entry"
+	ValidationFailureImmutableField   = "immutable field changed"
+	ValidationFailureUniquePerAgent   = "agent already has an entry of this type"
+	ValidationFailureLinkTarget       = "link target is not of the required type"
+	ValidationFailureMaxLinks         = "too many links from base"
+	ValidationFailureRateLimit        = "rate limit exceeded"
+	ValidationFailureNoAuthorChain    = "validation package is missing the author's chain"
+)
+
+// sourceRuleFailure is a failure of one of the source-only rules, which is a validation
+// failure but not one other nodes could reproduce, so it is never warranted
+type sourceRuleFailure struct {
+	error
+}
+
+func sourceRuleFailed(msg string) error {
+	return sourceRuleFailure{ValidationFailed(msg)}
+}
+
+// needsAuthorChain returns true if checking the rules needs the author's chain headers
+func (r *ValidationRules) needsAuthorChain() bool {
+	return r != nil && (r.UniquePerAgent || r.RateLimit != nil)
+}
+
+// addPackagingRequest adds what the rules need to a packaging request
+func (r *ValidationRules) addPackagingRequest(def *EntryDef, req PackagingReq) PackagingReq {
+	if !r.needsAuthorChain() {
+		return req
+	}
+	if req == nil {
+		req = PackagingReq{}
+	}
+	flags, ok := pkgReqChainFlags(req)
+	if !ok {
+		// limit the chain to the entry type if the app didn't ask for any of it
+		req[PkgReqEntryTypes] = []string{def.Name}
+	} else if v, ok := req[PkgReqEntryTypes]; ok {
+		types := pkgReqStrings(v)
+		found := false
+		for _, t := range types {
+			if t == def.Name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			req[PkgReqEntryTypes] = append(types, def.Name)
+		}
+	}
+	req[PkgReqChain] = flags | PkgReqChainOptHeaders
+	return req
+}
+
+// getEntryInfo gets parts of an entry from the local DHT, or the network if we don't hold it
+func (h *Holochain) getEntryInfo(hash Hash, mask int) (resp GetResp, err error) {
+	var r interface{}
+	r, err = h.dht.Query(hash, GET_REQUEST, GetReq{H: hash, StatusMask: StatusDefault, GetMask: mask})
+	if err != nil {
+		return
+	}
+	var ok bool
+	resp, ok = r.(GetResp)
+	if !ok {
+		err = ErrDHTUnexpectedTypeInBody
+	}
+	return
+}
+
+// authorHeaders returns the author's headers of an entry type that preceded the given
+// header, from the validation package, or from our own chain when we are the author
+func (h *Holochain) authorHeaders(entryType string, header *Header, vpkg *ValidationPackage, sources []peer.ID) (headers []*Header, err error) {
+	if vpkg == nil || vpkg.Chain == nil {
+		if len(sources) == 0 || sources[0] != h.nodeID {
+			err = ValidationFailed(ValidationFailureNoAuthorChain)
+			return
+		}
+		// we are committing so the header isn't on our chain yet
+		for _, hd := range h.chain.Headers {
+			if hd.Type == entryType {
+				headers = append(headers, hd)
+			}
+		}
+		return
+	}
+	for _, hd := range vpkg.Chain.Headers {
+		if header != nil && hd.EntryLink == header.EntryLink && hd.Time.Equal(header.Time) {
+			return
+		}
+		if hd.Type == entryType {
+			headers = append(headers, hd)
+		}
+	}
+	if header != nil {
+		// the header being validated has to be in the author's chain
+		err = ValidationFailed(ValidationFailureNoAuthorChain)
+	}
+	return
+}
+
+// checkNewEntryRules checks the rules that apply to committing an entry
+func (h *Holochain) checkNewEntryRules(def *EntryDef, header *Header, vpkg *ValidationPackage, sources []peer.ID) (err error) {
+	r := def.Rules
+	if !r.needsAuthorChain() || header == nil {
+		return
+	}
+	var headers []*Header
+	headers, err = h.authorHeaders(def.Name, header, vpkg, sources)
+	if err != nil {
+		return
+	}
+	if r.UniquePerAgent && header.Change == "" {
+		for _, hd := range headers {
+			if hd.Change == "" {
+				err = ValidationFailed(ValidationFailureUniquePerAgent)
+				return
+			}
+		}
+	}
+	if r.RateLimit != nil {
+		since := header.Time.Add(-time.Duration(r.RateLimit.Period) * time.Second)
+		count := 1
+		for _, hd := range headers {
+			if hd.Time.After(since) {
+				count++
+			}
+		}
+		if count > r.RateLimit.Count {
+			err = ValidationFailed(ValidationFailureRateLimit)
+			return
+		}
+	}
+	return
+}
+
+// checkModifyRules checks the rules that apply to modifying or deleting an entry
+func (h *Holochain) checkModifyRules(def *EntryDef, replaces Hash, entry Entry, sources []peer.ID) (err error) {
+	r := def.Rules
+	if r == nil || (!r.AuthorOnlyModify && len(r.ImmutableFields) == 0) {
+		return
+	}
+	mask := GetMaskSources
+	if entry != nil && len(r.ImmutableFields) > 0 {
+		mask |= GetMaskEntry
+	}
+	var orig GetResp
+	orig, err = h.getEntryInfo(replaces, mask)
+	if err != nil {
+		return
+	}
+	if r.AuthorOnlyModify {
+		if len(sources) == 0 || len(orig.Sources) == 0 || orig.Sources[0] != peer.IDB58Encode(sources[0]) {
+			err = sourceRuleFailed(ValidationFailureAuthorOnlyModify)
+			return
+		}
+	}
+	if entry != nil && len(r.ImmutableFields) > 0 && def.DataFormat == DataFormatJSON {
+		var old, changed map[string]interface{}
+		if err = json.Unmarshal([]byte(orig.Entry.Content().(string)), &old); err != nil {
+			return
+		}
+		if err = json.Unmarshal([]byte(entry.Content().(string)), &changed); err != nil {
+			return
+		}
+		for _, f := range r.ImmutableFields {
+			if !reflect.DeepEqual(old[f], changed[f]) {
+				err = sourceRuleFailed(fmt.Sprintf("%s: %s", ValidationFailureImmutableField, f))
+				return
+			}
+		}
+	}
+	return
+}
+
+// checkLinkRules checks the rules that apply to the links of a links entry
+func (h *Holochain) checkLinkRules(def *EntryDef, links []Link) (err error) {
+	r := def.Rules
+	if r == nil || (r.LinkTarget == "" && r.MaxLinks <= 0) {
+		return
+	}
+	added := make(map[string]int)
+	for _, l := range links {
+		if l.LinkAction == DelLinkAction {
+			continue
+		}
+		added[l.Base]++
+		if r.LinkTarget != "" {
+			var target Hash
+			target, err = NewHash(l.Link)
+			if err != nil {
+				return
+			}
+			var resp GetResp
+			resp, err = h.getEntryInfo(target, GetMaskEntryType)
+			if err != nil {
+				return
+			}
+			if resp.EntryType != r.LinkTarget {
+				err = sourceRuleFailed(ValidationFailureLinkTarget)
+				return
+			}
+		}
+	}
+	if r.MaxLinks > 0 {
+		for b, n := range added {
+			var base Hash
+			base, err = NewHash(b)
+			if err != nil {
+				return
+			}
+			var existing []TaggedHash
+			existing, err = h.dht.GetLinks(base, "", StatusLive)
+			if err == ErrHashNotFound {
+				err = nil
+			}
+			if err != nil {
+				return
+			}
+			if len(existing)+n > r.MaxLinks {
+				err = sourceRuleFailed(ValidationFailureMaxLinks)
+				return
+			}
+		}
+	}
+	return
+}
+
+// isSource returns true if we are the source of the action being validated
+func (h *Holochain) isSource(sources []peer.ID) bool {
+	return len(sources) > 0 && sources[0] == h.nodeID
+}
+
+// hasValidationRules returns true if any entry type of the DNA has validation rules
+func (h *Holochain) hasValidationRules() bool {
+	for _, z := range h.nucleus.dna.Zomes {
+		for _, d := range z.Entries {
+			if d.Rules != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkValidationRules checks an action against the declarative rules of its entry type
+func (h *Holochain) checkValidationRules(a ValidatingAction, def *EntryDef, vpkg *ValidationPackage, sources []peer.ID) (err error) {
+	switch t := a.(type) {
+	case *ActionDel:
+		// the rules that apply are those of the deleted entry's type, which we only
+		// need to look up if some type has rules, and the modify rules are source-only
+		if !h.isSource(sources) || !h.hasValidationRules() {
+			return
+		}
+		var resp GetResp
+		resp, err = h.getEntryInfo(t.entry.Hash, GetMaskEntryType)
+		if err != nil {
+			return
+		}
+		var d *EntryDef
+		_, d, err = h.GetEntryDef(resp.EntryType)
+		if err != nil || d.Rules == nil {
+			return
+		}
+		err = h.checkModifyRules(d, t.entry.Hash, nil, sources)
+		return
+	}
+	if def.Rules == nil {
+		return
+	}
+	switch t := a.(type) {
+	case *ActionCommit:
+		if def.DataFormat == DataFormatLinks {
+			if !h.isSource(sources) {
+				return
+			}
+			var le LinksEntry
+			le, err = LinksEntryFromJSON(t.entry.Content().(string))
+			if err != nil {
+				return
+			}
+			err = h.checkLinkRules(def, le.Links)
+			return
+		}
+		err = h.checkNewEntryRules(def, t.header, vpkg, sources)
+	case *ActionPut:
+		err = h.checkNewEntryRules(def, t.header, vpkg, sources)
+	case *ActionMod:
+		err = h.checkNewEntryRules(def, t.header, vpkg, sources)
+		if err == nil && h.isSource(sources) {
+			err = h.checkModifyRules(def, t.replaces, t.entry, sources)
+		}
+	case *ActionLink:
+		if h.isSource(sources) {
+			err = h.checkLinkRules(def, t.links)
+		}
+	}
+	return
+}
@@ -0,0 +1,177 @@
+package holochain
+
+import (
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidationRules(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	// GetEntryDef returns copies so set the rules on the DNA's defs
+	dnaEntryDef := func(entryType string) *EntryDef {
+		for i := range h.nucleus.dna.Zomes {
+			z := &h.nucleus.dna.Zomes[i]
+			for j := range z.Entries {
+				if z.Entries[j].Name == entryType {
+					return &z.Entries[j]
+				}
+			}
+		}
+		return nil
+	}
+	profileDef := dnaEntryDef("profile")
+	ratingDef := dnaEntryDef("rating")
+
+	tryCommit := func(entryType, entryStr string) (err error) {
+		a := NewCommitAction(entryType, &GobEntry{C: entryStr})
+		fn := &APIFnCommit{}
+		fn.SetAction(a)
+		_, err = fn.Call(h)
+		return
+	}
+
+	Convey("it should add the author's chain to the packaging request when needed", t, func() {
+		var r *ValidationRules
+		So(r.addPackagingRequest(profileDef, nil), ShouldBeNil)
+
+		r = &ValidationRules{UniquePerAgent: true}
+		req := r.addPackagingRequest(profileDef, nil)
+		So(req[PkgReqChain], ShouldEqual, int64(PkgReqChainOptHeaders))
+		So(req[PkgReqEntryTypes], ShouldResemble, []string{"profile"})
+
+		req = r.addPackagingRequest(profileDef, PackagingReq{PkgReqChain: int64(PkgReqChainOptEntries), PkgReqEntryTypes: []string{"rating"}})
+		So(req[PkgReqChain], ShouldEqual, int64(PkgReqChainOptEntries|PkgReqChainOptHeaders))
+		So(req[PkgReqEntryTypes], ShouldResemble, []string{"rating", "profile"})
+	})
+
+	Convey("it should keep the chain options whatever number type the ribosome returned", t, func() {
+		r := &ValidationRules{UniquePerAgent: true}
+		req := r.addPackagingRequest(profileDef, PackagingReq{PkgReqChain: float64(PkgReqChainOptEntries), PkgReqEntryTypes: []interface{}{"rating"}})
+		So(req[PkgReqChain], ShouldEqual, int64(PkgReqChainOptEntries|PkgReqChainOptHeaders))
+		So(req[PkgReqEntryTypes], ShouldResemble, []string{"rating", "profile"})
+
+		req = r.addPackagingRequest(profileDef, PackagingReq{PkgReqChain: int(PkgReqChainOptEntries)})
+		So(req[PkgReqChain], ShouldEqual, int64(PkgReqChainOptEntries|PkgReqChainOptHeaders))
+
+		flags, ok := pkgReqChainFlags(PackagingReq{PkgReqChain: float64(PkgReqChainOptFull)})
+		So(ok, ShouldBeTrue)
+		So(flags, ShouldEqual, int64(PkgReqChainOptFull))
+		_, ok = pkgReqChainFlags(PackagingReq{})
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("it should only allow one entry of a type per agent", t, func() {
+		profileDef.Rules = &ValidationRules{UniquePerAgent: true}
+		So(tryCommit("profile", `{"firstName":"Zippy","lastName":"Pinhead"}`), ShouldBeNil)
+		err := tryCommit("profile", `{"firstName":"Zerbina","lastName":"Pinhead"}`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureUniquePerAgent)
+	})
+
+	Convey("it should limit the rate of commits", t, func() {
+		profileDef.Rules = &ValidationRules{RateLimit: &RateLimit{Count: 2, Period: 60}}
+		So(tryCommit("profile", `{"firstName":"Pebbles","lastName":"Flintstone"}`), ShouldBeNil)
+		err := tryCommit("profile", `{"firstName":"Bam-Bam","lastName":"Rubble"}`)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureRateLimit)
+	})
+
+	profileDef.Rules = nil
+	profileHash := commit(h, "profile", `{"firstName":"Fred","lastName":"Flintstone","id":1}`)
+
+	Convey("it should only allow the author to modify an entry", t, func() {
+		profileDef.Rules = &ValidationRules{AuthorOnlyModify: true}
+		entry := &GobEntry{C: `{"firstName":"Fred","lastName":"Flintstone","id":1}`}
+		So(h.checkModifyRules(profileDef, profileHash, entry, []peer.ID{h.nodeID}), ShouldBeNil)
+		other, _ := makePeer("other")
+		err := h.checkModifyRules(profileDef, profileHash, entry, []peer.ID{other})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureAuthorOnlyModify)
+	})
+
+	Convey("it should not allow immutable fields to change", t, func() {
+		profileDef.Rules = &ValidationRules{ImmutableFields: []string{"id"}}
+		entry := &GobEntry{C: `{"firstName":"Freddy","lastName":"Flintstone","id":1}`}
+		So(h.checkModifyRules(profileDef, profileHash, entry, []peer.ID{h.nodeID}), ShouldBeNil)
+		entry = &GobEntry{C: `{"firstName":"Fred","lastName":"Flintstone","id":2}`}
+		err := h.checkModifyRules(profileDef, profileHash, entry, []peer.ID{h.nodeID})
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureImmutableField+": id")
+	})
+	profileDef.Rules = nil
+
+	Convey("it should check the type of link targets", t, func() {
+		links := []Link{{Base: h.nodeIDStr, Link: profileHash.String(), Tag: "4stars"}}
+		ratingDef.Rules = &ValidationRules{LinkTarget: "profile"}
+		So(h.checkLinkRules(ratingDef, links), ShouldBeNil)
+		ratingDef.Rules = &ValidationRules{LinkTarget: "evenNumbers"}
+		err := h.checkLinkRules(ratingDef, links)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureLinkTarget)
+	})
+
+	Convey("it should limit the number of links from a base", t, func() {
+		ratingDef.Rules = &ValidationRules{MaxLinks: 1}
+		link := func(base Hash) string {
+			return fmt.Sprintf(`{"Links":[{"Base":"%s","Link":"%s","Tag":"4stars"}]}`, base.String(), profileHash.String())
+		}
+		So(tryCommit("rating", link(profileHash)), ShouldBeNil)
+		err := tryCommit("rating", link(profileHash))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ValidationFailureMaxLinks)
+		ratingDef.Rules = nil
+	})
+
+	Convey("it should only look up the type of deleted entries if some type has rules", t, func() {
+		missing, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		a := NewDelAction(DelEntry{Hash: missing})
+		So(h.hasValidationRules(), ShouldBeFalse)
+		So(h.checkValidationRules(a, nil, nil, []peer.ID{h.nodeID}), ShouldBeNil)
+
+		profileDef.Rules = &ValidationRules{AuthorOnlyModify: true}
+		So(h.hasValidationRules(), ShouldBeTrue)
+		So(h.checkValidationRules(a, nil, nil, []peer.ID{h.nodeID}), ShouldNotBeNil)
+		profileDef.Rules = nil
+	})
+
+	Convey("it should only check the source-only rules when we are the source", t, func() {
+		other, _ := makePeer("other")
+		missing, _ := NewHash("QmY8Mzg9F69e5P9AoQPYat655HEhc1TVGs11tmfNSzkqh2")
+		profileDef.Rules = &ValidationRules{AuthorOnlyModify: true}
+		ratingDef.Rules = &ValidationRules{LinkTarget: "profile"}
+		del := NewDelAction(DelEntry{Hash: missing})
+		So(h.checkValidationRules(del, nil, nil, []peer.ID{other}), ShouldBeNil)
+		links := []Link{{Base: h.nodeIDStr, Link: missing.String(), Tag: "4stars"}}
+		link := NewLinkAction("rating", links)
+		So(h.checkValidationRules(link, ratingDef, nil, []peer.ID{other}), ShouldBeNil)
+		So(h.checkValidationRules(link, ratingDef, nil, []peer.ID{h.nodeID}), ShouldNotBeNil)
+		profileDef.Rules = nil
+		ratingDef.Rules = nil
+	})
+
+	Convey("it should save and load rules in the DNA file", t, func() {
+		profileDef.Rules = &ValidationRules{UniquePerAgent: true, ImmutableFields: []string{"id"}}
+		root := filepath.Join(d, "rules")
+		So(os.MkdirAll(filepath.Join(root, ChainDNADir), os.ModePerm), ShouldBeNil)
+		So(s.saveDNAFile(root, h.nucleus.dna, "json", false), ShouldBeNil)
+		dna, err := s.loadDNA(filepath.Join(root, ChainDNADir), DNAFileName, "json")
+		So(err, ShouldBeNil)
+		var rules *ValidationRules
+		for _, z := range dna.Zomes {
+			for _, e := range z.Entries {
+				if e.Name == "profile" {
+					rules = e.Rules
+				}
+			}
+		}
+		So(rules, ShouldResemble, profileDef.Rules)
+		profileDef.Rules = nil
+	})
+}
@@ -7,14 +7,19 @@
 package holochain
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	. "github.com/holochain/holochain-proto/hash"
 	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"strconv"
+	"strings"
 )
 
 const (
 	SelfRevocationType = iota
+	InvalidDataType
 )
 
 // Warrant abstracts the notion of a multi-party cryptographically verifiable signed claim
@@ -45,6 +50,7 @@ type Warrant interface {
 
 var WarrantPropertyNotFoundErr = errors.New("warrant property not found")
 var UnknownWarrantTypeErr = errors.New("unknown warrant type")
+var MissingWarrantErr = errors.New("missing warrant")
 
 // SelfRevocationWarrant warrants that the first party revoked its own key in favor of the second
 type SelfRevocationWarrant struct {
@@ -62,6 +68,9 @@ func DecodeWarrant(warrantType int, data []byte) (w Warrant, err error) {
 	case SelfRevocationType:
 		w = &SelfRevocationWarrant{}
 		err = w.Decode(data)
+	case InvalidDataType:
+		w = &InvalidDataWarrant{}
+		err = w.Decode(data)
 	default:
 		err = UnknownWarrantTypeErr
 	}
@@ -158,3 +167,310 @@ func (w *SelfRevocationWarrant) Decode(data []byte) (err error) {
 	err = w.Revocation.Unmarshal(string(data))
 	return
 }
+
+// InvalidDataWarrant warrants that the first party published data that fails validation,
+// as attested by the second party who issued the warrant
+type InvalidDataWarrant struct {
+	Author     []byte // marshaled public key of the author of the invalid data
+	Header     Header
+	HeaderSig  Signature // author's signature of the whole header, so its type can be trusted
+	Entry      GobEntry
+	Package    Package   // the validation package the author supplied
+	PackageSig Signature // author's signature of the package
+	Reason     string    // the validation failure
+	Issuer     []byte    // marshaled public key of the node issuing the warrant
+	IssuerSig  Signature
+}
+
+var ErrUnsignedValidationResponse = errors.New("validation response isn't signed")
+
+// NewInvalidDataWarrant creates a warrant against the author of an entry that failed
+// validation, signed by this node
+func NewInvalidDataWarrant(h *Holochain, author ic.PubKey, resp *ValidateResponse, reason error) (wP *InvalidDataWarrant, err error) {
+	if len(resp.HeaderSig.S) == 0 || len(resp.PackageSig.S) == 0 {
+		err = ErrUnsignedValidationResponse
+		return
+	}
+	w := InvalidDataWarrant{
+		Header:     resp.Header,
+		HeaderSig:  resp.HeaderSig,
+		Entry:      resp.Entry,
+		Package:    resp.Package,
+		PackageSig: resp.PackageSig,
+		Reason:     reason.Error(),
+	}
+	w.Author, err = ic.MarshalPublicKey(author)
+	if err != nil {
+		return
+	}
+	w.Issuer, err = ic.MarshalPublicKey(h.agent.PubKey())
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = w.signedData(h)
+	if err != nil {
+		return
+	}
+	w.IssuerSig, err = h.Sign(data)
+	if err != nil {
+		return
+	}
+	wP = &w
+	return
+}
+
+// signedData returns the data the issuer signs, the hash of the offending header and the reason
+func (w *InvalidDataWarrant) signedData(h *Holochain) (data []byte, err error) {
+	var hash Hash
+	hash, _, err = w.Header.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	data = append([]byte(hash), []byte(w.Reason)...)
+	return
+}
+
+func (w *InvalidDataWarrant) Type() int {
+	return InvalidDataType
+}
+
+func keyHash(key []byte) (hash Hash, pubKey ic.PubKey, err error) {
+	pubKey, err = ic.UnmarshalPublicKey(key)
+	if err != nil {
+		return
+	}
+	var ID peer.ID
+	ID, err = peer.IDFromPublicKey(pubKey)
+	if err != nil {
+		return
+	}
+	hash = HashFromPeerID(ID)
+	return
+}
+
+func (w *InvalidDataWarrant) Parties() (parties []Hash, err error) {
+	var author, issuer Hash
+	author, _, err = keyHash(w.Author)
+	if err != nil {
+		return
+	}
+	issuer, _, err = keyHash(w.Issuer)
+	if err != nil {
+		return
+	}
+	parties = append(parties, author, issuer)
+	return
+}
+
+func (w *InvalidDataWarrant) Verify(h *Holochain) (err error) {
+	var authorKey, issuerKey ic.PubKey
+	var author Hash
+	author, authorKey, err = keyHash(w.Author)
+	if err != nil {
+		return
+	}
+	_, issuerKey, err = keyHash(w.Issuer)
+	if err != nil {
+		return
+	}
+
+	// check that the author really did sign the entry
+	var hash Hash
+	hash, err = w.Entry.Sum(h.hashSpec)
+	if err != nil {
+		return
+	}
+	if !hash.Equal(w.Header.EntryLink) {
+		err = errors.New("entry doesn't match header")
+		return
+	}
+	var matches bool
+	matches, err = authorKey.Verify([]byte(w.Header.EntryLink), w.Header.Sig.S)
+	if err != nil {
+		return
+	}
+	if !matches {
+		err = errors.New("header not signed by author")
+		return
+	}
+
+	// and the header's type and the package, as the issuer could have changed them
+	var b []byte
+	if b, err = w.Header.Marshal(); err != nil {
+		return
+	}
+	if matches, err = authorKey.Verify(b, w.HeaderSig.S); err != nil {
+		return
+	}
+	if !matches {
+		err = errors.New("whole header not signed by author")
+		return
+	}
+	if b, err = ByteEncoder(&w.Package); err != nil {
+		return
+	}
+	if matches, err = authorKey.Verify(b, w.PackageSig.S); err != nil {
+		return
+	}
+	if !matches {
+		err = errors.New("package not signed by author")
+		return
+	}
+
+	// check that the issuer stands behind the warrant
+	var data []byte
+	data, err = w.signedData(h)
+	if err != nil {
+		return
+	}
+	matches, err = issuerKey.Verify(data, w.IssuerSig.S)
+	if err != nil {
+		return
+	}
+	if !matches {
+		err = errors.New("warrant not signed by issuer")
+		return
+	}
+
+	// and finally that the data really is invalid
+	a := NewPutAction(w.Header.Type, &w.Entry, &w.Header)
+	_, err = h.ValidateAction(a, w.Header.Type, &w.Package, []peer.ID{PeerIDFromHash(author)})
+	if err == nil {
+		err = errors.New("warranted data is valid")
+		return
+	}
+	if !isWarrantableErr(err) {
+		err = fmt.Errorf("unable to confirm warranted data is invalid: %v", err)
+		return
+	}
+	err = nil
+	return
+}
+
+func (w *InvalidDataWarrant) Property(key string) (value interface{}, err error) {
+	switch key {
+	case "reason":
+		value = w.Reason
+	case "entryType":
+		value = w.Header.Type
+	case "entryHash":
+		value = w.Header.EntryLink
+	default:
+		err = WarrantPropertyNotFoundErr
+	}
+	return
+}
+
+func (w *InvalidDataWarrant) Encode() (data []byte, err error) {
+	data, err = ByteEncoder(w)
+	return
+}
+
+func (w *InvalidDataWarrant) Decode(data []byte) (err error) {
+	err = ByteDecoder(data, w)
+	return
+}
+
+// isWarrantableErr returns true if an error from validating data is a failure that every
+// node would reproduce from the data and its validation package alone. Timeouts, errors
+// getting anything from the network and failures of the source-only rules are not.
+func isWarrantableErr(err error) bool {
+	if err == nil || IsExecutionTimeoutErr(err) {
+		return false
+	}
+	if _, ok := err.(sourceRuleFailure); ok {
+		return false
+	}
+	return IsValidationFailedErr(err)
+}
+
+// warrantInvalidData issues a warrant against the source of data that failed validation,
+// which blocks it here and on the nodes that verify the warrant
+func (h *Holochain) warrantInvalidData(source peer.ID, resp *ValidateResponse, reason error) (err error) {
+	if !isWarrantableErr(reason) {
+		err = fmt.Errorf("%v can't be warranted as other nodes may not reproduce it", reason)
+		return
+	}
+	var author ic.PubKey
+	if author, err = h.getNodePubKey(source); err != nil {
+		return
+	}
+	var w *InvalidDataWarrant
+	if w, err = NewInvalidDataWarrant(h, author, resp, reason); err != nil {
+		return
+	}
+	err = h.BlockWithWarrant(w)
+	return
+}
+
+// checkWarrantCovers confirms that a warrant, already verified, justifies adding the
+// peers to the list, i.e. that they are the party the warrant is against
+func checkWarrantCovers(w Warrant, list PeerList) (err error) {
+	var parties []Hash
+	parties, err = w.Parties()
+	if err != nil {
+		return
+	}
+	if len(parties) == 0 {
+		err = errors.New("warrant has no parties")
+		return
+	}
+	for _, r := range list.Records {
+		if !HashFromPeerID(r.ID).Equal(parties[0]) {
+			err = fmt.Errorf("warrant is not against %v", r.ID)
+			return
+		}
+	}
+	return
+}
+
+// encodeWarrantRecord encodes a warrant for storing with a peer list record
+func encodeWarrantRecord(warrantType int, data []byte) string {
+	return fmt.Sprintf("%d:%s", warrantType, base64.StdEncoding.EncodeToString(data))
+}
+
+// GetWarrant returns the warrant stored with a peer list record
+func (r *PeerRecord) GetWarrant() (w Warrant, err error) {
+	x := strings.SplitN(r.Warrant, ":", 2)
+	if len(x) != 2 {
+		err = MissingWarrantErr
+		return
+	}
+	var warrantType int
+	warrantType, err = strconv.Atoi(x[0])
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = base64.StdEncoding.DecodeString(x[1])
+	if err != nil {
+		return
+	}
+	w, err = DecodeWarrant(warrantType, data)
+	return
+}
+
+// BlockWithWarrant adds the party a warrant is against to the blocked list, gossiping
+// the warrant so that other nodes can verify it and do the same
+func (h *Holochain) BlockWithWarrant(w Warrant) (err error) {
+	var parties []Hash
+	parties, err = w.Parties()
+	if err != nil {
+		return
+	}
+	var data []byte
+	data, err = w.Encode()
+	if err != nil {
+		return
+	}
+	// TODO, this isn't really a DHT send, but a management send, so the key is bogus.  have to work this out...
+	err = h.dht.Change(parties[0], LISTADD_REQUEST,
+		ListAddReq{
+			ListType:    BlockedList,
+			Peers:       []string{parties[0].String()},
+			WarrantType: w.Type(),
+			Warrant:     data,
+		})
+	return
+}
@@ -2,10 +2,13 @@ package holochain
 
 import (
 	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	ic "github.com/libp2p/go-libp2p-crypto"
 	peer "github.com/libp2p/go-libp2p-peer"
 	. "github.com/smartystreets/goconvey/convey"
 
 	"testing"
+	"time"
 )
 
 func TestSelfRevocationWarrant(t *testing.T) {
@@ -88,3 +91,177 @@ func TestSelfRevocationWarrant(t *testing.T) {
 
 	})
 }
+
+func makeInvalidDataResponse(h *Holochain, author ic.PrivKey, content string) ValidateResponse {
+	entry := GobEntry{C: content}
+	_, hd, err := newHeader(h.hashSpec, time.Now(), "evenNumbers", &entry, author, NullHash(), NullHash(), NullHash())
+	if err != nil {
+		panic(err)
+	}
+	resp := ValidateResponse{Type: "evenNumbers", Header: *hd, Entry: entry}
+	b, _ := hd.Marshal()
+	resp.HeaderSig.S, err = author.Sign(b)
+	if err != nil {
+		panic(err)
+	}
+	b, _ = ByteEncoder(&resp.Package)
+	resp.PackageSig.S, err = author.Sign(b)
+	if err != nil {
+		panic(err)
+	}
+	return resp
+}
+
+func TestInvalidDataWarrant(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	authorID, authorKey := makePeer("author")
+	resp := makeInvalidDataResponse(h, authorKey, "3")
+	w, err := NewInvalidDataWarrant(h, authorKey.GetPublic(), &resp, ValidationFailed("3 is not even"))
+
+	Convey("NewInvalidDataWarrant should create one", t, func() {
+		So(err, ShouldBeNil)
+		So(w.Type(), ShouldEqual, InvalidDataType)
+	})
+
+	Convey("it should have the author and issuer as parties", t, func() {
+		parties, err := w.Parties()
+		So(err, ShouldBeNil)
+		So(len(parties), ShouldEqual, 2)
+		So(parties[0].String(), ShouldEqual, peer.IDB58Encode(authorID))
+		So(parties[1].String(), ShouldEqual, h.nodeIDStr)
+	})
+
+	Convey("it should have properties", t, func() {
+		reason, err := w.Property("reason")
+		So(err, ShouldBeNil)
+		So(reason, ShouldEqual, "Validation Failed: 3 is not even")
+		entryHash, _ := w.Property("entryHash")
+		So(entryHash.(Hash).String(), ShouldEqual, resp.Header.EntryLink.String())
+		_, err = w.Property("foo")
+		So(err, ShouldEqual, WarrantPropertyNotFoundErr)
+	})
+
+	Convey("it should verify when the data is invalid", t, func() {
+		So(w.Verify(h), ShouldBeNil)
+	})
+
+	Convey("it should encode and decode", t, func() {
+		data, err := w.Encode()
+		So(err, ShouldBeNil)
+		w2, err := DecodeWarrant(InvalidDataType, data)
+		So(err, ShouldBeNil)
+		So(w2.Verify(h), ShouldBeNil)
+	})
+
+	Convey("it should not verify when the data is valid", t, func() {
+		good := makeInvalidDataResponse(h, authorKey, "4")
+		w, _ := NewInvalidDataWarrant(h, authorKey.GetPublic(), &good, ValidationFailed("4 is not even"))
+		So(w.Verify(h).Error(), ShouldEqual, "warranted data is valid")
+	})
+
+	Convey("it should not verify when the header wasn't signed by the author", t, func() {
+		_, otherKey := makePeer("other")
+		w, _ := NewInvalidDataWarrant(h, otherKey.GetPublic(), &resp, ValidationFailed("3 is not even"))
+		So(w.Verify(h).Error(), ShouldEqual, "header not signed by author")
+	})
+
+	Convey("it should not verify when tampered with", t, func() {
+		w2 := *w
+		w2.Reason = "something else"
+		So(w2.Verify(h).Error(), ShouldEqual, "warrant not signed by issuer")
+		w2 = *w
+		w2.Entry.C = "5"
+		So(w2.Verify(h).Error(), ShouldEqual, "entry doesn't match header")
+		w2 = *w
+		w2.Header.Type = "oddNumbers"
+		So(w2.Verify(h).Error(), ShouldEqual, "whole header not signed by author")
+		w2 = *w
+		w2.Package = Package{Chain: []byte("some other chain")}
+		So(w2.Verify(h).Error(), ShouldEqual, "package not signed by author")
+	})
+
+	Convey("it should only be made from signed validation responses", t, func() {
+		unsigned := resp
+		unsigned.PackageSig = Signature{}
+		_, err := NewInvalidDataWarrant(h, authorKey.GetPublic(), &unsigned, ValidationFailed("3 is not even"))
+		So(err, ShouldEqual, ErrUnsignedValidationResponse)
+
+		hash := commit(h, "evenNumbers", "2")
+		resp, err := h.GetValidationResponse(NewPutAction("evenNumbers", &GobEntry{C: "2"}, &Header{}), hash)
+		So(err, ShouldBeNil)
+		w, err := NewInvalidDataWarrant(h, h.agent.PubKey(), &resp, ValidationFailed("2 is not even"))
+		So(err, ShouldBeNil)
+		So(w.Verify(h).Error(), ShouldEqual, "warranted data is valid")
+	})
+
+	Convey("it should only warrant failures every node would reproduce", t, func() {
+		So(isWarrantableErr(ValidationFailed("3 is not even")), ShouldBeTrue)
+		So(isWarrantableErr(sourceRuleFailed(ValidationFailureMaxLinks)), ShouldBeFalse)
+		So(isWarrantableErr(&ExecutionTimeoutError{Callback: "validatePut", Timeout: time.Second}), ShouldBeFalse)
+		So(isWarrantableErr(ErrHashNotFound), ShouldBeFalse)
+		So(isWarrantableErr(nil), ShouldBeFalse)
+
+		err := h.warrantInvalidData(authorID, &resp, sourceRuleFailed(ValidationFailureMaxLinks))
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "can't be warranted")
+	})
+}
+
+func TestWarrantBlockedList(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	authorID, authorKey := makePeer("author")
+	resp := makeInvalidDataResponse(h, authorKey, "3")
+	w, _ := NewInvalidDataWarrant(h, authorKey.GetPublic(), &resp, ValidationFailed("3 is not even"))
+	data, _ := w.Encode()
+
+	Convey("LISTADD_REQUEST without a warrant should return error", t, func() {
+		m := h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType: BlockedList,
+				Peers:    []string{peer.IDB58Encode(authorID)},
+			})
+		_, err := ActionReceiver(h, m)
+		So(err.Error(), ShouldEqual, "List add request rejected on warrant failure: missing warrant")
+	})
+
+	Convey("LISTADD_REQUEST with a warrant against someone else should return error", t, func() {
+		otherID, _ := makePeer("other")
+		m := h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType:    BlockedList,
+				Peers:       []string{peer.IDB58Encode(otherID)},
+				WarrantType: InvalidDataType,
+				Warrant:     data,
+			})
+		_, err := ActionReceiver(h, m)
+		So(err.Error(), ShouldEqual, fmt.Sprintf("List add request rejected on warrant failure: warrant is not against %v", otherID))
+		So(h.node.IsBlocked(otherID), ShouldBeFalse)
+	})
+
+	Convey("LISTADD_REQUEST with a verified invalid data warrant should block the author", t, func() {
+		m := h.node.NewMessage(LISTADD_REQUEST,
+			ListAddReq{
+				ListType:    BlockedList,
+				Peers:       []string{peer.IDB58Encode(authorID)},
+				WarrantType: InvalidDataType,
+				Warrant:     data,
+			})
+		r, err := ActionReceiver(h, m)
+		So(err, ShouldBeNil)
+		So(r, ShouldEqual, DHTChangeOK)
+		So(h.node.IsBlocked(authorID), ShouldBeTrue)
+
+		peerList, err := h.dht.getList(BlockedList)
+		So(err, ShouldBeNil)
+		So(len(peerList.Records), ShouldEqual, 1)
+		So(peerList.Records[0].ID, ShouldEqual, authorID)
+		stored, err := peerList.Records[0].GetWarrant()
+		So(err, ShouldBeNil)
+		So(stored.Type(), ShouldEqual, InvalidDataType)
+		So(stored.Verify(h), ShouldBeNil)
+	})
+}
@@ -0,0 +1,1023 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// WASMRibosome implements a WebAssembly use of the Ribosome interface
+//
+// Zome code is a WebAssembly module which must export its memory and an allocator:
+//
+//   alloc(len i32) i32
+//
+// Nothing the allocator hands out needs to be freed, as the module's memory and globals
+// are put back as they were when it was loaded after every call into it.
+//
+// Every callback and zome function the module exports takes the pointer and length of
+// its input in the module's memory, and returns the pointer and length of its output
+// packed into an i64 as (ptr << 32 | len), or 0 for no output.  Inputs and outputs are
+// JSON, except for the input and output of string calling zome functions which are the
+// strings themselves.
+//
+// The holochain API functions (commit, get, getLinks, query, send, etc.) are imported
+// from the "hc" module.  Each takes the pointer and length of a JSON array of its
+// arguments and returns the length of its JSON result, which the module then copies
+// into memory it has allocated by calling hc.result(ptr).  A negative length means the
+// call failed and the result is the error message.  A module can fail the callback or
+// function it is running by calling hc.error(ptr, len) with an error message.
+
+package holochain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/perlin-network/life/exec"
+	"strings"
+	"time"
+)
+
+const (
+	WASMRibosomeType = "wasm"
+
+	// WASMImportModule is the name of the module the holochain API is imported from
+	WASMImportModule = "hc"
+
+	wasmDefaultMemoryPages = 128
+	wasmMaxMemoryPages     = 4096
+	wasmDefaultTableSize   = 65536
+)
+
+var ErrWASMRunNotSupported = errors.New("the wasm ribosome can't run source code")
+var ErrWASMNoAllocator = errors.New("zome module doesn't export alloc")
+var ErrWASMOutOfBounds = errors.New("zome module memory access out of bounds")
+var ErrWASMUnknownImport = errors.New("zome module imports something holochain doesn't provide")
+
+// WASMRibosome holds data needed for the WebAssembly VM
+type WASMRibosome struct {
+	h      *Holochain
+	zome   *Zome
+	vm     *exec.VirtualMachine
+	result []byte // the result of the last API call, waiting to be copied into the module
+	err    error  // an error raised by the module with hc.error
+
+	memory  []byte  // the module's memory as it was when loaded
+	globals []int64 // the module's globals as they were when loaded
+}
+
+type wasmAPIFn func(wr *WASMRibosome, args []json.RawMessage) (result interface{}, err error)
+
+// wasmResolver resolves the module's imports to the holochain API
+type wasmResolver struct {
+	wr  *WASMRibosome
+	err error // the first import that couldn't be resolved
+}
+
+// encodeWASMCode encodes a compiled module as zome code, which has to be text as it is
+// stored in the DNA
+func encodeWASMCode(code []byte) string {
+	return base64.StdEncoding.EncodeToString(code)
+}
+
+// decodeWASMCode decodes zome code back into a compiled module
+func decodeWASMCode(code string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(code)
+}
+
+// Type returns the string value under which this ribosome is registered
+func (wr *WASMRibosome) Type() string { return WASMRibosomeType }
+
+// NewWASMRibosome factory function to build a WebAssembly execution environment for a zome
+func NewWASMRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
+	wr := WASMRibosome{
+		h:    h,
+		zome: zome,
+	}
+	var code []byte
+	code, err = decodeWASMCode(zome.Code)
+	if err != nil {
+		return
+	}
+	resolver := &wasmResolver{wr: &wr}
+	wr.vm, err = exec.NewVirtualMachine(code, exec.VMConfig{
+		DefaultMemoryPages: wasmDefaultMemoryPages,
+		MaxMemoryPages:     wasmMaxMemoryPages,
+		DefaultTableSize:   wasmDefaultTableSize,
+	}, resolver, nil)
+	if err == nil {
+		err = resolver.err
+	}
+	if err == nil {
+		// function imports are only resolved when first called so check them now
+		for _, imp := range wr.vm.FunctionImports {
+			if _, err = resolver.resolveFunc(imp.ModuleName, imp.FieldName); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("error loading wasm module for zome %s: %v", zome.Name, err)
+		return
+	}
+	if _, ok := wr.vm.GetFunctionExport("alloc"); !ok {
+		err = ErrWASMNoAllocator
+		return
+	}
+	wr.memory = append([]byte{}, wr.vm.Memory...)
+	wr.globals = append([]int64{}, wr.vm.Globals...)
+	n = &wr
+	return
+}
+
+// ResolveFunc implements exec.ImportResolver returning the holochain API functions.
+// Unknown imports are rejected when the module is loaded, so should one get here it
+// just fails the call it was made from.
+func (r *wasmResolver) ResolveFunc(module, field string) exec.FunctionImport {
+	fn, err := r.resolveFunc(module, field)
+	if err != nil {
+		wr := r.wr
+		return func(vm *exec.VirtualMachine) int64 {
+			wr.err = err
+			return 0
+		}
+	}
+	return fn
+}
+
+// resolveFunc returns the holochain API function for an import, or an error if
+// there isn't one
+func (r *wasmResolver) resolveFunc(module, field string) (exec.FunctionImport, error) {
+	if module != WASMImportModule {
+		return nil, fmt.Errorf("%v: %s.%s", ErrWASMUnknownImport, module, field)
+	}
+	wr := r.wr
+	switch field {
+	case "result":
+		return func(vm *exec.VirtualMachine) int64 {
+			ptr := vm.GetCurrentFrame().Locals[0]
+			if err := wr.copyIn(ptr, wr.result); err != nil {
+				panic(err)
+			}
+			wr.result = nil
+			return 0
+		}, nil
+	case "error":
+		return func(vm *exec.VirtualMachine) int64 {
+			l := vm.GetCurrentFrame().Locals
+			msg, err := wr.read(l[0], l[1])
+			if err != nil {
+				panic(err)
+			}
+			wr.err = errors.New(string(msg))
+			return 0
+		}, nil
+	}
+	fn, ok := wasmAPI[field]
+	if !ok {
+		return nil, fmt.Errorf("%v: %s.%s", ErrWASMUnknownImport, module, field)
+	}
+	return func(vm *exec.VirtualMachine) int64 {
+		l := vm.GetCurrentFrame().Locals
+		return wr.callAPI(field, fn, l[0], l[1])
+	}, nil
+}
+
+// ResolveGlobal implements exec.ImportResolver, no globals are exported to zomes so
+// any import is recorded as an error for NewWASMRibosome to return
+func (r *wasmResolver) ResolveGlobal(module, field string) int64 {
+	if r.err == nil {
+		r.err = fmt.Errorf("%v: global %s.%s", ErrWASMUnknownImport, module, field)
+	}
+	return 0
+}
+
+// callAPI runs an API function for the module returning the length of the result,
+// or the negative length of the error message
+func (wr *WASMRibosome) callAPI(name string, fn wasmAPIFn, ptr int64, l int64) int64 {
+	var args []json.RawMessage
+	in, err := wr.read(ptr, l)
+	if err == nil && len(in) > 0 {
+		err = json.Unmarshal(in, &args)
+	}
+	var result interface{}
+	if err == nil {
+		result, err = fn(wr, args)
+	}
+	if err == nil {
+		wr.result, err = json.Marshal(result)
+	}
+	if err != nil {
+		wr.h.Debugf("wasm %s error: %v", name, err)
+		wr.result = []byte(err.Error())
+		return -int64(len(wr.result))
+	}
+	return int64(len(wr.result))
+}
+
+// read copies data out of the module's memory
+func (wr *WASMRibosome) read(ptr int64, l int64) (data []byte, err error) {
+	mem := wr.vm.Memory
+	if ptr < 0 || l < 0 || ptr+l > int64(len(mem)) {
+		err = ErrWASMOutOfBounds
+		return
+	}
+	data = make([]byte, l)
+	copy(data, mem[ptr:ptr+l])
+	return
+}
+
+// copyIn copies data into the module's memory
+func (wr *WASMRibosome) copyIn(ptr int64, data []byte) (err error) {
+	mem := wr.vm.Memory
+	if ptr < 0 || ptr+int64(len(data)) > int64(len(mem)) {
+		err = ErrWASMOutOfBounds
+		return
+	}
+	copy(mem[ptr:], data)
+	return
+}
+
+// write allocates memory in the module and copies data into it
+func (wr *WASMRibosome) write(data []byte) (ptr int64, err error) {
+	if len(data) == 0 {
+		return
+	}
+	alloc, _ := wr.vm.GetFunctionExport("alloc")
+	ptr, err = wr.vm.Run(alloc, int64(len(data)))
+	if err != nil {
+		return
+	}
+	err = wr.copyIn(ptr, data)
+	return
+}
+
+// reset puts the module's memory and globals back as they were when it was loaded, which
+// frees everything allocated during a call and any memory the module grew
+func (wr *WASMRibosome) reset() {
+	if len(wr.vm.Memory) != len(wr.memory) {
+		wr.vm.Memory = make([]byte, len(wr.memory))
+	}
+	copy(wr.vm.Memory, wr.memory)
+	copy(wr.vm.Globals, wr.globals)
+}
+
+// callFn calls a function exported by the module with the given input returning its output
+func (wr *WASMRibosome) callFn(fnName string, input []byte) (output []byte, err error) {
+	id, ok := wr.vm.GetFunctionExport(fnName)
+	if !ok {
+		err = fmt.Errorf("zome %s doesn't export %s", wr.zome.Name, fnName)
+		return
+	}
+	defer wr.reset()
+	var ptr, r int64
+	ptr, err = wr.write(input)
+	if err != nil {
+		return
+	}
+	wr.err = nil
+	r, err = wr.vm.Run(id, ptr, int64(len(input)))
+	if err != nil {
+		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		return
+	}
+	if wr.err != nil {
+		err = wr.err
+		wr.err = nil
+		return
+	}
+	if r != 0 {
+		output, err = wr.read(r>>32, r&0xffffffff)
+	}
+	return
+}
+
+// callJSON calls a function exported by the module with JSON encoded arguments
+func (wr *WASMRibosome) callJSON(fnName string, args ...interface{}) (output []byte, err error) {
+	var input []byte
+	input, err = json.Marshal(args)
+	if err != nil {
+		return
+	}
+	wr.h.Debugf("WASM call: %s(%s)", fnName, string(input))
+	output, err = wr.callFn(fnName, input)
+	return
+}
+
+func (wr *WASMRibosome) boolFn(fnName string, args ...interface{}) (err error) {
+	var output []byte
+	output, err = wr.callJSON(fnName, args...)
+	if err != nil {
+		return
+	}
+	var b bool
+	if json.Unmarshal(output, &b) != nil {
+		err = fmt.Errorf("%s should return boolean, got: %s", fnName, string(output))
+		return
+	}
+	if !b {
+		err = fmt.Errorf("%s failed", fnName)
+	}
+	return
+}
+
+// ChainGenesis runs the application genesis function
+// this function gets called after the genesis entries are added to the chain
+func (wr *WASMRibosome) ChainGenesis() (err error) {
+	err = wr.boolFn("genesis")
+	return
+}
+
+// BridgeGenesis runs the bridging genesis function
+// this function gets called on both sides of the bridging
+func (wr *WASMRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err error) {
+	err = wr.boolFn("bridgeGenesis", side, dnaHash.String(), data)
+	return
+}
+
+// Receive calls the app receive function for node-to-node messages
+func (wr *WASMRibosome) Receive(from string, msg string) (response string, err error) {
+	var output []byte
+	output, err = wr.callJSON("receive", from, json.RawMessage(msg))
+	if err != nil {
+		return
+	}
+	response = string(output)
+	return
+}
+
+// BundleCanceled calls the app bundleCanceled function
+func (wr *WASMRibosome) BundleCanceled(reason string) (response string, err error) {
+	bundle := wr.h.chain.BundleStarted()
+	if bundle == nil {
+		err = ErrBundleNotStarted
+		return
+	}
+	var output []byte
+	output, err = wr.callJSON("bundleCanceled", reason, json.RawMessage(bundle.userParam))
+	if err != nil {
+		return
+	}
+	if json.Unmarshal(output, &response) != nil {
+		response = string(output)
+	}
+	return
+}
+
+// ValidatePackagingRequest calls the app for a validation packaging request for an action
+func (wr *WASMRibosome) ValidatePackagingRequest(action ValidatingAction, def *EntryDef) (req PackagingReq, err error) {
+	fnName := "validate" + strings.Title(action.Name()) + "Pkg"
+	var output []byte
+	output, err = wr.callJSON(fnName, def.Name)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	if err = json.Unmarshal(output, &v); err != nil {
+		err = fmt.Errorf("%s should return null or object, got: %s", fnName, string(output))
+		return
+	}
+	switch t := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		req = t
+		// JSON numbers decode as floats but the chain option is expected as an int
+		if f, ok := req[PkgReqChain].(float64); ok {
+			req[PkgReqChain] = int64(f)
+		}
+	default:
+		err = fmt.Errorf("%s should return null or object, got: %s", fnName, string(output))
+	}
+	return
+}
+
+// entryJSON returns the JSON to pass an entry's content to the module as
+func (wr *WASMRibosome) entryJSON(entryType string, content string) (j json.RawMessage, err error) {
+	var format string
+	if _, def, e := wr.h.GetEntryDef(entryType); e == nil {
+		format = def.DataFormat
+	}
+	switch format {
+	case DataFormatJSON, DataFormatLinks:
+		j = json.RawMessage(content)
+	default:
+		j, err = json.Marshal(content)
+	}
+	return
+}
+
+func wasmHeader(header *Header) map[string]string {
+	if header == nil {
+		return map[string]string{"EntryLink": "", "Type": "", "Time": ""}
+	}
+	return map[string]string{
+		"EntryLink": header.EntryLink.String(),
+		"Type":      header.Type,
+		"Time":      header.Time.UTC().Format(time.RFC3339),
+	}
+}
+
+func (wr *WASMRibosome) prepareValidateArgs(action Action, def *EntryDef) (args []interface{}, err error) {
+	args = []interface{}{def.Name}
+	var entry json.RawMessage
+	switch t := action.(type) {
+	case *ActionPut:
+		entry, err = wr.entryJSON(def.Name, t.entry.Content().(string))
+		args = append(args, entry, wasmHeader(t.header))
+	case *ActionCommit:
+		entry, err = wr.entryJSON(def.Name, t.entry.Content().(string))
+		args = append(args, entry, wasmHeader(t.header))
+	case *ActionMod:
+		entry, err = wr.entryJSON(def.Name, t.entry.Content().(string))
+		args = append(args, entry, wasmHeader(t.header), t.replaces.String())
+	case *ActionDel:
+		args = append(args, t.entry.Hash.String())
+	case *ActionLink:
+		args = append(args, t.validationBase.String(), t.links)
+	default:
+		err = fmt.Errorf("can't prepare args for %T: ", t)
+	}
+	return
+}
+
+// ValidateAction builds the correct validation function based on the action an calls it
+func (wr *WASMRibosome) ValidateAction(action Action, def *EntryDef, pkg *ValidationPackage, sources []string) (err error) {
+	fnName := "validate" + strings.Title(action.Name())
+	var args []interface{}
+	args, err = wr.prepareValidateArgs(action, def)
+	if err != nil {
+		return
+	}
+	p := pkg.appPackage()
+	if p == nil {
+		p = map[string]interface{}{}
+	}
+	args = append(args, p, sources)
+
+	var output []byte
+	output, err = wr.callJSON(fnName, args...)
+	if err != nil {
+		return
+	}
+	var v interface{}
+	if err = json.Unmarshal(output, &v); err != nil {
+		err = fmt.Errorf("%s should return boolean or string, got: %s", fnName, string(output))
+		return
+	}
+	switch t := v.(type) {
+	case bool:
+		if !t {
+			err = ValidationFailed()
+		}
+	case string:
+		if t != "" {
+			err = ValidationFailed(t)
+		}
+	default:
+		err = fmt.Errorf("%s should return boolean or string, got: %s", fnName, string(output))
+	}
+	return
+}
+
+// Call calls the function exported by the zome module
+func (wr *WASMRibosome) Call(fn *FunctionDef, params interface{}) (result interface{}, err error) {
+	var input []byte
+	switch fn.CallingType {
+	case STRING_CALLING:
+		input = []byte(params.(string))
+	case JSON_CALLING:
+		input = []byte(params.(string))
+	default:
+		err = errors.New("params type not implemented")
+		return
+	}
+	wr.h.Debugf("WASM Call: %s(%s)", fn.Name, string(input))
+	var output []byte
+	output, err = wr.callFn(fn.Name, input)
+	if err != nil {
+		return
+	}
+	if fn.CallingType == JSON_CALLING && len(output) == 0 {
+		output = []byte("null")
+	}
+	result = string(output)
+	return
+}
+
+// Run can't run source code as the ribosome only runs compiled modules
+func (wr *WASMRibosome) Run(code string) (result interface{}, err error) {
+	err = ErrWASMRunNotSupported
+	return
+}
+
+// RunAsyncSendResponse calls the zome's callback for the response to an asynchronous send
+func (wr *WASMRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
+	var output []byte
+	output, err = wr.callJSON(callback, json.RawMessage(response.Body), callbackID)
+	if err != nil {
+		return
+	}
+	result = string(output)
+	return
+}
+
+// wasmProcessArgs processes the JSON arguments according to the args spec filling
+// args[].value with the converted value
+func wasmProcessArgs(wr *WASMRibosome, args []Arg, raw []json.RawMessage) (err error) {
+	err = checkArgCount(args, len(raw))
+	if err != nil {
+		return
+	}
+	for i := range raw {
+		arg := &args[i]
+		switch arg.Type {
+		case StringArg:
+			var s string
+			if json.Unmarshal(raw[i], &s) != nil {
+				return argErr("string", i+1, *arg)
+			}
+			arg.value = s
+		case HashArg:
+			var s string
+			if json.Unmarshal(raw[i], &s) != nil {
+				return argErr("string", i+1, *arg)
+			}
+			var hash Hash
+			hash, err = NewHash(s)
+			if err != nil {
+				return
+			}
+			arg.value = hash
+		case IntArg:
+			var n int64
+			if json.Unmarshal(raw[i], &n) != nil {
+				return argErr("int", i+1, *arg)
+			}
+			arg.value = n
+		case BoolArg:
+			var b bool
+			if json.Unmarshal(raw[i], &b) != nil {
+				return argErr("boolean", i+1, *arg)
+			}
+			arg.value = b
+		case ArgsArg, ToStrArg:
+			var s string
+			if json.Unmarshal(raw[i], &s) == nil {
+				arg.value = s
+			} else {
+				arg.value = string(raw[i])
+			}
+		case EntryArg:
+			// all EntryArgs are preceded by the entry type
+			var def *EntryDef
+			_, def, err = wr.h.GetEntryDef(args[i-1].value.(string))
+			if err != nil {
+				return
+			}
+			switch def.DataFormat {
+			case DataFormatString:
+				var s string
+				if json.Unmarshal(raw[i], &s) != nil {
+					return argErr("string", i+1, *arg)
+				}
+				arg.value = s
+			case DataFormatLinks, DataFormatJSON:
+				arg.value = string(raw[i])
+			default:
+				err = errors.New("data format not implemented: " + def.DataFormat)
+				return
+			}
+		case MapArg:
+			var m map[string]interface{}
+			if json.Unmarshal(raw[i], &m) != nil {
+				return argErr("object", i+1, *arg)
+			}
+			arg.value = m
+		}
+	}
+	return
+}
+
+// wasmOptions decodes an optional options argument into the options struct
+func wasmOptions(raw []json.RawMessage, i int, options interface{}) (err error) {
+	if len(raw) > i {
+		err = json.Unmarshal(raw[i], options)
+	}
+	return
+}
+
+func hashResult(r interface{}) interface{} {
+	var hash Hash
+	if r != nil {
+		hash = r.(Hash)
+	}
+	return hash.String()
+}
+
+var wasmAPI = map[string]wasmAPIFn{
+	"app": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		h := wr.h
+		result = map[string]interface{}{
+			"Name": h.Name(),
+			"DNA":  map[string]string{"Hash": h.dnaHash.String()},
+			"Key":  map[string]string{"Hash": h.nodeIDStr},
+			"Agent": map[string]string{
+				"Hash":    h.agentHash.String(),
+				"TopHash": h.agentTopHash.String(),
+				"String":  string(h.Agent().Identity()),
+			},
+		}
+		return
+	},
+	"property": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnProperty{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.prop = args[0].value.(string)
+		result, err = fn.Call(wr.h)
+		if err != nil {
+			// unknown properties are undefined rather than an error
+			result, err = nil, nil
+		}
+		return
+	},
+	"debug": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnDebug{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.msg = args[0].value.(string)
+		_, err = fn.Call(wr.h)
+		return
+	},
+	"makeHash": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnMakeHash{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.entryType = args[0].value.(string)
+		fn.entry = &GobEntry{C: args[1].value.(string)}
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = hashResult(r)
+		}
+		return
+	},
+	"subscribe": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnSubscribe{zome: wr.zome.Name}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		if err = json.Unmarshal(raw[0], &fn.filter); err != nil {
+			return
+		}
+		fn.callback = args[1].value.(string)
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"unsubscribe": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnUnsubscribe{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.id = args[0].value.(string)
+		_, err = fn.Call(wr.h)
+		return
+	},
+	"schedule": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnSchedule{zome: wr.zome.Name}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.function = args[0].value.(string)
+		fn.interval = args[1].value.(string)
+		_, err = fn.Call(wr.h)
+		return
+	},
+	"unschedule": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnUnschedule{zome: wr.zome.Name}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.function = args[0].value.(string)
+		_, err = fn.Call(wr.h)
+		return
+	},
+	"getBridges": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnGetBridges{}
+		if err = wasmProcessArgs(wr, fn.Args(), raw); err != nil {
+			return
+		}
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"getAgent": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnGetAgent{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.agent = args[0].value.(Hash)
+		if len(raw) > 1 {
+			fn.options = &GetAgentOptions{}
+			if err = json.Unmarshal(raw[1], fn.options); err != nil {
+				return
+			}
+		}
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"getPendingValidations": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnGetPendingValidations{}
+		if err = wasmProcessArgs(wr, fn.Args(), raw); err != nil {
+			return
+		}
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"sign": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnSign{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.data = []byte(args[0].value.(string))
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"verifySignature": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnVerifySignature{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.b58signature = args[0].value.(string)
+		fn.data = args[1].value.(string)
+		fn.b58pubKey = args[2].value.(string)
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"encrypt": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnEncrypt{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.to = args[0].value.(Hash)
+		fn.data = []byte(args[1].value.(string))
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"decrypt": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnDecrypt{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.data = args[0].value.(string)
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"send": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnSend{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		a := &fn.action
+		a.to, err = peer.IDB58Decode(args[0].value.(Hash).String())
+		if err != nil {
+			return
+		}
+		a.msg.ZomeType = wr.zome.Name
+		a.msg.Body = string(raw[1])
+		if len(raw) > 2 {
+			a.options = &SendOptions{}
+			if err = json.Unmarshal(raw[2], a.options); err != nil {
+				return
+			}
+			if a.options.Callback != nil {
+				if a.options.Callback.Function == "" || a.options.Callback.ID == "" {
+					err = errors.New("callback option requires Function and ID")
+					return
+				}
+				a.options.Callback.zomeType = wr.zome.Name
+			}
+		}
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"call": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnCall{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.zome = args[0].value.(string)
+		fn.function = args[1].value.(string)
+		fn.args = args[2].value.(string)
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"bridge": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnBridge{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.token, fn.url, err = wr.h.GetBridgeToken(args[0].value.(Hash))
+		if err != nil {
+			return
+		}
+		fn.zome = args[1].value.(string)
+		fn.function = args[2].value.(string)
+		fn.args = args[3].value.(string)
+		result, err = fn.Call(wr.h)
+		return
+	},
+	"commit": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnCommit{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.SetAction(NewCommitAction(args[0].value.(string), &GobEntry{C: args[1].value.(string)}))
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = hashResult(r)
+		}
+		return
+	},
+	"update": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnMod{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		entry := GobEntry{C: args[1].value.(string)}
+		fn.action = *NewModAction(args[0].value.(string), &entry, args[2].value.(Hash))
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = hashResult(r)
+		}
+		return
+	},
+	"updateAgent": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnModAgent{}
+		if err = wasmProcessArgs(wr, fn.Args(), raw); err != nil {
+			return
+		}
+		var opts ModAgentOptions
+		if err = json.Unmarshal(raw[0], &opts); err != nil {
+			return
+		}
+		fn.Identity = AgentIdentity(opts.Identity)
+		fn.Revocation = opts.Revocation
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = hashResult(r)
+		}
+		return
+	},
+	"remove": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnDel{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		fn.action = *NewDelAction(DelEntry{Hash: args[0].value.(Hash), Message: args[1].value.(string)})
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = hashResult(r)
+		}
+		return
+	},
+	"get": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnGet{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		options := GetOptions{StatusMask: StatusDefault, GetMask: GetMaskDefault}
+		if err = wasmOptions(raw, 1, &options); err != nil {
+			return
+		}
+		req := GetReq{H: args[0].value.(Hash), StatusMask: options.StatusMask, GetMask: options.GetMask}
+		var r interface{}
+		r, err = callGet(wr.h, req, &options)
+		if err == ErrHashNotFound {
+			// if the hash wasn't found this isn't actually an error so return null
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+		resp := r.(GetResp)
+		mask := options.GetMask
+		if mask == GetMaskDefault {
+			mask = GetMaskEntry
+		}
+		var entry json.RawMessage
+		if mask&GetMaskEntry != 0 {
+			entry, err = wr.entryJSON(resp.EntryType, resp.Entry.Content().(string))
+			if err != nil {
+				return
+			}
+			if mask == GetMaskEntry {
+				result = entry
+				return
+			}
+		}
+		obj := make(map[string]interface{})
+		if mask&GetMaskEntry != 0 {
+			obj["Entry"] = entry
+		}
+		if mask&GetMaskEntryType != 0 {
+			obj["EntryType"] = resp.EntryType
+		}
+		if mask&GetMaskSources != 0 {
+			obj["Sources"] = resp.Sources
+		}
+		result = obj
+		return
+	},
+	"getLinks": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnGetLinks{}
+		args := fn.Args()
+		if err = wasmProcessArgs(wr, args, raw); err != nil {
+			return
+		}
+		options := GetLinksOptions{Load: false, StatusMask: StatusLive}
+		if err = wasmOptions(raw, 2, &options); err != nil {
+			return
+		}
+		fn.action = *NewGetLinksAction(&LinkQuery{Base: args[0].value.(Hash), T: args[1].value.(string), StatusMask: options.StatusMask}, &options)
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err == nil {
+			result = r.(*LinkQueryResp).Links
+		}
+		return
+	},
+	"query": func(wr *WASMRibosome, raw []json.RawMessage) (result interface{}, err error) {
+		fn := &APIFnQuery{}
+		if err = wasmProcessArgs(wr, fn.Args(), raw); err != nil {
+			return
+		}
+		if len(raw) > 0 {
+			fn.options = &QueryOptions{}
+			if err = json.Unmarshal(raw[0], fn.options); err != nil {
+				return
+			}
+		}
+		var r interface{}
+		r, err = fn.Call(wr.h)
+		if err != nil {
+			return
+		}
+		ret := QueryReturn{Entries: true}
+		if fn.options != nil {
+			ret = fn.options.Return
+		}
+		results := make([]interface{}, 0)
+		for _, qr := range r.([]QueryResult) {
+			item := make(map[string]interface{})
+			var single interface{}
+			if ret.Hashes {
+				single = qr.Header.EntryLink.String()
+				item["Hash"] = single
+			}
+			if ret.Headers {
+				single = qr.Header
+				item["Header"] = single
+			}
+			if ret.Entries {
+				single, err = wr.entryJSON(qr.Header.Type, qr.Entry.Content().(string))
+				if err != nil {
+					return
+				}
+				item["Entry"] = single
+			}
+			if len(item) == 1 {
+				results = append(results, single)
+			} else {
+				results = append(results, item)
+			}
+		}
+		result = results
+		return
+	},
+}
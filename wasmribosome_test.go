@@ -0,0 +1,152 @@
+package holochain
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/holochain/holochain-proto/hash"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+// wasmTestModule is a minimal zome module exporting memory, a bump allocator and a
+// genesis function that returns the JSON "true" stored at address 16
+var wasmTestModule = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	// types: (i32)->i32, (i32,i32)->i64
+	0x01, 0x0c, 0x02, 0x60, 0x01, 0x7f, 0x01, 0x7f, 0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7e,
+	// functions
+	0x03, 0x03, 0x02, 0x00, 0x01,
+	// memory of one page
+	0x05, 0x03, 0x01, 0x00, 0x01,
+	// the allocator's next free address, starting at 1024
+	0x06, 0x07, 0x01, 0x7f, 0x01, 0x41, 0x80, 0x08, 0x0b,
+	// exports: memory, alloc, genesis
+	0x07, 0x1c, 0x03,
+	0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x02, 0x00,
+	0x05, 0x61, 0x6c, 0x6c, 0x6f, 0x63, 0x00, 0x00,
+	0x07, 0x67, 0x65, 0x6e, 0x65, 0x73, 0x69, 0x73, 0x00, 0x01,
+	// code
+	0x0a, 0x1d, 0x02,
+	0x11, 0x01, 0x01, 0x7f, 0x23, 0x00, 0x21, 0x01, 0x23, 0x00, 0x20, 0x00, 0x6a, 0x24, 0x00, 0x20, 0x01, 0x0b,
+	0x09, 0x00, 0x42, 0x84, 0x80, 0x80, 0x80, 0x80, 0x02, 0x0b,
+	// data: "true" at 16
+	0x0b, 0x0a, 0x01, 0x00, 0x41, 0x10, 0x0b, 0x04, 0x74, 0x72, 0x75, 0x65,
+}
+
+func TestNewWASMRibosome(t *testing.T) {
+	d, _, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	Convey("it should encode zome code as text", t, func() {
+		code := encodeWASMCode(wasmTestModule)
+		decoded, err := decodeWASMCode(code)
+		So(err, ShouldBeNil)
+		So(decoded, ShouldResemble, wasmTestModule)
+	})
+
+	Convey("it should fail to load code that isn't a wasm module", t, func() {
+		_, err := NewWASMRibosome(h, &Zome{Name: "bad", RibosomeType: WASMRibosomeType, Code: encodeWASMCode([]byte("not wasm"))})
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("it should fail to load a module with imports holochain doesn't provide", t, func() {
+		code := []byte{
+			0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+			// types: ()->()
+			0x01, 0x04, 0x01, 0x60, 0x00, 0x00,
+			// imports: env.foo
+			0x02, 0x0b, 0x01, 0x03, 0x65, 0x6e, 0x76, 0x03, 0x66, 0x6f, 0x6f, 0x00, 0x00,
+		}
+		_, err := NewWASMRibosome(h, &Zome{Name: "bad", RibosomeType: WASMRibosomeType, Code: encodeWASMCode(code)})
+		So(err.Error(), ShouldContainSubstring, ErrWASMUnknownImport.Error()+": env.foo")
+	})
+
+	zome := &Zome{Name: "wasmTest", RibosomeType: WASMRibosomeType, Code: encodeWASMCode(wasmTestModule)}
+	r, err := CreateRibosome(h, zome)
+
+	Convey("it should load a wasm module", t, func() {
+		So(err, ShouldBeNil)
+		So(r.Type(), ShouldEqual, WASMRibosomeType)
+	})
+
+	Convey("it should call exported functions", t, func() {
+		So(r.ChainGenesis(), ShouldBeNil)
+		err := r.BridgeGenesis(BridgeCaller, h.dnaHash, "")
+		So(err.Error(), ShouldEqual, "zome wasmTest doesn't export bridgeGenesis")
+	})
+
+	Convey("it should not run source code", t, func() {
+		_, err := r.Run("(+ 1 2)")
+		So(err, ShouldEqual, ErrWASMRunNotSupported)
+	})
+
+	wr := r.(*WASMRibosome)
+	raw := func(args ...interface{}) (r []json.RawMessage) {
+		for _, a := range args {
+			j, _ := json.Marshal(a)
+			r = append(r, j)
+		}
+		return
+	}
+
+	Convey("it should free what a call allocates when it returns", t, func() {
+		So(wr.vm.Globals[0], ShouldEqual, 1024)
+		So(r.ChainGenesis(), ShouldBeNil)
+		So(wr.vm.Globals[0], ShouldEqual, 1024)
+
+		ptr, err := wr.write([]byte("data"))
+		So(err, ShouldBeNil)
+		So(wr.vm.Globals[0], ShouldEqual, 1028)
+		wr.reset()
+		So(wr.vm.Globals[0], ShouldEqual, 1024)
+		So(wr.vm.Memory[ptr:ptr+4], ShouldResemble, []byte{0, 0, 0, 0})
+	})
+
+	Convey("it should check API function arguments", t, func() {
+		_, err := wasmAPI["commit"](wr, raw("evenNumbers"))
+		So(err, ShouldEqual, ErrWrongNargs)
+		_, err = wasmAPI["commit"](wr, raw(2, "2"))
+		So(err.Error(), ShouldEqual, "argument 1 (entryType) should be string")
+	})
+
+	Convey("it should expose the API functions", t, func() {
+		result, err := wasmAPI["commit"](wr, raw("evenNumbers", "2"))
+		So(err, ShouldBeNil)
+		hash, _ := NewHash(result.(string))
+
+		result, err = wasmAPI["get"](wr, raw(hash.String()))
+		So(err, ShouldBeNil)
+		So(fmt.Sprintf("%s", result), ShouldEqual, `"2"`)
+
+		result, err = wasmAPI["get"](wr, raw(hash.String(), map[string]interface{}{"GetMask": GetMaskEntryType}))
+		So(err, ShouldBeNil)
+		So(result.(map[string]interface{})["EntryType"], ShouldEqual, "evenNumbers")
+
+		result, err = wasmAPI["query"](wr, raw(map[string]interface{}{"Constrain": map[string]interface{}{"EntryTypes": []string{"evenNumbers"}}, "Return": map[string]interface{}{"Hashes": true}}))
+		So(err, ShouldBeNil)
+		So(result, ShouldContain, hash.String())
+
+		result, err = wasmAPI["property"](wr, raw("description"))
+		So(err, ShouldBeNil)
+		So(result, ShouldEqual, "a bogus test holochain")
+
+		result, err = wasmAPI["app"](wr, nil)
+		So(err, ShouldBeNil)
+		So(result.(map[string]interface{})["Name"], ShouldEqual, h.Name())
+	})
+
+	Convey("it should return API results and errors through the module's memory", t, func() {
+		args, _ := json.Marshal([]string{"evenNumbers", "4"})
+		ptr, err := wr.write(args)
+		So(err, ShouldBeNil)
+		l := wr.callAPI("makeHash", wasmAPI["makeHash"], ptr, int64(len(args)))
+		So(l, ShouldBeGreaterThan, 0)
+		So(string(wr.result), ShouldStartWith, `"Qm`)
+
+		args = []byte(`["evenNumbers"]`)
+		ptr, _ = wr.write(args)
+		l = wr.callAPI("makeHash", wasmAPI["makeHash"], ptr, int64(len(args)))
+		So(l, ShouldEqual, -int64(len(ErrWrongNargs.Error())))
+		So(string(wr.result), ShouldEqual, ErrWrongNargs.Error())
+	})
+}
@@ -13,12 +13,14 @@ type Zome struct {
 	Name         string
 	Description  string
 	Code         string
+	Modules      map[string]string // code the zome's code can require, keyed by path in the zome directory
 	Entries      []EntryDef
 	RibosomeType string
 	Functions    []FunctionDef
 	BridgeFuncs  []string // functions in zome that can be bridged to by callerApp
 	//	BridgeCallee Hash     // dna Hash of provider App that this zome will call
-	Config map[string]interface{}
+	Config    map[string]interface{}
+	Schedules []ScheduleDef `json:",omitempty"` // functions called periodically once background tasks start
 }
 
 // GetEntryDef returns the entry def structure
@@ -69,6 +71,10 @@ func (zome *Zome) CodeFileName() string {
 		return zome.Name + ".zy"
 	} else if zome.RibosomeType == JSRibosomeType {
 		return zome.Name + ".js"
+	} else if zome.RibosomeType == WASMRibosomeType {
+		return zome.Name + ".wasm"
+	} else if zome.RibosomeType == GoRibosomeType {
+		return zome.Name + ".gozome"
 	}
 	panic("unknown ribosome type:" + zome.RibosomeType)
 }
@@ -0,0 +1,413 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// ZomeAPI is the typed Go version of the holochain API that the JS and Zygo ribosomes
+// expose to zome code, for use by zomes implemented in Go
+
+package holochain
+
+import (
+	"encoding/json"
+	"errors"
+	. "github.com/holochain/holochain-proto/hash"
+	peer "github.com/libp2p/go-libp2p-peer"
+)
+
+// ZomeAPI gives Go zome code access to its holochain
+type ZomeAPI struct {
+	h    *Holochain
+	zome *Zome
+}
+
+// ZomeAppInfo holds the information about the running app that the JS ribosome exposes as App
+type ZomeAppInfo struct {
+	Name         string
+	DNAHash      Hash
+	KeyHash      string
+	AgentHash    Hash
+	AgentTopHash Hash
+	AgentString  string
+}
+
+// NewZomeAPI returns the API for code of the given zome
+func NewZomeAPI(h *Holochain, zome *Zome) *ZomeAPI {
+	return &ZomeAPI{h: h, zome: zome}
+}
+
+// entryContent converts an entry passed to the API to the string the entry holds,
+// strings are taken as is and anything else is marshaled to JSON
+func entryContent(entry interface{}) (content string, err error) {
+	switch t := entry.(type) {
+	case string:
+		content = t
+	case []byte:
+		content = string(t)
+	default:
+		var b []byte
+		b, err = json.Marshal(entry)
+		content = string(b)
+	}
+	return
+}
+
+func hashResponse(r interface{}) (hash Hash) {
+	if r != nil {
+		hash = r.(Hash)
+	}
+	return
+}
+
+// App returns the information about the running app
+func (api *ZomeAPI) App() ZomeAppInfo {
+	h := api.h
+	return ZomeAppInfo{
+		Name:         h.Name(),
+		DNAHash:      h.dnaHash,
+		KeyHash:      h.nodeIDStr,
+		AgentHash:    h.agentHash,
+		AgentTopHash: h.agentTopHash,
+		AgentString:  string(h.Agent().Identity()),
+	}
+}
+
+// Property returns the value of a DNA property
+func (api *ZomeAPI) Property(name string) (value string, err error) {
+	fn := &APIFnProperty{prop: name}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		value = r.(string)
+	}
+	return
+}
+
+// Debug sends a message to the app debug log
+func (api *ZomeAPI) Debug(msg string) {
+	fn := &APIFnDebug{msg: msg}
+	fn.Call(api.h)
+}
+
+// MakeHash returns the hash an entry would have if it were committed
+func (api *ZomeAPI) MakeHash(entryType string, entry interface{}) (hash Hash, err error) {
+	var content string
+	if content, err = entryContent(entry); err != nil {
+		return
+	}
+	fn := &APIFnMakeHash{entryType: entryType, entry: &GobEntry{C: content}}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		hash = hashResponse(r)
+	}
+	return
+}
+
+// GetBridges returns the bridges this app has to other apps
+func (api *ZomeAPI) GetBridges() (bridges []Bridge, err error) {
+	fn := &APIFnGetBridges{}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		bridges = r.([]Bridge)
+	}
+	return
+}
+
+// GetPendingValidations returns the changes this node still has to validate
+func (api *ZomeAPI) GetPendingValidations() (pending []PendingValidation, err error) {
+	fn := &APIFnGetPendingValidations{}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		pending = r.([]PendingValidation)
+	}
+	return
+}
+
+// GetAgent returns the identity and key history of the agent with the given key or
+// agent entry hash
+func (api *ZomeAPI) GetAgent(agent Hash) (info AgentInfo, err error) {
+	fn := &APIFnGetAgent{agent: agent}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		info = r.(AgentInfo)
+	}
+	return
+}
+
+// Sign signs data with the agent's private key and returns the b58 encoded signature
+func (api *ZomeAPI) Sign(data string) (signature string, err error) {
+	fn := &APIFnSign{data: []byte(data)}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		signature = r.(string)
+	}
+	return
+}
+
+// VerifySignature checks a b58 encoded signature of data against a b58 encoded public key
+func (api *ZomeAPI) VerifySignature(signature string, data string, pubKey string) (matches bool, err error) {
+	fn := &APIFnVerifySignature{b58signature: signature, data: data, b58pubKey: pubKey}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		matches = r.(bool)
+	}
+	return
+}
+
+// Encrypt encrypts data so only the agent with the given key or agent entry hash can
+// decrypt it, and returns it base64 encoded
+func (api *ZomeAPI) Encrypt(to Hash, data string) (encrypted string, err error) {
+	fn := &APIFnEncrypt{to: to, data: []byte(data)}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		encrypted = r.(string)
+	}
+	return
+}
+
+// Decrypt decrypts data that was encrypted to this agent
+func (api *ZomeAPI) Decrypt(encrypted string) (data string, err error) {
+	fn := &APIFnDecrypt{data: encrypted}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		data = r.(string)
+	}
+	return
+}
+
+// Send sends a message to the zome of the same name on another node and returns the
+// JSON of the response. If the options hold a callback the message is sent asynchronously,
+// the response is delivered to the callback and an empty response is returned.
+func (api *ZomeAPI) Send(to Hash, msg interface{}, options *SendOptions) (response json.RawMessage, err error) {
+	fn := &APIFnSend{}
+	a := &fn.action
+	a.to, err = peer.IDB58Decode(to.String())
+	if err != nil {
+		return
+	}
+	var body []byte
+	if body, err = json.Marshal(msg); err != nil {
+		return
+	}
+	a.msg.ZomeType = api.zome.Name
+	a.msg.Body = string(body)
+	if options != nil {
+		opts := *options
+		if opts.Callback != nil {
+			if opts.Callback.Function == "" || opts.Callback.ID == "" {
+				err = errors.New("callback option requires Function and ID")
+				return
+			}
+			callback := *opts.Callback
+			callback.zomeType = api.zome.Name
+			opts.Callback = &callback
+		}
+		a.options = &opts
+	}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil && r != nil {
+		response = json.RawMessage(r.(string))
+	}
+	return
+}
+
+// Subscribe has the zome's callback called with the changes the local DHT receives
+// that match the filter, returning the subscription's ID
+func (api *ZomeAPI) Subscribe(filter SubscriptionFilter, callback string) (id string, err error) {
+	fn := &APIFnSubscribe{zome: api.zome.Name, filter: filter, callback: callback}
+	var r interface{}
+	if r, err = fn.Call(api.h); err == nil {
+		id = r.(string)
+	}
+	return
+}
+
+// Unsubscribe removes a subscription made with Subscribe
+func (api *ZomeAPI) Unsubscribe(id string) (err error) {
+	fn := &APIFnUnsubscribe{id: id}
+	_, err = fn.Call(api.h)
+	return
+}
+
+// Schedule has a function of the zome called at the interval, e.g. "1h", from when
+// background tasks are started
+func (api *ZomeAPI) Schedule(function string, interval string) (err error) {
+	fn := &APIFnSchedule{zome: api.zome.Name, function: function, interval: interval}
+	_, err = fn.Call(api.h)
+	return
+}
+
+// Unschedule removes the schedule of a function of the zome added with Schedule
+func (api *ZomeAPI) Unschedule(function string) (err error) {
+	fn := &APIFnUnschedule{zome: api.zome.Name, function: function}
+	_, err = fn.Call(api.h)
+	return
+}
+
+// Call calls an exposed function of another zome of this app; string args are passed
+// as is and anything else as JSON
+func (api *ZomeAPI) Call(zome string, function string, args interface{}) (result string, err error) {
+	var params string
+	if params, err = entryContent(args); err != nil {
+		return
+	}
+	fn := &APIFnCall{zome: zome, function: function, args: params}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		result, err = entryContent(r)
+	}
+	return
+}
+
+// Bridge calls a bridged function of a zome in another app; string args are passed
+// as is and anything else as JSON
+func (api *ZomeAPI) Bridge(app Hash, zome string, function string, args interface{}) (result string, err error) {
+	fn := &APIFnBridge{zome: zome, function: function}
+	if fn.args, err = entryContent(args); err != nil {
+		return
+	}
+	fn.token, fn.url, err = api.h.GetBridgeToken(app)
+	if err != nil {
+		return
+	}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		result = r.(string)
+	}
+	return
+}
+
+// Commit adds an entry to the local chain and shares it on the DHT
+func (api *ZomeAPI) Commit(entryType string, entry interface{}) (hash Hash, err error) {
+	var content string
+	if content, err = entryContent(entry); err != nil {
+		return
+	}
+	fn := &APIFnCommit{}
+	fn.SetAction(NewCommitAction(entryType, &GobEntry{C: content}))
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		hash = hashResponse(r)
+	}
+	return
+}
+
+// Migrate commits a migrate entry recording that this app was opened or closed in
+// favor of another one
+func (api *ZomeAPI) Migrate(migrationType string, dnaHash Hash, key Hash, data string) (hash Hash, err error) {
+	fn := &APIFnMigrate{}
+	fn.action.entry = MigrateEntry{Type: migrationType, DNAHash: dnaHash, Key: key, Data: data}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		hash = hashResponse(r)
+	}
+	return
+}
+
+// Update commits an entry which replaces an earlier one
+func (api *ZomeAPI) Update(entryType string, entry interface{}, replaces Hash) (hash Hash, err error) {
+	var content string
+	if content, err = entryContent(entry); err != nil {
+		return
+	}
+	fn := &APIFnMod{}
+	fn.action = *NewModAction(entryType, &GobEntry{C: content}, replaces)
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		hash = hashResponse(r)
+	}
+	return
+}
+
+// UpdateAgent changes the agent's identity and/or revokes its key
+func (api *ZomeAPI) UpdateAgent(options ModAgentOptions) (hash Hash, err error) {
+	fn := &APIFnModAgent{Identity: AgentIdentity(options.Identity), Revocation: options.Revocation}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		hash = hashResponse(r)
+	}
+	return
+}
+
+// Remove marks an entry as deleted
+func (api *ZomeAPI) Remove(hash Hash, message string) (delHash Hash, err error) {
+	fn := &APIFnDel{}
+	fn.action = *NewDelAction(DelEntry{Hash: hash, Message: message})
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		delHash = hashResponse(r)
+	}
+	return
+}
+
+// Get retrieves an entry, returning ErrHashNotFound if there is no such entry
+// options may be nil for the defaults
+func (api *ZomeAPI) Get(hash Hash, options *GetOptions) (resp GetResp, err error) {
+	opts := GetOptions{StatusMask: StatusDefault, GetMask: GetMaskDefault}
+	if options != nil {
+		opts = *options
+	}
+	req := GetReq{H: hash, StatusMask: opts.StatusMask, GetMask: opts.GetMask}
+	var r interface{}
+	r, err = callGet(api.h, req, &opts)
+	if err == nil {
+		resp = r.(GetResp)
+	}
+	return
+}
+
+// GetLinks retrieves the links on a base with the given tag
+// options may be nil for the defaults
+func (api *ZomeAPI) GetLinks(base Hash, tag string, options *GetLinksOptions) (links []TaggedHash, err error) {
+	opts := GetLinksOptions{Load: false, StatusMask: StatusLive}
+	if options != nil {
+		opts = *options
+	}
+	fn := &APIFnGetLinks{}
+	fn.action = *NewGetLinksAction(&LinkQuery{Base: base, T: tag, StatusMask: opts.StatusMask}, &opts)
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		links = r.(*LinkQueryResp).Links
+	}
+	return
+}
+
+// Query scans the local chain, options may be nil for the defaults
+func (api *ZomeAPI) Query(options *QueryOptions) (results []QueryResult, err error) {
+	fn := &APIFnQuery{options: options}
+	var r interface{}
+	r, err = fn.Call(api.h)
+	if err == nil {
+		results = r.([]QueryResult)
+	}
+	return
+}
+
+// BundleStart starts a bundle of commits which are only shared when the bundle is closed
+func (api *ZomeAPI) BundleStart(timeout int, userParam string) (err error) {
+	fn := NewStartBundleAction(timeout, userParam)
+	_, err = fn.Call(api.h)
+	return
+}
+
+// BundleClose closes the current bundle, committing it or canceling it
+func (api *ZomeAPI) BundleClose(commit bool) (err error) {
+	fn := &APIFnCloseBundle{commit: commit}
+	_, err = fn.Call(api.h)
+	return
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2013-2018, The MetaCurrency Project (Eric Harris-Braun, Arthur Brock, et. al.)
+// Use of this source code is governed by GPLv3 found in the LICENSE file
+//----------------------------------------------------------------------------------------
+// zome modules are the files of code which a zome's code file can require, either from
+// the zome's own directory or from the library directory shared by all the DNA's zomes
+
+package holochain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// JSModuleSuffix is the suffix of files loaded as modules for JS zomes
+	JSModuleSuffix = ".js"
+)
+
+var ErrModuleOutsideZome = errors.New("module path leaves the zome directory")
+var ErrBadModuleName = errors.New("module name must be a clean relative path to a " + JSModuleSuffix + " file")
+
+// checkModuleName confirms that a module name from a DNA can only name a file under the
+// directory it's written to, as the names of modules in app packages aren't trusted
+func checkModuleName(name string, suffix string) (err error) {
+	if path.IsAbs(name) || filepath.IsAbs(name) || strings.Contains(name, `\`) ||
+		path.Clean(name) != name || !strings.HasSuffix(name, suffix) {
+		err = fmt.Errorf("%v: %s", ErrBadModuleName, name)
+		return
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			err = fmt.Errorf("%v: %s", ErrBadModuleName, name)
+			return
+		}
+	}
+	return
+}
+
+// checkModuleNames checks the names of all the modules of a DNA
+func (dna *DNA) checkModuleNames() (err error) {
+	for _, z := range dna.Zomes {
+		for name := range z.Modules {
+			if err = checkModuleName(name, JSModuleSuffix); err != nil {
+				return
+			}
+		}
+	}
+	for name := range dna.Library {
+		if err = checkModuleName(name, JSModuleSuffix); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// readModules reads the module files under dir keyed by their slash separated path
+// relative to dir, skipping the file skip
+func readModules(dir string, suffix string, skip string) (modules map[string]string, err error) {
+	if !DirExists(dir) {
+		return
+	}
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, e error) error {
+		if e != nil {
+			return e
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(p, suffix) {
+			return nil
+		}
+		rel, e := filepath.Rel(dir, p)
+		if e != nil {
+			return e
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == skip {
+			return nil
+		}
+		code, e := ReadFile(p)
+		if e != nil {
+			return e
+		}
+		if modules == nil {
+			modules = make(map[string]string)
+		}
+		modules[rel] = string(code)
+		return nil
+	})
+	return
+}
+
+// writeModules writes out the module files under dir, refusing any whose name isn't safe
+func writeModules(dir string, modules map[string]string) (err error) {
+	names := make([]string, 0, len(modules))
+	for name := range modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err = checkModuleName(name, JSModuleSuffix); err != nil {
+			return
+		}
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err = os.MkdirAll(filepath.Dir(p), os.ModePerm); err != nil {
+			return
+		}
+		if err = WriteFile([]byte(modules[name]), p); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// isLibraryModule returns true if a required path names a shared library module rather
+// than a file relative to the requiring module
+func isLibraryModule(required string) bool {
+	return !strings.HasPrefix(required, "./") && !strings.HasPrefix(required, "../") && !strings.HasPrefix(required, "/")
+}
+
+// resolveModule finds the module a require of the path from a module in dir refers to,
+// trying the path as is, with the suffix, and as a directory with an index file
+func resolveModule(modules map[string]string, dir string, required string, suffix string) (name string, err error) {
+	var p string
+	if strings.HasPrefix(required, "/") {
+		p = path.Clean(required[1:])
+	} else {
+		p = path.Join(dir, required)
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		err = ErrModuleOutsideZome
+		return
+	}
+	for _, name = range []string{p, p + suffix, path.Join(p, "index"+suffix)} {
+		if _, ok := modules[name]; ok {
+			return
+		}
+	}
+	err = fmt.Errorf("module not found: %s", required)
+	return
+}
@@ -0,0 +1,134 @@
+package holochain
+
+import (
+	"github.com/robertkrimen/otto"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveModule(t *testing.T) {
+	modules := map[string]string{"util.js": "", "lib/math.js": "", "lib/index.js": ""}
+	Convey("it should resolve required paths to modules", t, func() {
+		name, err := resolveModule(modules, "", "./util", JSModuleSuffix)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "util.js")
+		name, err = resolveModule(modules, "lib", "./math.js", JSModuleSuffix)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "lib/math.js")
+		name, err = resolveModule(modules, "lib", "../util", JSModuleSuffix)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "util.js")
+		name, err = resolveModule(modules, "lib", "/lib", JSModuleSuffix)
+		So(err, ShouldBeNil)
+		So(name, ShouldEqual, "lib/index.js")
+	})
+	Convey("it should fail for missing modules and paths leaving the zome", t, func() {
+		_, err := resolveModule(modules, "", "./missing", JSModuleSuffix)
+		So(err.Error(), ShouldEqual, "module not found: ./missing")
+		_, err = resolveModule(modules, "lib", "../../util", JSModuleSuffix)
+		So(err, ShouldEqual, ErrModuleOutsideZome)
+	})
+}
+
+func TestCheckModuleName(t *testing.T) {
+	Convey("it should accept clean relative paths to modules", t, func() {
+		So(checkModuleName("util.js", JSModuleSuffix), ShouldBeNil)
+		So(checkModuleName("util/index.js", JSModuleSuffix), ShouldBeNil)
+	})
+	Convey("it should reject names that could leave the directory", t, func() {
+		for _, name := range []string{"/etc/cron.js", "../up.js", "a/../../up.js", "./util.js", "a//b.js", `..\up.js`, "util.sh", ""} {
+			err := checkModuleName(name, JSModuleSuffix)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, ErrBadModuleName.Error())
+		}
+	})
+	Convey("it should not write modules with bad names", t, func() {
+		d := SetupTestDir()
+		defer CleanupTestDir(d)
+		dir := filepath.Join(d, "zome")
+		err := writeModules(dir, map[string]string{"../escaped.js": "bad"})
+		So(err, ShouldNotBeNil)
+		So(FileExists(d, "escaped.js"), ShouldBeFalse)
+	})
+	Convey("it should not load app packages with bad module names", t, func() {
+		_, err := LoadAppPackage(strings.NewReader(`{"DNA":{"Library":{"../../escaped.js":"bad"}}}`), "json")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ErrBadModuleName.Error())
+		_, err = LoadAppPackage(strings.NewReader(`{"DNA":{"Zomes":[{"Name":"z","Modules":{"/tmp/escaped.js":"bad"}}]}}`), "json")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, ErrBadModuleName.Error())
+	})
+}
+
+func TestJSRequire(t *testing.T) {
+	d, s, h := PrepareTestChain("test")
+	defer CleanupTestChain(h, d)
+
+	h.nucleus.dna.Library = map[string]string{
+		"strings.js": `exports.shout = function(s) {return s.toUpperCase()+"!"}`,
+	}
+	zome := &Zome{Name: "modular", RibosomeType: JSRibosomeType,
+		Modules: map[string]string{
+			"util/index.js": `var strings = require("strings"); exports.greet = function(n) {return strings.shout("hello "+n)}`,
+			"util/count.js": `var n = 0; module.exports = function() {return ++n}`,
+			"a.js":          `exports.name = "a"; exports.b = require("./b").name`,
+			"b.js":          `exports.name = "b"; exports.a = require("./a").name`,
+		},
+		Code: `var util = require("./util"); function greet(n) {return util.greet(n)}`,
+	}
+	z, err := NewJSRibosome(h, zome)
+
+	Convey("it should require modules from the zome and the library", t, func() {
+		So(err, ShouldBeNil)
+		v, err := z.Run(`greet("world")`)
+		So(err, ShouldBeNil)
+		So((v.(*otto.Value)).String(), ShouldEqual, "HELLO WORLD!")
+	})
+
+	Convey("it should run a module once", t, func() {
+		v, err := z.Run(`require("./util/count")(); require("./util/count.js")()`)
+		So(err, ShouldBeNil)
+		So((v.(*otto.Value)).String(), ShouldEqual, "2")
+	})
+
+	Convey("it should handle modules requiring each other", t, func() {
+		v, err := z.Run(`var a = require("./a"); a.name+a.b+require("./b").a`)
+		So(err, ShouldBeNil)
+		So((v.(*otto.Value)).String(), ShouldEqual, "aba")
+	})
+
+	Convey("it should throw for modules it can't require", t, func() {
+		_, err := z.Run(`require("./missing")`)
+		So(err.Error(), ShouldContainSubstring, "module not found: ./missing")
+		_, err = z.Run(`require("../other/code")`)
+		So(err.Error(), ShouldContainSubstring, ErrModuleOutsideZome.Error())
+	})
+
+	Convey("it should save and load modules with the DNA", t, func() {
+		var z *Zome
+		for i := range h.nucleus.dna.Zomes {
+			if h.nucleus.dna.Zomes[i].Name == "jsSampleZome" {
+				z = &h.nucleus.dna.Zomes[i]
+			}
+		}
+		z.Modules = zome.Modules
+		root := filepath.Join(d, "modules")
+		So(os.MkdirAll(filepath.Join(root, ChainDNADir), os.ModePerm), ShouldBeNil)
+		So(s.saveDNAFile(root, h.nucleus.dna, "json", false), ShouldBeNil)
+		So(FileExists(root, ChainDNADir, z.Name, "util", "index.js"), ShouldBeTrue)
+		So(FileExists(root, ChainDNADir, DNALibraryDir, "strings.js"), ShouldBeTrue)
+
+		dna, err := s.loadDNA(filepath.Join(root, ChainDNADir), DNAFileName, "json")
+		So(err, ShouldBeNil)
+		for _, dz := range dna.Zomes {
+			if dz.Name == z.Name {
+				So(dz.Modules, ShouldResemble, zome.Modules)
+			}
+		}
+		So(dna.Library, ShouldResemble, h.nucleus.dna.Library)
+		z.Modules = nil
+	})
+}
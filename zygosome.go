@@ -23,15 +23,21 @@ const (
 	ZygoRibosomeType = "zygo"
 )
 
-// ZygoRibosome holds data needed for the Zygo VM
+// ZygoRibosome holds data needed for the Zygo VM.  Unlike JS ribosomes they aren't
+// pooled, as what code leaves behind in the env can't be undone between uses.
 type ZygoRibosome struct {
 	h          *Holochain
 	zome       *Zome
 	env        *zygo.Zlisp
 	lastResult zygo.Sexp
 	library    string
+	deadline   time.Time // when the code being run runs out of time, zero for no limit
+	timedOut   bool      // set when the budget hook stopped the code being run
 }
 
+// errZygoTimeout is raised by the budget hook to stop code running past its deadline
+var errZygoTimeout = errors.New("zygo execution timed out")
+
 // Type returns the string value under which this ribosome is registered
 func (z *ZygoRibosome) Type() string { return ZygoRibosomeType }
 
@@ -49,14 +55,52 @@ func (z *ZygoRibosome) BridgeGenesis(side int, dnaHash Hash, data string) (err e
 	return
 }
 
+// checkBudget is added as a hook that zygomys calls before every function call, and
+// stops the code being run once it's past its deadline
+func (z *ZygoRibosome) checkBudget(env *zygo.Zlisp, name string, args []zygo.Sexp) {
+	if !z.deadline.IsZero() && time.Now().After(z.deadline) {
+		z.timedOut = true
+		panic(errZygoTimeout)
+	}
+}
+
+// run runs the loaded code within the DNA's execution budget for the callback type
+// zygomys can't interrupt code, so the budget is checked by a hook before each function
+// call, which leaves only loops that call no functions at all able to run past it
+func (z *ZygoRibosome) run(callbackType string, fnName string) (result zygo.Sexp, err error) {
+	timeout := z.h.executionBudget(callbackType).timeout()
+	if timeout == 0 {
+		result, err = z.env.Run()
+		return
+	}
+	z.deadline = time.Now().Add(timeout)
+	z.timedOut = false
+	defer func() {
+		z.deadline = time.Time{}
+		if caught := recover(); caught != nil && caught != errZygoTimeout {
+			panic(caught)
+		}
+		// a builtin that runs code, like apply, returns the panic as an error instead
+		// which is why the flag rather than the panic says the code was stopped
+		if z.timedOut {
+			// the code was stopped part way through so reset the stacks it left behind
+			z.env.Clear()
+			result = nil
+			err = &ExecutionTimeoutError{Zome: z.zome.Name, Callback: fnName, Timeout: timeout}
+		}
+	}()
+	result, err = z.env.Run()
+	return
+}
+
 func (z *ZygoRibosome) boolFn(fnName string, args string) (err error) {
 	err = z.env.LoadString("(" + fnName + " " + args + ")")
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run(CallbackTypeGenesis, fnName)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	switch result.(type) {
@@ -87,7 +131,7 @@ func (z *ZygoRibosome) Receive(from string, msg string) (response string, err er
 		return
 	}
 	var result interface{}
-	result, err = z.env.Run()
+	result, err = z.run(CallbackTypeReceive, fnName)
 	if err == nil {
 		switch t := result.(type) {
 		case *zygo.SexpStr:
@@ -118,9 +162,9 @@ func (z *ZygoRibosome) ValidatePackagingRequest(action ValidatingAction, def *En
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run(CallbackTypeValidate, fnName)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	switch v := result.(type) {
@@ -210,11 +254,29 @@ func buildZyValidateAction(action Action, def *EntryDef, pkg *ValidationPackage,
 	srcs := mkZySources(sources)
 
 	var pkgObj string
-	if pkg == nil || pkg.Chain == nil {
+	if pkg.appPackage() == nil {
 		pkgObj = "(hash)"
 	} else {
+		// the package is the chain itself, with any referenced entries under their own key
+		fields := make(map[string]json.RawMessage)
 		var j []byte
-		j, err = json.Marshal(pkg.Chain)
+		if pkg.Chain != nil {
+			j, err = json.Marshal(pkg.Chain)
+			if err != nil {
+				return
+			}
+			err = json.Unmarshal(j, &fields)
+			if err != nil {
+				return
+			}
+		}
+		if len(pkg.Entries) > 0 {
+			fields["References"], err = json.Marshal(pkg.Entries)
+			if err != nil {
+				return
+			}
+		}
+		j, err = json.Marshal(fields)
 		if err != nil {
 			return
 		}
@@ -274,9 +336,9 @@ func (z *ZygoRibosome) runValidate(fnName string, code string) (err error) {
 	if err != nil {
 		return
 	}
-	result, err := z.env.Run()
+	result, err := z.run(CallbackTypeValidate, fnName)
 	if err != nil {
-		err = fmt.Errorf("Error executing %s: %v", fnName, err)
+		err = execError(fnName, err)
 		return
 	}
 	switch v := result.(type) {
@@ -350,7 +412,7 @@ func (z *ZygoRibosome) Call(fn *FunctionDef, params interface{}) (result interfa
 	if err != nil {
 		return
 	}
-	result, err = z.env.Run()
+	result, err = z.run(CallbackTypeCall, fn.Name)
 	if err == nil {
 		switch fn.CallingType {
 		case STRING_CALLING:
@@ -400,6 +462,9 @@ const (
 		`(def HC_LinkAction_Add "` + AddLinkAction + "\")" +
 		`(def HC_LinkAction_Del "` + DelLinkAction + "\")" +
 		`(def HC_PkgReq_Chain "` + PkgReqChain + "\")" +
+		`(def HC_PkgReq_Types "` + PkgReqEntryTypes + "\")" +
+		`(def HC_PkgReq_Entries "` + PkgReqEntries + "\")" +
+		`(def HC_PkgReq_Fields "` + PkgReqFields + "\")" +
 		`(def HC_PkgReq_ChainOpt_None "` + PkgReqChainOptNoneStr + "\")" +
 		`(def HC_PkgReq_ChainOpt_Headers "` + PkgReqChainOptHeadersStr + "\")" +
 		`(def HC_PkgReq_ChainOpt_Entries "` + PkgReqChainOptEntriesStr + "\")" +
@@ -581,6 +646,7 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 		zome: zome,
 		env:  zygo.NewZlispSandbox(),
 	}
+	z.env.AddPreHook(z.checkBudget)
 
 	z.env.AddFunction("version",
 		func(env *zygo.Zlisp, name string, args []zygo.Sexp) (zygo.Sexp, error) {
@@ -656,6 +722,66 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return &result, nil
 		})
 
+	z.env.AddFunction("subscribe",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnSubscribe{zome: zome.Name}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.filter, err = subscriptionFilterFromMap(args[0].value.(map[string]interface{}))
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.callback = args[1].value.(string)
+			r, err := a.Call(h)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: r.(string)}, nil
+		})
+
+	z.env.AddFunction("unsubscribe",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnUnsubscribe{}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.id = args[0].value.(string)
+			_, err = a.Call(h)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("schedule",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnSchedule{zome: zome.Name}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.function = args[0].value.(string)
+			a.interval = args[1].value.(string)
+			_, err = a.Call(h)
+			return zygo.SexpNull, err
+		})
+
+	z.env.AddFunction("unschedule",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnUnschedule{zome: zome.Name}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.function = args[0].value.(string)
+			_, err = a.Call(h)
+			return zygo.SexpNull, err
+		})
+
 	z.env.AddFunction("getBridges",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			a := &APIFnGetBridges{}
@@ -706,6 +832,73 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 			return zbridges, err
 		})
 
+	z.env.AddFunction("getAgent",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnGetAgent{}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			a.agent = args[0].value.(Hash)
+			if len(zyargs) == 2 {
+				a.options, err = getAgentOptionsFromMap(args[1].value.(map[string]interface{}))
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+			}
+			r, err := a.Call(h)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			j, err := json.Marshal(r)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			return &zygo.SexpStr{S: string(j)}, nil
+		})
+
+	z.env.AddFunction("getPendingValidations",
+		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
+			a := &APIFnGetPendingValidations{}
+			args := a.Args()
+			err := zyProcessArgs(&z, args, zyargs)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			r, err := a.Call(h)
+			if err != nil {
+				return zygo.SexpNull, err
+			}
+			var pending []zygo.Sexp
+			for _, p := range r.([]PendingValidation) {
+				var zp *zygo.SexpHash
+				zp, err = zygo.MakeHash(nil, "hash", env)
+				if err != nil {
+					return zygo.SexpNull, err
+				}
+				fields := []struct {
+					name  string
+					value zygo.Sexp
+				}{
+					{"Hash", &zygo.SexpStr{S: p.Hash.String()}},
+					{"Action", &zygo.SexpStr{S: p.Action}},
+					{"Source", &zygo.SexpStr{S: p.Source}},
+					{"Since", &zygo.SexpStr{S: p.Since.Format(time.RFC3339)}},
+					{"Deadline", &zygo.SexpStr{S: p.Deadline.Format(time.RFC3339)}},
+					{"Attempts", &zygo.SexpInt{Val: int64(p.Attempts)}},
+				}
+				for _, f := range fields {
+					err = zp.HashSet(env.MakeSymbol(f.name), f.value)
+					if err != nil {
+						return zygo.SexpNull, err
+					}
+				}
+				pending = append(pending, zp)
+			}
+			return env.NewSexpArray(pending), nil
+		})
+
 	z.env.AddFunction("send",
 		func(env *zygo.Zlisp, name string, zyargs []zygo.Sexp) (zygo.Sexp, error) {
 			fn := &APIFnSend{}
@@ -1293,6 +1486,11 @@ func NewZygoRibosome(h *Holochain, zome *Zome) (n Ribosome, err error) {
 
 // Run executes zygo code
 func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
+	result, err = z.runCode(CallbackTypeCall, "code", code)
+	return
+}
+
+func (z *ZygoRibosome) runCode(callbackType string, fnName string, code string) (result interface{}, err error) {
 	c := fmt.Sprintf("(begin %s %s)", z.library, code)
 	err = z.env.LoadString(c)
 	if err != nil {
@@ -1300,9 +1498,11 @@ func (z *ZygoRibosome) Run(code string) (result interface{}, err error) {
 		return
 	}
 	var sexp zygo.Sexp
-	sexp, err = z.env.Run()
+	sexp, err = z.run(callbackType, fnName)
 	if err != nil {
-		err = errors.New("Zygomys exec error: " + err.Error())
+		if !IsExecutionTimeoutErr(err) {
+			err = errors.New("Zygomys exec error: " + err.Error())
+		}
 		return
 	}
 	z.lastResult = sexp
@@ -1373,6 +1573,6 @@ func addExtras(z *ZygoRibosome) {
 func (z *ZygoRibosome) RunAsyncSendResponse(response AppMsg, callback string, callbackID string) (result interface{}, err error) {
 	code := fmt.Sprintf(`(%s (unjson (raw "%s")) "%s")`, callback, sanitizeZyString(response.Body), sanitizeZyString(callbackID))
 	z.h.Debugf("Calling %s\n", code)
-	result, err = z.Run(code)
+	result, err = z.runCode(CallbackTypeReceive, callback, code)
 	return
 }
@@ -176,6 +176,13 @@ func TestNewZygoRibosome(t *testing.T) {
 			So(hash1.String(), ShouldEqual, profileHash.String())
 		})
 
+		Convey("getPendingValidations", func() {
+			_, err = z.Run(`(getPendingValidations)`)
+			So(err, ShouldBeNil)
+			z := v.(*ZygoRibosome)
+			So(len(z.lastResult.(*zygo.SexpArray).Val), ShouldEqual, 0)
+		})
+
 		Convey("getBridges", func() {
 			_, err = z.Run(`(getBridges)`)
 			So(err, ShouldBeNil)
@@ -398,6 +405,18 @@ func TestZybuildValidate(t *testing.T) {
 		So(err, ShouldBeNil)
 		//So(code, ShouldEqual, `validatePut("evenNumbers","2",{"EntryLink":"","Type":"","Time":"0001-01-01T00:00:00Z"},pgk,["fake_src_hash"])`)
 	})
+	Convey("it should pass the chain as the package with referenced entries under their own key", t, func() {
+		a := NewPutAction("evenNumbers", &e, &header)
+		hash := commit(h, "oddNumbers", "7")
+		pkg, _ := MakePackage(h, PackagingReq{PkgReqChain: int64(PkgReqChainOptFull), PkgReqEntries: []string{hash.String()}})
+		vpkg, err := MakeValidationPackage(h, &pkg)
+		So(err, ShouldBeNil)
+		code, err := buildZyValidateAction(a, &def, vpkg, []string{"fake_src_hash"})
+		So(err, ShouldBeNil)
+		So(code, ShouldContainSubstring, `\"Headers\":`)
+		So(code, ShouldContainSubstring, `\"References\":{\"`+hash.String()+`\":{\"Type\":\"oddNumbers\"`)
+		So(code, ShouldNotContainSubstring, `\"Chain\":`)
+	})
 }
 
 func TestZyValidateCommit(t *testing.T) {